@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// inspect runs process with a writer that collects its events, one per
+// line, and prints them to stdout, as indented JSON or as tables
+func inspect(asJSON bool, process func(io.Writer) error) error {
+	out := bytes.Buffer{}
+	if err := process(&out); err != nil {
+		return err
+	}
+
+	for _, payload := range bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n")) {
+		if len(payload) == 0 {
+			continue
+		}
+		if !asJSON {
+			if err := printEvent(os.Stdout, 0, payload, false); err != nil {
+				return err
+			}
+			continue
+		}
+
+		indented := bytes.Buffer{}
+		if err := json.Indent(&indented, payload, "", "  "); err != nil {
+			return err
+		}
+		fmt.Println(indented.String())
+	}
+	return nil
+}
@@ -0,0 +1,608 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	stan "github.com/nats-io/stan.go"
+	cli "github.com/urfave/cli/v2"
+	"github.com/xmrstuff/monero-nats-publisher/consumer"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"github.com/xmrstuff/monero-nats-publisher/publisher"
+)
+
+// TODO: Adopt a logging library
+
+func main() {
+	var settings publisher.Settings
+	var configPath, metricsAddr string
+	var daemonURLs cli.StringSlice
+
+	config := publisher.NewConfig()
+	// wiring is called from the Actions, once the flags of the subcommand
+	// are parsed too
+	wiring := func() *publisher.Wiring {
+		settings.DaemonURLs = splitList(daemonURLs.Value())
+		return publisher.FromConfig(config, settings)
+	}
+
+	// serveMetrics serves the metrics in the background. Only the long
+	// running commands do, since the counters don't outlive the process.
+	serveMetrics := func() {
+		if metricsAddr == "" {
+			return
+		}
+		go func() {
+			log.Printf("Unable to serve metrics: %s", publisher.ServeMetrics(metricsAddr))
+		}()
+	}
+
+	app := &cli.App{
+		Before: func(c *cli.Context) error {
+			if !c.IsSet("agent-socket") {
+				settings.AgentSocket = publisher.DefaultAgentSocket(settings.StateDir)
+			}
+			if configPath == "" {
+				return nil
+			}
+			// Fail early on invalid configs, e.g. profile templates that
+			// don't render
+			loaded, err := publisher.LoadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			config = loaded
+			return nil
+		},
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:        "nats-url",
+				Aliases:     []string{"nats", "n"},
+				Value:       "http://localhost:4222",
+				Usage:       "URL to the NATS Streaming Server",
+				Destination: &settings.NATSURL,
+			},
+			&cli.IntFlag{
+				Name:        "ignore-below-height",
+				Aliases:     []string{"i"},
+				Value:       0,
+				Usage:       "Ignores Blocks and Transactions with height lower than this value",
+				Destination: &settings.IgnoreBelowHeight,
+			},
+			&cli.StringFlag{
+				Name:        "state-dir",
+				Aliases:     []string{"s"},
+				Value:       "",
+				Usage:       "Directory where local state (e.g. invoices) is kept. Invoice tracking is disabled when empty",
+				Destination: &settings.StateDir,
+			},
+			&cli.BoolFlag{
+				Name:        "string-amounts",
+				Usage:       "Also include the atomic amounts of Tx events encoded as strings, for consumers that can't decode uint64 numbers",
+				Destination: &settings.StringAmounts,
+			},
+			&cli.StringFlag{
+				Name:        "client-id-prefix",
+				Value:       publisher.DefaultClientIDPrefix,
+				Usage:       "Prefix of the NATS Streaming client ID. The host, pid and a random suffix are appended to it, to keep it unique",
+				Destination: &settings.ClientIDPrefix,
+			},
+			&cli.StringFlag{
+				Name:        "lock-file",
+				Value:       "",
+				Usage:       "Local file to lock while publishing, so concurrent invocations publish one at a time. No locking when empty",
+				Destination: &settings.LockFile,
+			},
+			&cli.StringFlag{
+				Name:        "agent-socket",
+				Usage:       "Unix socket of the agent that tx and block commands hand off their work to. They do it themselves when no agent listens on it, or when empty. Defaults to agent.sock in --state-dir, or else in $XDG_RUNTIME_DIR",
+				Destination: &settings.AgentSocket,
+			},
+			&cli.StringFlag{
+				Name:        "wallet-proxy",
+				Value:       "",
+				Usage:       "SOCKS5 proxy to reach the wallet RPC through, e.g. socks5h://127.0.0.1:9050 for Tor",
+				Destination: &settings.WalletProxy,
+			},
+			&cli.StringFlag{
+				Name:        "daemon-proxy",
+				Value:       "",
+				Usage:       "SOCKS5 proxy to reach the daemon RPC through, e.g. socks5h://127.0.0.1:9050 for Tor. Each daemon gets its own circuits",
+				Destination: &settings.DaemonProxy,
+			},
+			&cli.IntFlag{
+				Name:        "rpc-cache-size",
+				Value:       0,
+				Usage:       "Number of immutable daemon RPC results (blocks by hash, final headers) to keep in memory. No caching when 0",
+				Destination: &settings.RPCCacheSize,
+			},
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "Write the events to stdout instead of publishing them. The local state and the agent are left alone",
+				Destination: &settings.DryRun,
+			},
+			&cli.StringFlag{
+				Name:        "signing-key-file",
+				Usage:       "File with the base64 key to sign the events with. Events aren't signed when empty",
+				Destination: &settings.SigningKeyFile,
+			},
+			&cli.StringFlag{
+				Name:        "signing-alg",
+				Value:       events.HMACSHA256,
+				Usage:       "Algorithm to sign the events with: hmac-sha256 (shared key) or ed25519 (private key or seed)",
+				Destination: &settings.SigningAlg,
+			},
+			&cli.StringFlag{
+				Name:        "signing-key-id",
+				Usage:       "ID of the signing key, so that consumers know which key to verify the events with",
+				Destination: &settings.SigningKeyID,
+			},
+			&cli.StringFlag{
+				Name:        "metrics-addr",
+				Usage:       "Address the agent and watch-wallet commands serve the metrics (e.g. the Txs dropped by each rule) on, at /debug/vars. Not served when empty",
+				Destination: &metricsAddr,
+			},
+			&cli.StringFlag{
+				Name:        "config",
+				Aliases:     []string{"c"},
+				Value:       "",
+				Usage:       "Path to the JSON config file",
+				Destination: &configPath,
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "ping",
+				Usage: "Pings the NATS server, to verify that connection is configured properly",
+				Action: func(c *cli.Context) error {
+					if settings.DryRun {
+						return fmt.Errorf("ping command can't run with --dry-run, which doesn't connect to NATS")
+					}
+					return wiring().Ping()
+				},
+			},
+			{
+				Name:    "transaction",
+				Aliases: []string{"tx"},
+				Usage:   "Gather extra context about a Monero Tx and publish it through NATS",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "monero-wallet-rpc-url",
+						Aliases:     []string{"wallet", "w"},
+						Value:       "http://localhost:38083",
+						Usage:       "URL to the RPC server of the Monero Wallet",
+						Destination: &settings.WalletURL,
+					},
+					&cli.DurationFlag{
+						Name:        "visibility-timeout",
+						Value:       20 * time.Second,
+						Usage:       "How long to keep querying the wallet for a Tx it doesn't report yet. A transaction.unresolved event is published when it expires",
+						Destination: &settings.VisibilityTimeout,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					txid := c.Args().First()
+					if txid == "" {
+						return fmt.Errorf("tx command requires a txid argument")
+					}
+					return wiring().PublishTx(txid)
+				},
+			},
+			{
+				Name:    "block",
+				Aliases: []string{"blk"},
+				Usage:   "Gather extra context about a Monero Block and publish it through NATS",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:        "monero-daemon-rpc-url",
+						Aliases:     []string{"daemon", "d"},
+						Value:       cli.NewStringSlice("http://localhost:38081"),
+						Usage:       "URL to the RPC server of the Monero Daemon. Can be repeated (or comma separated) to fail over across several daemons",
+						Destination: &daemonURLs,
+					},
+					&cli.BoolFlag{
+						Name:        "daemon-quorum",
+						Usage:       "Only publish blocks once two daemons agree on them",
+						Destination: &settings.DaemonQuorum,
+					},
+					&cli.IntFlag{
+						Name:        "max-extra-ancestor-blocks",
+						Aliases:     []string{"extra-ancestors", "ea"},
+						Value:       0,
+						Usage:       "Max number of extra ancestor blocks to include with each published block",
+						Destination: &settings.MaxExtraAncestors,
+					},
+					&cli.IntFlag{
+						Name:        "max-catch-up-blocks",
+						Value:       100,
+						Usage:       "Max number of missed blocks to publish before a block, when --state-dir records the last published one. No catch up when 0",
+						Destination: &settings.MaxCatchUp,
+					},
+					&cli.DurationFlag{
+						Name:        "block-hold-timeout",
+						Value:       30 * time.Second,
+						Usage:       "How long a block that arrives before its predecessor waits for it to be published, when --state-dir is set",
+						Destination: &settings.BlockHoldTimeout,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					blockHash := c.Args().First()
+					if blockHash == "" {
+						return fmt.Errorf("block command requires a blockHash argument")
+					}
+					return wiring().PublishBlock(blockHash)
+				},
+			},
+			{
+				Name:  "agent",
+				Usage: "Run a resident agent that keeps its connections open, and processes the txs and blocks handed off by the tx and block commands",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "monero-wallet-rpc-url",
+						Aliases:     []string{"wallet", "w"},
+						Value:       "http://localhost:38083",
+						Usage:       "URL to the RPC server of the Monero Wallet",
+						Destination: &settings.WalletURL,
+					},
+					&cli.DurationFlag{
+						Name:        "visibility-timeout",
+						Value:       20 * time.Second,
+						Usage:       "How long to keep querying the wallet for a Tx it doesn't report yet. A transaction.unresolved event is published when it expires",
+						Destination: &settings.VisibilityTimeout,
+					},
+					&cli.StringSliceFlag{
+						Name:        "monero-daemon-rpc-url",
+						Aliases:     []string{"daemon", "d"},
+						Value:       cli.NewStringSlice("http://localhost:38081"),
+						Usage:       "URL to the RPC server of the Monero Daemon. Can be repeated (or comma separated) to fail over across several daemons",
+						Destination: &daemonURLs,
+					},
+					&cli.BoolFlag{
+						Name:        "daemon-quorum",
+						Usage:       "Only publish blocks once two daemons agree on them",
+						Destination: &settings.DaemonQuorum,
+					},
+					&cli.IntFlag{
+						Name:        "max-extra-ancestor-blocks",
+						Aliases:     []string{"extra-ancestors", "ea"},
+						Value:       0,
+						Usage:       "Max number of extra ancestor blocks to include with each published block",
+						Destination: &settings.MaxExtraAncestors,
+					},
+					&cli.IntFlag{
+						Name:        "max-catch-up-blocks",
+						Value:       100,
+						Usage:       "Max number of missed blocks to publish before a block, when --state-dir records the last published one. No catch up when 0",
+						Destination: &settings.MaxCatchUp,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if settings.AgentSocket == "" {
+						return fmt.Errorf("agent command requires --agent-socket, --state-dir or $XDG_RUNTIME_DIR")
+					}
+
+					serveMetrics()
+					return wiring().ServeAgent(interruptContext())
+				},
+			},
+			{
+				Name:  "watch-wallet",
+				Usage: "Poll the wallets listed in the config file concurrently, and publish their incoming Txs through NATS",
+				Action: func(c *cli.Context) error {
+					if configPath == "" {
+						return fmt.Errorf("watch-wallet command requires --config")
+					}
+					if len(config.Wallets) == 0 {
+						return fmt.Errorf("no wallets to watch in %s", configPath)
+					}
+
+					serveMetrics()
+					return wiring().WatchWallets(interruptContext())
+				},
+			},
+			{
+				Name:  "serve",
+				Usage: "Serve commands (e.g. subaddress creation) through NATS request/reply",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "monero-wallet-rpc-url",
+						Aliases:     []string{"wallet", "w"},
+						Value:       "http://localhost:38083",
+						Usage:       "URL to the RPC server of the Monero Wallet",
+						Destination: &settings.WalletURL,
+					},
+					&cli.StringFlag{
+						Name:  "subject-prefix",
+						Value: events.CommandsSubject,
+						Usage: "Prefix of the NATS subjects the commands are served on",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return wiring().ServeCommands(interruptContext(), c.String("subject-prefix"))
+				},
+			},
+			{
+				Name:  "invoice",
+				Usage: "Manage the expected payments that incoming Monero Txs are matched against",
+				Before: func(c *cli.Context) error {
+					if settings.StateDir == "" {
+						return fmt.Errorf("invoice commands require --state-dir")
+					}
+					return nil
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:  "create",
+						Usage: "Register an expected payment",
+						Flags: []cli.Flag{
+							&cli.StringFlag{Name: "id", Usage: "Invoice ID. A random one is generated when empty"},
+							&cli.StringFlag{Name: "address", Aliases: []string{"a"}, Usage: "(Sub)address the payment is expected on", Required: true},
+							&cli.Uint64Flag{Name: "amount", Usage: "Expected amount, in atomic units"},
+							&cli.StringFlag{Name: "amount-xmr", Usage: "Expected amount, in XMR (e.g. 1.5). Alternative to --amount"},
+							&cli.DurationFlag{Name: "expires-in", Usage: "Time after which an unpaid invoice expires. Never expires when 0"},
+						},
+						Action: func(c *cli.Context) error {
+							amount := c.Uint64("amount")
+							if c.IsSet("amount") && c.IsSet("amount-xmr") {
+								return fmt.Errorf("--amount and --amount-xmr are mutually exclusive")
+							}
+							if c.IsSet("amount-xmr") {
+								xmr, err := events.ParseXMR(c.String("amount-xmr"))
+								if err != nil {
+									return err
+								}
+								amount = xmr
+							}
+
+							inv, err := events.NewInvoice(c.String("id"), c.String("address"), amount, time.Now(), c.Duration("expires-in"))
+							if err != nil {
+								return err
+							}
+
+							if err := publisher.NewInvoiceStore(settings.StateDir).Add(*inv); err != nil {
+								return err
+							}
+							fmt.Println(inv.ID)
+							return nil
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "List the registered invoices",
+						Action: func(c *cli.Context) error {
+							invoices, err := publisher.NewInvoiceStore(settings.StateDir).List()
+							if err != nil {
+								return err
+							}
+
+							for _, inv := range invoices {
+								fmt.Printf("%s\t%s\t%d/%d\t%s\n", inv.ID, inv.Status, inv.Received, inv.Amount, inv.Address)
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "expire",
+						Usage: "Expire the overdue invoices and publish their events through NATS",
+						Action: func(c *cli.Context) error {
+							return wiring().ExpireInvoices()
+						},
+					},
+				},
+			},
+			{
+				Name:  "inspect",
+				Usage: "Print the event that would be published for a Monero Tx or Block, without publishing it",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "tx",
+						Usage: "Print the event of a Monero Tx",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:        "monero-wallet-rpc-url",
+								Aliases:     []string{"wallet", "w"},
+								Value:       "http://localhost:38083",
+								Usage:       "URL to the RPC server of the Monero Wallet",
+								Destination: &settings.WalletURL,
+							},
+							&cli.BoolFlag{Name: "json", Usage: "Print the event as JSON instead of a table"},
+						},
+						Action: func(c *cli.Context) error {
+							txid := c.Args().First()
+							if txid == "" {
+								return fmt.Errorf("inspect tx command requires a txid argument")
+							}
+
+							return inspect(c.Bool("json"), func(out io.Writer) error {
+								return wiring().InspectTx(txid, out)
+							})
+						},
+					},
+					{
+						Name:  "block",
+						Usage: "Print the event of a Monero Block",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:        "monero-daemon-rpc-url",
+								Aliases:     []string{"daemon", "d"},
+								Value:       cli.NewStringSlice("http://localhost:38081"),
+								Usage:       "URL to the RPC server of the Monero Daemon. Can be repeated (or comma separated) to fail over across several daemons",
+								Destination: &daemonURLs,
+							},
+							&cli.IntFlag{
+								Name:        "max-extra-ancestor-blocks",
+								Aliases:     []string{"extra-ancestors", "ea"},
+								Value:       0,
+								Usage:       "Max number of extra ancestor blocks to include with the block",
+								Destination: &settings.MaxExtraAncestors,
+							},
+							&cli.BoolFlag{Name: "json", Usage: "Print the event as JSON instead of a table"},
+						},
+						Action: func(c *cli.Context) error {
+							blockHash := c.Args().First()
+							if blockHash == "" {
+								return fmt.Errorf("inspect block command requires a blockHash argument")
+							}
+
+							return inspect(c.Bool("json"), func(out io.Writer) error {
+								return wiring().InspectBlock(blockHash, out)
+							})
+						},
+					},
+				},
+			},
+			{
+				Name:      "verify",
+				Usage:     "Verify the signatures of NDJSON events read from the files, or from stdin",
+				ArgsUsage: "[file...]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "key-file", Usage: "File with the base64 key to verify the events with. Ed25519 public or private keys", Required: true},
+					&cli.StringFlag{Name: "alg", Value: events.HMACSHA256, Usage: "Signing algorithm: hmac-sha256 or ed25519"},
+					&cli.StringFlag{Name: "key-id", Usage: "ID of the key"},
+					&cli.StringFlag{Name: "channel", Usage: "Channel the events must have been signed for. Any channel when empty"},
+					&cli.DurationFlag{Name: "max-age", Usage: "How long ago the events may have been signed. No limit when 0, e.g. for archived events"},
+				},
+				Action: func(c *cli.Context) error {
+					verifier := events.NewVerifier()
+					verifier.MaxAge = c.Duration("max-age")
+					if err := verifier.AddKeyFile(c.String("alg"), c.String("key-id"), c.String("key-file")); err != nil {
+						return err
+					}
+					return verifyEvents(verifier, c.String("channel"), c.Args().Slice())
+				},
+			},
+			{
+				Name:  "keygen",
+				Usage: "Generate a base64 signing or encryption key, or an age identity. Ed25519, NaCl box and age public keys are written to <out>.pub",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "out", Usage: "File to write the key to", Required: true},
+					&cli.StringFlag{Name: "alg", Value: events.HMACSHA256, Usage: "Key algorithm: hmac-sha256, ed25519, nacl-box or age"},
+				},
+				Action: func(c *cli.Context) error {
+					return generateKey(c.String("alg"), c.String("out"))
+				},
+			},
+			{
+				Name:    "subscribe",
+				Aliases: []string{"tail"},
+				Usage:   "Print the events published to NATS, for debugging",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{Name: "type", Usage: "Only print events of this type. Can be repeated (or comma separated)"},
+					&cli.StringSliceFlag{Name: "txid", Usage: "Only print the events about this Tx. Can be repeated (or comma separated)"},
+					&cli.StringSliceFlag{Name: "address", Usage: "Only print the events about this (sub)address. Can be repeated (or comma separated)"},
+					&cli.IntFlag{Name: "height", Usage: "Only print the Txs and blocks at this height"},
+					&cli.StringFlag{Name: "since", Usage: "Start from a sequence number, a duration back from now (e.g. 1h) or an RFC 3339 timestamp. Only new events when empty"},
+					&cli.StringFlag{Name: "durable", Usage: "Durable subscription name, to resume where the previous subscription with that name stopped"},
+					&cli.StringFlag{Name: "channel", Value: events.DefaultChannel, Usage: "NATS Streaming channel to subscribe to"},
+					&cli.BoolFlag{Name: "ndjson", Usage: "Print the events as NDJSON instead of tables"},
+					&cli.StringFlag{Name: "decrypt-key-file", Usage: "File with the base64 NaCl box private key to open encrypted events with"},
+					&cli.StringFlag{Name: "decrypt-key-id", Usage: "ID of the key the events were encrypted for"},
+				},
+				Action: func(c *cli.Context) error {
+					filter := consumer.Filter{
+						Types:     splitList(c.StringSlice("type")),
+						TXIDs:     splitList(c.StringSlice("txid")),
+						Addresses: splitList(c.StringSlice("address")),
+						Height:    c.Int("height"),
+					}
+
+					opts := []stan.SubscriptionOption{}
+					if c.IsSet("since") {
+						since, err := consumer.ParseSince(c.String("since"))
+						if err != nil {
+							return err
+						}
+						opts = append(opts, since)
+					}
+					if c.IsSet("durable") {
+						opts = append(opts, stan.DurableName(c.String("durable")))
+					}
+
+					var decrypter *events.Decrypter
+					if c.IsSet("decrypt-key-file") {
+						d, err := events.LoadDecrypter(c.String("decrypt-key-id"), c.String("decrypt-key-file"))
+						if err != nil {
+							return err
+						}
+						decrypter = d
+					}
+
+					sc, err := stan.Connect(publisher.ClusterID, publisher.NewClientID(settings.ClientIDPrefix), stan.NatsURL(settings.NATSURL))
+					if err != nil {
+						return err
+					}
+					defer sc.Close()
+
+					sub, err := sc.Subscribe(c.String("channel"), func(msg *stan.Msg) {
+						payload := msg.Data
+						if decrypter != nil {
+							decrypted, err := decrypter.Decrypt(payload)
+							if err != nil {
+								log.Printf("Unable to decrypt message %d: %s", msg.Sequence, err)
+							} else {
+								payload = decrypted
+							}
+						}
+
+						match, err := filter.Match(payload)
+						if err != nil {
+							log.Printf("Skipping message %d: %s", msg.Sequence, err)
+							return
+						}
+						if !match {
+							return
+						}
+						if err := printEvent(os.Stdout, msg.Sequence, payload, c.Bool("ndjson")); err != nil {
+							log.Printf("Unable to print message %d: %s", msg.Sequence, err)
+						}
+					}, opts...)
+					if err != nil {
+						return err
+					}
+
+					<-interruptContext().Done()
+					// Close keeps the position of durable subscriptions,
+					// unlike Unsubscribe
+					return sub.Close()
+				},
+			},
+		},
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// splitList splits the comma separated values of a repeatable flag
+func splitList(values []string) []string {
+	items := []string{}
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// interruptContext returns a Context that is cancelled on SIGINT or SIGTERM
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+	return ctx
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c"}, splitList([]string{"a, b", "c", ""}))
+	assert.Equal(t, []string{}, splitList([]string{}))
+}
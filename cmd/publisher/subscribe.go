@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+// printEvent writes an event received on the given sequence, either as a
+// NDJSON line or as a readable table. The sequence is left out when 0.
+func printEvent(w io.Writer, seq uint64, payload []byte, ndjson bool) error {
+	if ndjson {
+		line := bytes.Buffer{}
+		if err := json.Compact(&line, payload); err != nil {
+			return err
+		}
+		line.WriteByte('\n')
+		_, err := w.Write(line.Bytes())
+		return err
+	}
+
+	ev := struct {
+		Type       string             `json:"type"`
+		Version    string             `json:"version"`
+		ID         string             `json:"id"`
+		Data       json.RawMessage    `json:"data"`
+		Encryption *events.Encryption `json:"encryption"`
+	}{}
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return err
+	}
+
+	if seq != 0 {
+		fmt.Fprintf(w, "#%d ", seq)
+	}
+	fmt.Fprintf(w, "%s %s\n", ev.Type, ev.Version)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	var err error
+	switch {
+	case ev.Encryption != nil:
+		printEncrypted(tw, ev.ID, ev.Encryption)
+	case ev.Type == events.TxCreated:
+		err = printTx(tw, ev.Data)
+	case ev.Type == events.BlockCreated:
+		err = printBlock(tw, ev.Data)
+	default:
+		fmt.Fprintf(tw, "  data\t%s\n", ev.Data)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(tw)
+	return tw.Flush()
+}
+
+func printTx(w *tabwriter.Writer, data json.RawMessage) error {
+	tx := events.Tx{}
+	if err := json.Unmarshal(data, &tx); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "  txid\t%s\n", tx.TXID)
+	if tx.Wallet != "" {
+		fmt.Fprintf(w, "  wallet\t%s\n", tx.Wallet)
+	}
+	fmt.Fprintf(w, "  height\t%d\n", tx.Height)
+	fmt.Fprintf(w, "  time\t%s\n", formatTimestamp(tx.Timestamp))
+	fmt.Fprintf(w, "  confirmations\t%d\n", tx.Confirmations)
+	fmt.Fprintf(w, "  fee\t%s XMR\n", events.FormatXMR(tx.Fee))
+	if tx.PaymentID != "" {
+		fmt.Fprintf(w, "  payment id\t%s\n", tx.PaymentID)
+	}
+	if tx.Locked || tx.DoubleSpendSeen {
+		fmt.Fprintf(w, "  locked\t%t\tdouble spend seen\t%t\n", tx.Locked, tx.DoubleSpendSeen)
+	}
+
+	// The destinations get their own columns
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "  AMOUNT\tACCOUNT\tSUBADDR\tADDRESS\tLABEL\n")
+	for _, d := range tx.Destinations {
+		fmt.Fprintf(w, "  %s\t%d\t%d\t%s\t%s\n", events.FormatXMR(d.Amount), d.AccountIndex, d.SubaddrIndex, d.Address, d.Label)
+	}
+	return nil
+}
+
+func printBlock(w io.Writer, data json.RawMessage) error {
+	blk := events.Block{}
+	if err := json.Unmarshal(data, &blk); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "  hash\t%s\n", blk.Hash)
+	fmt.Fprintf(w, "  height\t%d\n", blk.Height)
+	fmt.Fprintf(w, "  time\t%s\n", formatTimestamp(blk.Timestamp))
+	if blk.CatchUp {
+		fmt.Fprintf(w, "  catch up\ttrue\n")
+	}
+	for i, hash := range blk.PrevHashes {
+		fmt.Fprintf(w, "  prev %d\t%s\n", i+1, hash)
+	}
+	for _, hash := range blk.TxHashes {
+		fmt.Fprintf(w, "  tx\t%s\n", hash)
+	}
+	return nil
+}
+
+func printEncrypted(w io.Writer, id string, enc *events.Encryption) {
+	fmt.Fprintf(w, "  id\t%s\n", id)
+	for _, r := range enc.Recipients {
+		fmt.Fprintf(w, "  encrypted for\t%s\n", r.KeyID)
+	}
+}
+
+func formatTimestamp(ts int) string {
+	if ts == 0 {
+		return "-"
+	}
+	return time.Unix(int64(ts), 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+func TestPrintEvent(t *testing.T) {
+	payload, _ := json.MarshalIndent(events.NewTXCreatedEvent(events.Tx{
+		TXID:         "abc",
+		Height:       100,
+		Fee:          10,
+		Destinations: []events.Destination{{Amount: 1500000000000, Address: "addr1", SubaddrIndex: 2}},
+	}), "", "  ")
+
+	out := bytes.Buffer{}
+	assert.Nil(t, printEvent(&out, 7, payload, true))
+	assert.Equal(t, 1, bytes.Count(out.Bytes(), []byte("\n")))
+	assert.JSONEq(t, string(payload), out.String())
+
+	out.Reset()
+	assert.Nil(t, printEvent(&out, 7, payload, false))
+	assert.Contains(t, out.String(), "#7 transaction.created 2.0")
+	assert.Contains(t, out.String(), "txid           abc")
+	assert.Contains(t, out.String(), "1.500000000000")
+	assert.Contains(t, out.String(), "addr1")
+
+	block, _ := json.Marshal(events.NewBlockCreatedEvent(events.Block{Hash: "h", Height: 5, TxHashes: []string{"t1"}}))
+	out.Reset()
+	assert.Nil(t, printEvent(&out, 8, block, false))
+	assert.Contains(t, out.String(), "block.created")
+	assert.Contains(t, out.String(), "t1")
+}
+
+func TestPrintEncryptedEvent(t *testing.T) {
+	payload := []byte(`{"type":"transaction.created","version":"2.0","id":"abc","data":"c2VhbGVk","encryption":{"alg":"nacl-box","recipients":[{"key_id":"ops"}]}}`)
+
+	out := bytes.Buffer{}
+	assert.Nil(t, printEvent(&out, 3, payload, false))
+	assert.Contains(t, out.String(), "id             abc")
+	assert.Contains(t, out.String(), "encrypted for  ops")
+}
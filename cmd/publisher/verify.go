@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"filippo.io/age"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// verifyEvents checks every line of the files, or of stdin when there are
+// none. It fails when any event isn't valid.
+func verifyEvents(verifier *events.Verifier, channel string, paths []string) error {
+	if len(paths) == 0 {
+		return verifyLines(os.Stdout, verifier, channel, "stdin", os.Stdin)
+	}
+
+	invalid := 0
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = verifyLines(os.Stdout, verifier, channel, path, f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d files hold invalid events", invalid, len(paths))
+	}
+	return nil
+}
+
+// verifyLines checks the events were signed for the channel. Any channel
+// is accepted when it's empty.
+func verifyLines(w io.Writer, verifier *events.Verifier, channel, name string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	// Blocks with many Txs make for long lines
+	scanner.Buffer(nil, 16*1024*1024)
+
+	total, invalid := 0, 0
+	for line := 1; scanner.Scan(); line++ {
+		payload := bytes.TrimSpace(scanner.Bytes())
+		if len(payload) == 0 {
+			continue
+		}
+
+		total++
+		ev, err := verifier.Verify(payload, channel)
+		if err != nil {
+			invalid++
+			fmt.Fprintf(w, "%s:%d\tINVALID\t%s\n", name, line, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s:%d\tOK\t%s\t%s\n", name, line, ev.Type, ev.Signature.KeyID)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if invalid > 0 {
+		return fmt.Errorf("%s: %d of %d events are invalid", name, invalid, total)
+	}
+	return nil
+}
+
+// generateKey writes a new random key, base64 encoded, and the public key
+// of key pairs next to it
+func generateKey(alg, path string) error {
+	write := func(path string, key []byte) error {
+		return ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+	}
+
+	switch alg {
+	case events.HMACSHA256:
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		return write(path, key)
+	case events.Ed25519:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		if err := write(path, private.Seed()); err != nil {
+			return err
+		}
+		return write(path+".pub", public)
+	case events.Age:
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			return err
+		}
+		// age keys are written in their own text format, as age-keygen does
+		if err := ioutil.WriteFile(path, []byte(identity.String()+"\n"), 0600); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path+".pub", []byte(identity.Recipient().String()+"\n"), 0600)
+	case events.NaClBox:
+		public, private, err := box.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		if err := write(path, private[:]); err != nil {
+			return err
+		}
+		return write(path+".pub", public[:])
+	}
+	return fmt.Errorf("unknown key algorithm %q", alg)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+func TestGenerateKeyAndVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-verify")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "key")
+	assert.Nil(t, generateKey(events.Ed25519, keyFile))
+
+	signer, err := events.LoadSigner(events.Ed25519, "key1", keyFile)
+	assert.Nil(t, err)
+	ev, err := signer.Sign(events.NewBlockCreatedEvent(events.Block{Hash: "abc"}), events.DefaultChannel)
+	assert.Nil(t, err)
+	signed, _ := json.Marshal(ev)
+	unsigned, _ := json.Marshal(events.NewBlockCreatedEvent(events.Block{Hash: "abc"}))
+
+	verifier := events.NewVerifier()
+	assert.Nil(t, verifier.AddKeyFile(events.Ed25519, "key1", keyFile+".pub"))
+
+	out := bytes.Buffer{}
+	assert.Nil(t, verifyLines(&out, verifier, events.DefaultChannel, "events", bytes.NewReader(append(signed, '\n'))))
+	assert.Equal(t, "events:1\tOK\tblock.created\tkey1\n", out.String())
+
+	out.Reset()
+	input := strings.Join([]string{string(signed), "", string(unsigned)}, "\n")
+	assert.EqualError(t, verifyLines(&out, verifier, "", "events", strings.NewReader(input)), "events: 1 of 2 events are invalid")
+	assert.Contains(t, out.String(), "events:3\tINVALID")
+}
+
+func TestGenerateNaClBoxKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-keygen")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "ops")
+	assert.Nil(t, generateKey(events.NaClBox, keyFile))
+
+	recipient, err := events.LoadRecipient("ops", keyFile+".pub")
+	assert.Nil(t, err)
+	decrypter, err := events.LoadDecrypter("ops", keyFile)
+	assert.Nil(t, err)
+	assert.Equal(t, recipient.PublicKey, decrypter.PublicKey)
+
+	ageFile := filepath.Join(dir, "accounting")
+	assert.Nil(t, generateKey(events.Age, ageFile))
+	recipient, err = events.LoadRecipient("accounting", ageFile+".pub")
+	assert.Nil(t, err)
+	assert.NotNil(t, recipient.Age)
+	decrypter, err = events.LoadDecrypter("accounting", ageFile)
+	assert.Nil(t, err)
+	assert.Len(t, decrypter.AgeIdentities, 1)
+
+	assert.Error(t, generateKey("rot13", keyFile))
+}
@@ -0,0 +1,276 @@
+// Package consumer subscribes to the events published by the publisher,
+// and dispatches them to typed handlers.
+//
+// Subscriptions go through NATS Streaming, with durable names and manual
+// acks: an event is acked once its handler succeeds, and redelivered when
+// it fails, until it's moved to a dead letter channel after MaxAttempts.
+package consumer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	stan "github.com/nats-io/stan.go"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+const (
+	DefaultMaxAttempts = 5
+	DefaultAckWait     = 30 * time.Second
+)
+
+// ErrUnsupportedVersion is returned for events of a major version newer
+// than the consumer understands, or with a malformed version. They're dead
+// lettered right away, since redelivering them won't help.
+var ErrUnsupportedVersion = errors.New("unsupported event version")
+
+// DeadLetter is what is published to the dead letter channel, for the
+// events that couldn't be handled
+type DeadLetter struct {
+	Channel  string          `json:"channel"`
+	Sequence uint64          `json:"sequence"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Event    json.RawMessage `json:"event"`
+}
+
+// envelope is an events.Event whose Data is decoded once its Type is known
+type envelope struct {
+	Type       string             `json:"type"`
+	Version    string             `json:"version"`
+	ID         string             `json:"id"`
+	Data       json.RawMessage    `json:"data"`
+	Encryption *events.Encryption `json:"encryption"`
+}
+
+type handler struct {
+	// MaxMajor is the newest major version the handler can decode. Older
+	// ones are accepted, since fields are only added within the payloads.
+	MaxMajor int
+	Handle   func(json.RawMessage) error
+}
+
+// DeadLetterPublisher is where the dead letters are published. stan.Conn
+// satisfies it.
+type DeadLetterPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+type Consumer struct {
+	Conn    stan.Conn
+	Channel string
+	// Durable is the durable subscription name, so that the position in
+	// the channel survives restarts
+	Durable string
+	// MaxAttempts is how many times an event is handled before it's dead
+	// lettered
+	MaxAttempts int
+	AckWait     time.Duration
+	// DeadLetterChannel defaults to "<Channel>.dead"
+	DeadLetterChannel string
+	DeadLetters       DeadLetterPublisher
+	// Verifier rejects the events that aren't signed by its keys, for the
+	// channel they're received on, when set. They're dead lettered right
+	// away.
+	Verifier *events.Verifier
+	// Decrypter opens the encrypted events. Without it, or when they
+	// weren't encrypted for its key, they're dead lettered right away.
+	Decrypter *events.Decrypter
+
+	handlers map[string]handler
+}
+
+func New(sc stan.Conn, durable string) *Consumer {
+	return &Consumer{
+		Conn:        sc,
+		Channel:     events.DefaultChannel,
+		Durable:     durable,
+		MaxAttempts: DefaultMaxAttempts,
+		AckWait:     DefaultAckWait,
+		DeadLetters: sc,
+		handlers:    map[string]handler{},
+	}
+}
+
+func (c *Consumer) on(evType, version string, handle func(json.RawMessage) error) {
+	major, _ := majorVersion(version)
+	c.handlers[evType] = handler{MaxMajor: major, Handle: handle}
+}
+
+func (c *Consumer) OnTransactionCreated(f func(events.Tx) error) {
+	c.on(events.TxCreated, events.TxVersion, func(raw json.RawMessage) error {
+		tx := events.Tx{}
+		if err := json.Unmarshal(raw, &tx); err != nil {
+			return err
+		}
+		return f(tx)
+	})
+}
+
+func (c *Consumer) OnTransactionUnresolved(f func(events.UnresolvedTx) error) {
+	c.on(events.TxUnresolved, events.Version, func(raw json.RawMessage) error {
+		tx := events.UnresolvedTx{}
+		if err := json.Unmarshal(raw, &tx); err != nil {
+			return err
+		}
+		return f(tx)
+	})
+}
+
+func (c *Consumer) OnBlockCreated(f func(events.Block) error) {
+	c.on(events.BlockCreated, events.Version, func(raw json.RawMessage) error {
+		blk := events.Block{}
+		if err := json.Unmarshal(raw, &blk); err != nil {
+			return err
+		}
+		return f(blk)
+	})
+}
+
+// OnInvoice registers f for every invoice event type, which it's given
+// along with the Invoice
+func (c *Consumer) OnInvoice(f func(string, events.Invoice) error) {
+	for _, evType := range []string{events.InvoicePaidEvent, events.InvoiceUnderpaidEvent, events.InvoiceOverpaidEvent, events.InvoiceExpiredEvent} {
+		evType := evType
+		c.on(evType, events.InvoiceVersion, func(raw json.RawMessage) error {
+			inv := events.Invoice{}
+			if err := json.Unmarshal(raw, &inv); err != nil {
+				return err
+			}
+			return f(evType, inv)
+		})
+	}
+}
+
+func majorVersion(version string) (int, error) {
+	major, err := events.MajorVersion(version)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedVersion, err)
+	}
+	return major, nil
+}
+
+// Dispatch decodes the event, received on Channel now, and calls its
+// handler. Events without a handler are ignored.
+func (c *Consumer) Dispatch(payload []byte) error {
+	return c.dispatch(payload, c.Channel, time.Now())
+}
+
+// dispatch verifies that the event was signed for the channel it was
+// received on, around the time it was received at
+func (c *Consumer) dispatch(payload []byte, channel string, receivedAt time.Time) error {
+	if c.Verifier != nil {
+		if _, err := c.Verifier.VerifyAt(payload, channel, receivedAt); err != nil {
+			return err
+		}
+	}
+
+	ev := envelope{}
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return fmt.Errorf("Unable to decode event: %w", err)
+	}
+
+	h, ok := c.handlers[ev.Type]
+	if !ok {
+		return nil
+	}
+
+	major, err := majorVersion(ev.Version)
+	if err != nil {
+		return err
+	}
+	if major > h.MaxMajor {
+		return fmt.Errorf("%w: %s %s, up to %d.x is supported", ErrUnsupportedVersion, ev.Type, ev.Version, h.MaxMajor)
+	}
+
+	data := ev.Data
+	if ev.Encryption != nil {
+		if c.Decrypter == nil {
+			return fmt.Errorf("%w: %s event is encrypted, and there's no key to open it", events.ErrUndecryptable, ev.Type)
+		}
+		if data, err = c.Decrypter.Open(ev.Encryption, ev.Data); err != nil {
+			return err
+		}
+	}
+
+	return h.Handle(data)
+}
+
+// isPermanent tells whether the error will happen again on redelivery
+func isPermanent(err error) bool {
+	return errors.Is(err, ErrUnsupportedVersion) || errors.Is(err, events.ErrInvalidSignature) || errors.Is(err, events.ErrUndecryptable)
+}
+
+// HandleMsg dispatches the message. It's acked when handled, and left to
+// be redelivered otherwise, unless it's dead lettered.
+func (c *Consumer) HandleMsg(msg *stan.Msg) {
+	// The signatures are checked against when NATS Streaming stored the
+	// message, so that redelivering a backlog doesn't fail them
+	err := c.dispatch(msg.Data, msg.Subject, time.Unix(0, msg.Timestamp))
+	if err == nil {
+		c.ack(msg)
+		return
+	}
+
+	attempts := int(msg.RedeliveryCount) + 1
+	if attempts < c.MaxAttempts && !isPermanent(err) {
+		log.Printf("Failed to handle message %d (attempt %d of %d): %s", msg.Sequence, attempts, c.MaxAttempts, err)
+		return
+	}
+
+	if dlErr := c.deadLetter(msg, attempts, err); dlErr != nil {
+		// Redelivered, and dead lettered again next time
+		log.Printf("Unable to dead letter message %d: %s", msg.Sequence, dlErr)
+		return
+	}
+	log.Printf("Dead lettered message %d after %d attempts: %s", msg.Sequence, attempts, err)
+	c.ack(msg)
+}
+
+func (c *Consumer) ack(msg *stan.Msg) {
+	if err := msg.Ack(); err != nil {
+		log.Printf("Unable to ack message %d: %s", msg.Sequence, err)
+	}
+}
+
+func (c *Consumer) deadLetterChannel() string {
+	if c.DeadLetterChannel != "" {
+		return c.DeadLetterChannel
+	}
+	return c.Channel + ".dead"
+}
+
+func (c *Consumer) deadLetter(msg *stan.Msg, attempts int, err error) error {
+	dl := DeadLetter{
+		Channel:  msg.Subject,
+		Sequence: msg.Sequence,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Event:    json.RawMessage(msg.Data),
+	}
+	if !json.Valid(msg.Data) {
+		dl.Event, _ = json.Marshal(string(msg.Data))
+	}
+
+	payload, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	return c.DeadLetters.Publish(c.deadLetterChannel(), payload)
+}
+
+// Subscribe starts delivering the events to the handlers. The options are
+// added to the durable, manually acked subscription, e.g. where to start
+// from the first time.
+func (c *Consumer) Subscribe(opts ...stan.SubscriptionOption) (stan.Subscription, error) {
+	opts = append([]stan.SubscriptionOption{
+		stan.DurableName(c.Durable),
+		stan.SetManualAckMode(),
+		stan.AckWait(c.AckWait),
+	}, opts...)
+
+	return c.Conn.Subscribe(c.Channel, c.HandleMsg, opts...)
+}
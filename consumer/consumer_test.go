@@ -0,0 +1,153 @@
+package consumer
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-streaming-server/server"
+	stan "github.com/nats-io/stan.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestDispatch(t *testing.T) {
+	c := New(nil, "test")
+
+	var got events.Tx
+	c.OnTransactionCreated(func(tx events.Tx) error {
+		got = tx
+		return nil
+	})
+
+	payload, _ := json.Marshal(events.NewTXCreatedEvent(events.Tx{TXID: "abc", Fee: 10}))
+	assert.Nil(t, c.Dispatch(payload))
+	assert.Equal(t, "abc", got.TXID)
+	assert.Equal(t, uint64(10), got.Fee)
+
+	// Older versions and unhandled types are fine
+	assert.Nil(t, c.Dispatch([]byte(`{"type":"transaction.created","version":"1.0","data":{"txid":"old"}}`)))
+	assert.Equal(t, "old", got.TXID)
+	assert.Nil(t, c.Dispatch([]byte(`{"type":"something_else","version":"9.0","data":{}}`)))
+
+	err := c.Dispatch([]byte(`{"type":"transaction.created","version":"3.0","data":{}}`))
+	assert.True(t, errors.Is(err, ErrUnsupportedVersion))
+	err = c.Dispatch([]byte(`{"type":"transaction.created","version":"v2","data":{}}`))
+	assert.True(t, errors.Is(err, ErrUnsupportedVersion))
+	assert.True(t, isPermanent(err))
+
+	assert.Error(t, c.Dispatch([]byte(`not json`)))
+}
+
+func TestDispatchHandlerError(t *testing.T) {
+	c := New(nil, "test")
+	c.OnBlockCreated(func(events.Block) error {
+		return errors.New("nope")
+	})
+
+	payload, _ := json.Marshal(events.NewBlockCreatedEvent(events.Block{Height: 1}))
+	assert.EqualError(t, c.Dispatch(payload), "nope")
+}
+
+func TestDispatchVerified(t *testing.T) {
+	c := New(nil, "test")
+	c.Verifier = events.NewVerifier()
+	c.Verifier.AddHMACKey("key1", []byte("s3cret"))
+
+	handled := 0
+	c.OnBlockCreated(func(events.Block) error {
+		handled++
+		return nil
+	})
+
+	signer := &events.HMACSigner{KeyID: "key1", Key: []byte("s3cret")}
+	ev, err := signer.Sign(events.NewBlockCreatedEvent(events.Block{Height: 1}), events.DefaultChannel)
+	assert.Nil(t, err)
+	signed, _ := json.Marshal(ev)
+	assert.Nil(t, c.Dispatch(signed))
+
+	unsigned, _ := json.Marshal(events.NewBlockCreatedEvent(events.Block{Height: 1}))
+	err = c.Dispatch(unsigned)
+	assert.True(t, errors.Is(err, events.ErrInvalidSignature))
+	assert.True(t, isPermanent(err))
+	assert.Equal(t, 1, handled)
+
+	// Events replayed to another channel, or long after they were signed,
+	// are rejected
+	err = c.dispatch(signed, "other", time.Now())
+	assert.True(t, errors.Is(err, events.ErrInvalidSignature))
+	err = c.dispatch(signed, events.DefaultChannel, time.Now().Add(time.Hour))
+	assert.True(t, errors.Is(err, events.ErrInvalidSignature))
+	assert.Equal(t, 1, handled)
+}
+
+func TestDispatchEncrypted(t *testing.T) {
+	public, private, err := box.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	encrypter := &events.Encrypter{Recipients: []events.Recipient{{KeyID: "ops", PublicKey: public}}}
+	ev, err := encrypter.Encrypt(events.NewTXCreatedEvent(events.Tx{TXID: "abc"}))
+	assert.Nil(t, err)
+	payload, _ := json.Marshal(ev)
+
+	c := New(nil, "test")
+	var got events.Tx
+	c.OnTransactionCreated(func(tx events.Tx) error {
+		got = tx
+		return nil
+	})
+
+	err = c.Dispatch(payload)
+	assert.True(t, errors.Is(err, events.ErrUndecryptable))
+	assert.True(t, isPermanent(err))
+
+	c.Decrypter = &events.Decrypter{KeyID: "ops", PublicKey: public, PrivateKey: private}
+	assert.Nil(t, c.Dispatch(payload))
+	assert.Equal(t, "abc", got.TXID)
+}
+
+func TestSubscribeDeadLetters(t *testing.T) {
+	ss, err := server.RunServer("test-cluster")
+	assert.Nil(t, err)
+	defer ss.Shutdown()
+
+	sc, err := stan.Connect("test-cluster", "consumer-test", stan.NatsURL(ss.ClientURL()))
+	assert.Nil(t, err)
+	defer sc.Close()
+
+	attempts := make(chan struct{}, 10)
+	c := New(sc, "test")
+	c.MaxAttempts = 2
+	c.AckWait = time.Second
+	c.OnBlockCreated(func(events.Block) error {
+		attempts <- struct{}{}
+		return errors.New("nope")
+	})
+
+	dead := make(chan *stan.Msg, 1)
+	dsub, err := sc.Subscribe(events.DefaultChannel+".dead", func(msg *stan.Msg) { dead <- msg })
+	assert.Nil(t, err)
+	defer dsub.Close()
+
+	sub, err := c.Subscribe()
+	assert.Nil(t, err)
+	defer sub.Close()
+
+	payload, _ := json.Marshal(events.NewBlockCreatedEvent(events.Block{Height: 1}))
+	assert.Nil(t, sc.Publish(events.DefaultChannel, payload))
+
+	select {
+	case msg := <-dead:
+		dl := DeadLetter{}
+		assert.Nil(t, json.Unmarshal(msg.Data, &dl))
+		assert.Equal(t, 2, dl.Attempts)
+		assert.Equal(t, "nope", dl.Error)
+		assert.Equal(t, events.DefaultChannel, dl.Channel)
+		assert.JSONEq(t, string(payload), string(dl.Event))
+	case <-time.After(5 * time.Second):
+		t.Fatal("not dead lettered")
+	}
+	assert.Len(t, attempts, 2)
+}
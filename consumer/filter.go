@@ -0,0 +1,108 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	stan "github.com/nats-io/stan.go"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+// Filter selects events by type and by the fields of their payloads.
+// Empty criteria match everything.
+type Filter struct {
+	Types []string
+	// TXIDs match Txs, the blocks that include them and the invoices
+	// they paid. Encrypted events only match on their cleartext ID.
+	TXIDs []string
+	// Addresses match the destinations of Txs, and invoices
+	Addresses []string
+	// Height matches Txs and blocks. Any height when 0
+	Height int
+}
+
+// filterFields are the payload fields of every event type that Filter
+// looks at
+type filterFields struct {
+	TXID         string               `json:"txid"`
+	TxHashes     []string             `json:"tx_hashes"`
+	Txids        []string             `json:"txids"`
+	Address      string               `json:"address"`
+	Destinations []events.Destination `json:"destinations"`
+	Height       int                  `json:"height"`
+}
+
+func anyIn(values []string, set []string) bool {
+	for _, v := range values {
+		for _, s := range set {
+			if v == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Match tells whether the encoded event passes the Filter
+func (f Filter) Match(payload []byte) (bool, error) {
+	ev := envelope{}
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return false, fmt.Errorf("Unable to decode event: %w", err)
+	}
+
+	if len(f.Types) > 0 && !anyIn([]string{ev.Type}, f.Types) {
+		return false, nil
+	}
+	if len(f.TXIDs) == 0 && len(f.Addresses) == 0 && f.Height == 0 {
+		return true, nil
+	}
+
+	fields := filterFields{}
+	if ev.Encryption != nil {
+		// Only the cleartext ID can match
+		if len(f.Addresses) > 0 || f.Height != 0 {
+			return false, nil
+		}
+	} else if err := json.Unmarshal(ev.Data, &fields); err != nil {
+		return false, fmt.Errorf("Unable to decode %s event: %w", ev.Type, err)
+	}
+
+	if len(f.TXIDs) > 0 {
+		txids := append([]string{ev.ID, fields.TXID}, fields.TxHashes...)
+		if !anyIn(append(txids, fields.Txids...), f.TXIDs) {
+			return false, nil
+		}
+	}
+	if len(f.Addresses) > 0 {
+		addresses := []string{fields.Address}
+		for _, d := range fields.Destinations {
+			addresses = append(addresses, d.Address)
+		}
+		if !anyIn(addresses, f.Addresses) {
+			return false, nil
+		}
+	}
+	if f.Height != 0 && fields.Height != f.Height {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// ParseSince turns where to start a subscription from into its option. It
+// can be a channel sequence number, a duration back from now (e.g. 1h) or
+// an RFC 3339 timestamp.
+func ParseSince(since string) (stan.SubscriptionOption, error) {
+	if seq, err := strconv.ParseUint(since, 10, 64); err == nil {
+		return stan.StartAtSequence(seq), nil
+	}
+	if d, err := time.ParseDuration(since); err == nil {
+		return stan.StartAtTimeDelta(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return stan.StartAtTime(t), nil
+	}
+	return nil, fmt.Errorf("invalid --since %q: expected a sequence number, a duration or an RFC 3339 timestamp", since)
+}
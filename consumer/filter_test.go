@@ -0,0 +1,64 @@
+package consumer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+func TestFilterMatch(t *testing.T) {
+	tx, _ := json.Marshal(events.NewTXCreatedEvent(events.Tx{
+		TXID:         "tx1",
+		Height:       100,
+		Destinations: []events.Destination{{Address: "addr1"}},
+	}))
+	block, _ := json.Marshal(events.NewBlockCreatedEvent(events.Block{Height: 100, TxHashes: []string{"tx1", "tx2"}}))
+	inv, _ := json.Marshal(events.NewInvoiceEvent(events.InvoicePaidEvent, events.Invoice{Address: "addr2", Txids: []string{"tx3"}}))
+
+	cases := []struct {
+		Name     string
+		Filter   Filter
+		Expected []bool // tx, block, invoice
+	}{
+		{"empty", Filter{}, []bool{true, true, true}},
+		{"type", Filter{Types: []string{events.BlockCreated}}, []bool{false, true, false}},
+		{"txid", Filter{TXIDs: []string{"tx1"}}, []bool{true, true, false}},
+		{"invoice txid", Filter{TXIDs: []string{"tx3"}}, []bool{false, false, true}},
+		{"address", Filter{Addresses: []string{"addr1", "addr2"}}, []bool{true, false, true}},
+		{"height", Filter{Height: 100}, []bool{true, true, false}},
+		{"all", Filter{Types: []string{events.TxCreated}, TXIDs: []string{"tx1"}, Height: 101}, []bool{false, false, false}},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			for i, payload := range [][]byte{tx, block, inv} {
+				match, err := c.Filter.Match(payload)
+				assert.Nil(t, err)
+				assert.Equal(t, c.Expected[i], match, string(payload))
+			}
+		})
+	}
+
+	encrypted := []byte(`{"type":"transaction.created","version":"2.0","id":"tx1","data":"c2VhbGVk","encryption":{"alg":"nacl-box"}}`)
+	match, err := Filter{TXIDs: []string{"tx1"}}.Match(encrypted)
+	assert.Nil(t, err)
+	assert.True(t, match)
+	match, err = Filter{Addresses: []string{"addr1"}}.Match(encrypted)
+	assert.Nil(t, err)
+	assert.False(t, match)
+
+	_, err = Filter{}.Match([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestParseSince(t *testing.T) {
+	for _, since := range []string{"42", "1h30m", "2020-10-16T12:00:00Z"} {
+		opt, err := ParseSince(since)
+		assert.Nil(t, err, since)
+		assert.NotNil(t, opt)
+	}
+
+	_, err := ParseSince("yesterday")
+	assert.Error(t, err)
+}
@@ -0,0 +1,47 @@
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// atomicUnitsPerXMR is 10^xmrDecimals. One XMR is a trillion piconero
+	atomicUnitsPerXMR = 1000000000000
+	xmrDecimals       = 12
+)
+
+// FormatXMR renders an amount of atomic units as an exact decimal string
+// of XMR, always with 12 decimals (e.g. 1234567890123 => "1.234567890123")
+func FormatXMR(atomic uint64) string {
+	return fmt.Sprintf("%d.%012d", atomic/atomicUnitsPerXMR, atomic%atomicUnitsPerXMR)
+}
+
+// ParseXMR parses a decimal string of XMR into atomic units. It fails
+// rather than rounding when given more than 12 decimals, and on overflow.
+func ParseXMR(xmr string) (uint64, error) {
+	parts := strings.SplitN(xmr, ".", 2)
+	whole, fraction := parts[0], ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+	}
+
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf("Invalid XMR amount %q", xmr)
+	}
+	if len(fraction) > xmrDecimals {
+		return 0, fmt.Errorf("Invalid XMR amount %q: more than %d decimals", xmr, xmrDecimals)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	fraction += strings.Repeat("0", xmrDecimals-len(fraction))
+
+	// Parsing the digits as a whole lets strconv detect overflows
+	atomic, err := strconv.ParseUint(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid XMR amount %q: %s", xmr, err)
+	}
+	return atomic, nil
+}
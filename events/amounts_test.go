@@ -0,0 +1,76 @@
+package events
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatXMR(t *testing.T) {
+	cases := []struct {
+		Atomic   uint64
+		Expected string
+	}{
+		{0, "0.000000000000"},
+		{1, "0.000000000001"},
+		{999999999999, "0.999999999999"},
+		{1000000000000, "1.000000000000"},
+		{1234567890123, "1.234567890123"},
+		{2147483648, "0.002147483648"},                  // Above int32
+		{2200000000000, "2.200000000000"},               // ~2.1 XMR overflowed int32 atomic units
+		{9007199254740993, "9007.199254740993"},         // 2^53 + 1
+		{math.MaxUint64, "18446744.073709551615"},       // Max uint64
+		{18446744073709551614, "18446744.073709551614"}, // Max uint64 - 1
+		{math.MaxInt64 + 1, "9223372.036854775808"},     // Above int64
+		{math.MaxInt64, "9223372.036854775807"},         // Max int64
+		{1000000000000000000, "1000000.000000000000"},   // Round amount
+		{18000000000000000000, "18000000.000000000000"}, // Close to max uint64
+		{10, "0.000000000010"},
+	}
+	for _, c := range cases {
+		t.Run(c.Expected, func(t *testing.T) {
+			assert.Equal(t, c.Expected, FormatXMR(c.Atomic))
+
+			atomic, err := ParseXMR(c.Expected)
+			assert.Nil(t, err)
+			assert.Equal(t, c.Atomic, atomic)
+		})
+	}
+}
+
+func TestParseXMR(t *testing.T) {
+	cases := []struct {
+		XMR      string
+		Expected uint64
+	}{
+		{"1", 1000000000000},
+		{"1.5", 1500000000000},
+		{".5", 500000000000},
+		{"1.", 1000000000000},
+		{"0.000000000001", 1},
+	}
+	for _, c := range cases {
+		t.Run(c.XMR, func(t *testing.T) {
+			atomic, err := ParseXMR(c.XMR)
+			assert.Nil(t, err)
+			assert.Equal(t, c.Expected, atomic)
+		})
+	}
+
+	errorCases := []string{
+		"",
+		".",
+		"-1",
+		"1.0000000000001",       // More than 12 decimals
+		"18446744.073709551616", // Max uint64 + 1
+		"1,5",
+		"abc",
+	}
+	for _, c := range errorCases {
+		t.Run(c, func(t *testing.T) {
+			_, err := ParseXMR(c)
+			assert.Error(t, err)
+		})
+	}
+}
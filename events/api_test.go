@@ -0,0 +1,62 @@
+package events_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+func TestDecodeTxCreatedEvent(t *testing.T) {
+	payload := []byte(`{
+		"type": "transaction.created",
+		"version": "2.0",
+		"data": {
+			"txid": "tx1",
+			"destinations": [{"amount": 1000000000000, "amount_xmr": "1.000000000000", "address": "addr1"}],
+			"height": 100
+		}
+	}`)
+
+	tx := events.Tx{}
+	ev := events.Event{Data: &tx}
+	assert.Nil(t, json.Unmarshal(payload, &ev))
+
+	assert.Equal(t, events.TxCreated, ev.Type)
+	assert.Equal(t, events.TxVersion, ev.Version)
+	assert.Equal(t, "tx1", tx.TXID)
+	assert.Equal(t, uint64(1000000000000), tx.Destinations[0].Amount)
+}
+
+func TestEventConstructors(t *testing.T) {
+	cases := []struct {
+		Event   events.Event
+		Type    string
+		Version string
+	}{
+		{events.NewTXCreatedEvent(events.Tx{}), events.TxCreated, events.TxVersion},
+		{events.NewTxUnresolvedEvent(events.UnresolvedTx{}), events.TxUnresolved, events.Version},
+		{events.NewBlockCreatedEvent(events.Block{}), events.BlockCreated, events.Version},
+		{events.NewInvoiceEvent(events.InvoicePaidEvent, events.Invoice{}), events.InvoicePaidEvent, events.InvoiceVersion},
+	}
+	for _, c := range cases {
+		t.Run(c.Type, func(t *testing.T) {
+			assert.Equal(t, c.Type, c.Event.Type)
+			assert.Equal(t, c.Version, c.Event.Version)
+
+			raw, err := json.Marshal(c.Event)
+			assert.Nil(t, err)
+			decoded := events.Event{}
+			assert.Nil(t, json.Unmarshal(raw, &decoded))
+			assert.Equal(t, c.Type, decoded.Type)
+		})
+	}
+}
+
+func TestNewInvoiceEventXMRAmounts(t *testing.T) {
+	ev := events.NewInvoiceEvent(events.InvoiceUnderpaidEvent, events.Invoice{Amount: 1500000000000, Received: 1})
+	inv := ev.Data.(events.Invoice)
+	assert.Equal(t, "1.500000000000", inv.AmountXMR)
+	assert.Equal(t, "0.000000000001", inv.ReceivedXMR)
+}
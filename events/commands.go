@@ -0,0 +1,86 @@
+package events
+
+import "encoding/json"
+
+const (
+	// CreateAddressCommand creates a subaddress. It's served on
+	// "<CommandsSubject>.create_address".
+	CreateAddressCommand = "create_address"
+	AddressCreated       = "address.created"
+	// CreateInvoiceCommand registers an Invoice, when the publisher keeps
+	// a local state
+	CreateInvoiceCommand = "create_invoice"
+	InvoiceCreated       = "invoice.created"
+	CommandFailed        = "command.failed"
+	CommandVersion       = "1.0"
+	// CommandsSubject is the prefix of the NATS subjects the commands are
+	// served on, unless configured otherwise
+	CommandsSubject = "monero.cmd"
+)
+
+// Command is the envelope of the requests that the publisher serves
+// over NATS. It's versioned the same way Event is.
+type Command struct {
+	Type    string          `json:"type"`
+	Version string          `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// NewCommand builds a Command of the current version, e.g. with a
+// CreateAddressRequest
+func NewCommand(cmdType string, data interface{}) (Command, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Command{}, err
+	}
+	return Command{Type: cmdType, Version: CommandVersion, Data: raw}, nil
+}
+
+// CommandResponse is the reply to a Command. Data holds the payload of the
+// response Type, e.g. a CreatedAddress for address.created responses.
+// Error is only set on command.failed responses.
+type CommandResponse struct {
+	Type    string      `json:"type"`
+	Version string      `json:"version"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+func NewCommandResponse(respType string, data interface{}) CommandResponse {
+	return CommandResponse{
+		Type:    respType,
+		Version: CommandVersion,
+		Data:    data,
+	}
+}
+
+func NewCommandErrorResponse(err error) CommandResponse {
+	return CommandResponse{
+		Type:    CommandFailed,
+		Version: CommandVersion,
+		Error:   err.Error(),
+	}
+}
+
+type CreateAddressRequest struct {
+	AccountIndex int    `json:"account_index"`
+	Label        string `json:"label"`
+}
+
+type CreatedAddress struct {
+	Address      string `json:"address"`
+	AccountIndex int    `json:"account_index"`
+	AddressIndex int    `json:"address_index"`
+	Label        string `json:"label"`
+}
+
+// CreateInvoiceRequest is the data of create_invoice commands. A random ID
+// is generated when empty. The Invoice never expires when ExpiresIn is 0.
+type CreateInvoiceRequest struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	// Amount is in atomic units
+	Amount uint64 `json:"amount"`
+	// ExpiresIn is in seconds
+	ExpiresIn int64 `json:"expires_in"`
+}
@@ -0,0 +1,41 @@
+package events_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+func TestNewCommand(t *testing.T) {
+	cmd, err := events.NewCommand(events.CreateAddressCommand, events.CreateAddressRequest{AccountIndex: 1, Label: "order 1"})
+	assert.Nil(t, err)
+
+	payload, err := json.Marshal(cmd)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"type": "create_address", "version": "1.0", "data": {"account_index": 1, "label": "order 1"}}`, string(payload))
+}
+
+func TestDecodeCommandResponse(t *testing.T) {
+	created := events.CreatedAddress{}
+	resp := events.CommandResponse{Data: &created}
+	assert.Nil(t, json.Unmarshal([]byte(`{"type": "address.created", "version": "1.0", "data": {"address": "addr", "address_index": 3}}`), &resp))
+	assert.Equal(t, events.AddressCreated, resp.Type)
+	assert.Equal(t, "addr", created.Address)
+	assert.Equal(t, 3, created.AddressIndex)
+	assert.Empty(t, resp.Error)
+}
+
+func TestMajorVersion(t *testing.T) {
+	major, err := events.MajorVersion("2.1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, major)
+
+	major, err = events.MajorVersion("1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, major)
+
+	_, err = events.MajorVersion("v2")
+	assert.Error(t, err)
+}
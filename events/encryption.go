@@ -0,0 +1,288 @@
+package events
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	NaClBox = "nacl-box"
+	// Age is the type of the data keys sealed for age X25519 recipients
+	Age = "age"
+)
+
+// ErrUndecryptable is returned for the encrypted events that none of the
+// keys at hand can open
+var ErrUndecryptable = errors.New("unable to decrypt event")
+
+// Encryption tells how to open the sealed Data of an Event. The data is
+// sealed with a random key (NaCl secretbox), which is sealed in turn for
+// every recipient (NaCl anonymous box, or age).
+type Encryption struct {
+	Alg        string          `json:"alg"`
+	Nonce      string          `json:"nonce"`
+	Recipients []SealedDataKey `json:"recipients"`
+}
+
+// SealedDataKey is the data key, sealed for the recipient KeyID. Type is
+// Age for age recipients, and empty for NaCl box ones.
+type SealedDataKey struct {
+	KeyID string `json:"key_id"`
+	Type  string `json:"type,omitempty"`
+	Key   string `json:"key"`
+}
+
+// Recipient is a public key the events are encrypted for: either a NaCl box
+// PublicKey, or an age recipient
+type Recipient struct {
+	KeyID     string
+	PublicKey *[32]byte
+	Age       age.Recipient
+}
+
+func (r *Recipient) seal(key []byte) (SealedDataKey, error) {
+	if r.Age == nil {
+		sealed, err := box.SealAnonymous(nil, key, r.PublicKey, rand.Reader)
+		if err != nil {
+			return SealedDataKey{}, err
+		}
+		return SealedDataKey{KeyID: r.KeyID, Key: base64.StdEncoding.EncodeToString(sealed)}, nil
+	}
+
+	sealed := bytes.Buffer{}
+	w, err := age.Encrypt(&sealed, r.Age)
+	if err != nil {
+		return SealedDataKey{}, err
+	}
+	if _, err := w.Write(key); err != nil {
+		return SealedDataKey{}, err
+	}
+	if err := w.Close(); err != nil {
+		return SealedDataKey{}, err
+	}
+	return SealedDataKey{KeyID: r.KeyID, Type: Age, Key: base64.StdEncoding.EncodeToString(sealed.Bytes())}, nil
+}
+
+// Encrypter seals the Data of events for its Recipients
+type Encrypter struct {
+	Recipients []Recipient
+}
+
+// EventID is the ID kept in cleartext for the encrypted events: the txid,
+// block hash or invoice ID
+func EventID(data interface{}) string {
+	switch d := data.(type) {
+	case Tx:
+		return d.TXID
+	case UnresolvedTx:
+		return d.TXID
+	case Block:
+		return d.Hash
+	case Invoice:
+		return d.ID
+	}
+	return ""
+}
+
+func (e *Encrypter) Encrypt(ev Event) (Event, error) {
+	if len(e.Recipients) == 0 {
+		return ev, errors.New("no recipients to encrypt for")
+	}
+
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return ev, err
+	}
+
+	var key [32]byte
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+		return ev, err
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return ev, err
+	}
+
+	enc := &Encryption{Alg: NaClBox, Nonce: base64.StdEncoding.EncodeToString(nonce[:])}
+	for _, r := range e.Recipients {
+		sealed, err := r.seal(key[:])
+		if err != nil {
+			return ev, err
+		}
+		enc.Recipients = append(enc.Recipients, sealed)
+	}
+
+	ev.ID = EventID(ev.Data)
+	ev.Data = base64.StdEncoding.EncodeToString(secretbox.Seal(nil, data, &nonce, &key))
+	ev.Encryption = enc
+	return ev, nil
+}
+
+// Decrypter opens the events encrypted for its key pair, or for its age
+// identities
+type Decrypter struct {
+	KeyID         string
+	PublicKey     *[32]byte
+	PrivateKey    *[32]byte
+	AgeIdentities []age.Identity
+}
+
+// openKey opens the data key sealed for the Decrypter
+func (d *Decrypter) openKey(r SealedDataKey) ([]byte, bool) {
+	sealedKey, err := base64.StdEncoding.DecodeString(r.Key)
+	if err != nil {
+		return nil, false
+	}
+
+	switch r.Type {
+	case "":
+		if d.PrivateKey == nil {
+			return nil, false
+		}
+		return box.OpenAnonymous(nil, sealedKey, d.PublicKey, d.PrivateKey)
+	case Age:
+		if len(d.AgeIdentities) == 0 {
+			return nil, false
+		}
+		rd, err := age.Decrypt(bytes.NewReader(sealedKey), d.AgeIdentities...)
+		if err != nil {
+			return nil, false
+		}
+		key, err := ioutil.ReadAll(rd)
+		return key, err == nil
+	}
+	return nil, false
+}
+
+// Open returns the cleartext JSON of the sealed data of an event
+func (d *Decrypter) Open(enc *Encryption, data json.RawMessage) (json.RawMessage, error) {
+	if enc.Alg != NaClBox {
+		return nil, fmt.Errorf("%w: unknown algorithm %q", ErrUndecryptable, enc.Alg)
+	}
+
+	var sealedData string
+	if err := json.Unmarshal(data, &sealedData); err != nil {
+		return nil, fmt.Errorf("%w: sealed data isn't a string", ErrUndecryptable)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(sealedData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUndecryptable, err)
+	}
+	var nonce [24]byte
+	rawNonce, err := base64.StdEncoding.DecodeString(enc.Nonce)
+	if err != nil || len(rawNonce) != len(nonce) {
+		return nil, fmt.Errorf("%w: invalid nonce", ErrUndecryptable)
+	}
+	copy(nonce[:], rawNonce)
+
+	for _, r := range enc.Recipients {
+		if r.KeyID != d.KeyID {
+			continue
+		}
+		key, ok := d.openKey(r)
+		if !ok || len(key) != 32 {
+			continue
+		}
+
+		var dataKey [32]byte
+		copy(dataKey[:], key)
+		if opened, ok := secretbox.Open(nil, ciphertext, &nonce, &dataKey); ok {
+			return opened, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: not encrypted for key %q", ErrUndecryptable, d.KeyID)
+}
+
+// Decrypt returns the encoded event with its data opened, or unchanged
+// if it isn't encrypted
+func (d *Decrypter) Decrypt(payload []byte) ([]byte, error) {
+	data := json.RawMessage{}
+	ev := Event{Data: &data}
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return nil, fmt.Errorf("Unable to decode event: %w", err)
+	}
+	if ev.Encryption == nil {
+		return payload, nil
+	}
+
+	opened, err := d.Open(ev.Encryption, data)
+	if err != nil {
+		return nil, err
+	}
+	ev.Data = opened
+	ev.Encryption = nil
+	// The signature doesn't cover the opened data
+	ev.Signature = nil
+	return json.Marshal(ev)
+}
+
+func readKey32(path string) (*[32]byte, error) {
+	raw, err := ReadKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("key file %s holds a %d bytes key instead of 32", path, len(raw))
+	}
+	key := [32]byte{}
+	copy(key[:], raw)
+	return &key, nil
+}
+
+// LoadRecipient reads the base64 NaCl box public key of a recipient, or its
+// age recipient (age1...)
+func LoadRecipient(keyID, publicKeyFile string) (Recipient, error) {
+	raw, err := ioutil.ReadFile(publicKeyFile)
+	if err != nil {
+		return Recipient{}, err
+	}
+	if text := strings.TrimSpace(string(raw)); strings.HasPrefix(text, "age1") {
+		recipient, err := age.ParseX25519Recipient(text)
+		if err != nil {
+			return Recipient{}, fmt.Errorf("key file %s: %s", publicKeyFile, err)
+		}
+		return Recipient{KeyID: keyID, Age: recipient}, nil
+	}
+
+	key, err := readKey32(publicKeyFile)
+	if err != nil {
+		return Recipient{}, err
+	}
+	return Recipient{KeyID: keyID, PublicKey: key}, nil
+}
+
+// LoadDecrypter reads the base64 NaCl box private key, and derives its
+// public key, or the age identities (AGE-SECRET-KEY-1...) of the file
+func LoadDecrypter(keyID, privateKeyFile string) (*Decrypter, error) {
+	raw, err := ioutil.ReadFile(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(raw, []byte("AGE-SECRET-KEY-")) {
+		identities, err := age.ParseIdentities(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("key file %s: %s", privateKeyFile, err)
+		}
+		return &Decrypter{KeyID: keyID, AgeIdentities: identities}, nil
+	}
+
+	private, err := readKey32(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	public := [32]byte{}
+	curve25519.ScalarBaseMult(&public, private)
+	return &Decrypter{KeyID: keyID, PublicKey: &public, PrivateKey: private}, nil
+}
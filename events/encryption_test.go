@@ -0,0 +1,118 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func newTestDecrypter(t *testing.T, keyID string) *Decrypter {
+	public, private, err := box.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	return &Decrypter{KeyID: keyID, PublicKey: public, PrivateKey: private}
+}
+
+func TestEncryptAndDecrypt(t *testing.T) {
+	ops := newTestDecrypter(t, "ops")
+	accounting := newTestDecrypter(t, "accounting")
+	outsider := newTestDecrypter(t, "outsider")
+
+	encrypter := &Encrypter{Recipients: []Recipient{
+		{KeyID: "ops", PublicKey: ops.PublicKey},
+		{KeyID: "accounting", PublicKey: accounting.PublicKey},
+	}}
+	ev, err := encrypter.Encrypt(NewTXCreatedEvent(Tx{TXID: "abc", Destinations: []Destination{{Address: "addr1", Amount: 5}}}))
+	assert.Nil(t, err)
+
+	payload, err := json.Marshal(ev)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(payload), "addr1")
+
+	cleartext := struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}{}
+	assert.Nil(t, json.Unmarshal(payload, &cleartext))
+	assert.Equal(t, TxCreated, cleartext.Type)
+	assert.Equal(t, "abc", cleartext.ID)
+
+	for _, d := range []*Decrypter{ops, accounting} {
+		decrypted, err := d.Decrypt(payload)
+		assert.Nil(t, err)
+
+		tx := Tx{}
+		assert.Nil(t, json.Unmarshal(decrypted, &Event{Data: &tx}))
+		assert.Equal(t, "addr1", tx.Destinations[0].Address)
+		assert.NotContains(t, string(decrypted), "encryption")
+	}
+
+	_, err = outsider.Decrypt(payload)
+	assert.True(t, errors.Is(err, ErrUndecryptable))
+
+	// An impostor using a known key ID can't open it either
+	outsider.KeyID = "ops"
+	_, err = outsider.Decrypt(payload)
+	assert.True(t, errors.Is(err, ErrUndecryptable))
+}
+
+func TestEncryptForAgeRecipients(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	assert.Nil(t, err)
+	other, err := age.GenerateX25519Identity()
+	assert.Nil(t, err)
+	ops := newTestDecrypter(t, "ops")
+
+	// age and NaCl box recipients can be mixed
+	encrypter := &Encrypter{Recipients: []Recipient{
+		{KeyID: "ops", PublicKey: ops.PublicKey},
+		{KeyID: "accounting", Age: identity.Recipient()},
+	}}
+	ev, err := encrypter.Encrypt(NewTXCreatedEvent(Tx{TXID: "abc", Destinations: []Destination{{Address: "addr1", Amount: 5}}}))
+	assert.Nil(t, err)
+	assert.Equal(t, "", ev.Encryption.Recipients[0].Type)
+	assert.Equal(t, Age, ev.Encryption.Recipients[1].Type)
+	payload, _ := json.Marshal(ev)
+
+	for _, d := range []*Decrypter{ops, {KeyID: "accounting", AgeIdentities: []age.Identity{identity}}} {
+		decrypted, err := d.Decrypt(payload)
+		assert.Nil(t, err)
+		assert.Contains(t, string(decrypted), "addr1")
+	}
+
+	_, err = (&Decrypter{KeyID: "accounting", AgeIdentities: []age.Identity{other}}).Decrypt(payload)
+	assert.True(t, errors.Is(err, ErrUndecryptable))
+}
+
+func TestDecryptCleartext(t *testing.T) {
+	payload, _ := json.Marshal(NewBlockCreatedEvent(Block{Hash: "abc"}))
+	decrypted, err := newTestDecrypter(t, "ops").Decrypt(payload)
+	assert.Nil(t, err)
+	assert.Equal(t, payload, decrypted)
+}
+
+func TestEncryptThenSign(t *testing.T) {
+	d := newTestDecrypter(t, "ops")
+	ev, err := (&Encrypter{Recipients: []Recipient{{KeyID: "ops", PublicKey: d.PublicKey}}}).Encrypt(NewBlockCreatedEvent(Block{Hash: "abc"}))
+	assert.Nil(t, err)
+	ev, err = (&HMACSigner{KeyID: "key1", Key: []byte("s3cret")}).Sign(ev, DefaultChannel)
+	assert.Nil(t, err)
+	payload, _ := json.Marshal(ev)
+
+	verifier := NewVerifier()
+	verifier.AddHMACKey("key1", []byte("s3cret"))
+	_, err = verifier.Verify(payload, DefaultChannel)
+	assert.Nil(t, err)
+
+	// The cleartext ID is covered by the signature
+	var tampered map[string]interface{}
+	json.Unmarshal(payload, &tampered)
+	tampered["id"] = "def"
+	tamperedPayload, _ := json.Marshal(tampered)
+	_, err = verifier.Verify(tamperedPayload, DefaultChannel)
+	assert.True(t, errors.Is(err, ErrInvalidSignature))
+}
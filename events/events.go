@@ -0,0 +1,89 @@
+// Package events defines the events published by the publisher: the
+// envelope, the payloads of each event type, and their constructors. It
+// also defines the commands the publisher serves, and their responses.
+package events
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	TxCreated             = "transaction.created"
+	TxUnresolved          = "transaction.unresolved"
+	BlockCreated          = "block.created"
+	InvoicePaidEvent      = "invoice.paid"
+	InvoiceUnderpaidEvent = "invoice.underpaid"
+	InvoiceOverpaidEvent  = "invoice.overpaid"
+	InvoiceExpiredEvent   = "invoice.expired"
+	Version               = "1.0"
+	TxVersion             = "2.0" // 2.0: amounts are uint64, with their decimal XMR strings
+	InvoiceVersion        = "2.0" // 2.0: amounts come with their decimal XMR strings
+	// DefaultChannel is the NATS channel events are published to, unless
+	// configured otherwise
+	DefaultChannel = "monero"
+)
+
+// Event is the envelope of every published event. Data holds the payload
+// of the event Type, e.g. a Tx for transaction.created events. Signature
+// is only set on signed events.
+//
+// Encrypted events hold their sealed Data instead, along with the
+// Encryption to open it, and the ID of what they're about in cleartext:
+// the txid, block hash or invoice ID.
+type Event struct {
+	Type       string      `json:"type"`
+	Version    string      `json:"version"`
+	ID         string      `json:"id,omitempty"`
+	Data       interface{} `json:"data"`
+	Encryption *Encryption `json:"encryption,omitempty"`
+	Signature  *Signature  `json:"signature,omitempty"`
+}
+
+func NewTXCreatedEvent(tx Tx) Event {
+	return Event{
+		Type:    TxCreated,
+		Version: TxVersion,
+		Data:    tx,
+	}
+}
+
+func NewTxUnresolvedEvent(tx UnresolvedTx) Event {
+	return Event{
+		Type:    TxUnresolved,
+		Version: Version,
+		Data:    tx,
+	}
+}
+
+func NewBlockCreatedEvent(b Block) Event {
+	return Event{
+		Type:    BlockCreated,
+		Version: Version,
+		Data:    b,
+	}
+}
+
+// NewInvoiceEvent sets the XMR strings of the amounts, which are not kept
+// in the local state
+func NewInvoiceEvent(evType string, inv Invoice) Event {
+	inv.AmountXMR = FormatXMR(inv.Amount)
+	inv.ReceivedXMR = FormatXMR(inv.Received)
+	return Event{
+		Type:    evType,
+		Version: InvoiceVersion,
+		Data:    inv,
+	}
+}
+
+// MajorVersion parses the major version of an event or command version,
+// e.g. 2 for "2.0". Versions are compatible within a major version, since
+// fields are only added to the payloads.
+func MajorVersion(version string) (int, error) {
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid version %q", version)
+	}
+	return major, nil
+}
@@ -0,0 +1,141 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	InvoicePending   = "pending"
+	InvoiceUnderpaid = "underpaid"
+	InvoicePaid      = "paid"
+	InvoiceOverpaid  = "overpaid"
+	InvoiceExpired   = "expired"
+)
+
+// Invoice is a payment we expect to receive on a given (sub)address
+type Invoice struct {
+	ID          string   `json:"id"`
+	Address     string   `json:"address"`
+	Amount      uint64   `json:"amount"`
+	AmountXMR   string   `json:"amount_xmr,omitempty"`
+	Received    uint64   `json:"received"`
+	ReceivedXMR string   `json:"received_xmr,omitempty"`
+	Status      string   `json:"status"`
+	CreatedAt   int64    `json:"created_at"`
+	ExpiresAt   int64    `json:"expires_at"`
+	Txids       []string `json:"txids"`
+}
+
+// IsOpen tells whether the Invoice still expects payments. Paid and expired
+// Invoices are closed, and their address can be used by a new Invoice.
+func (inv *Invoice) IsOpen() bool {
+	return inv.Status == InvoicePending || inv.Status == InvoiceUnderpaid
+}
+
+// IsExpired tells whether the Invoice should be expired at the given time.
+// Fully paid Invoices never expire.
+func (inv *Invoice) IsExpired(now time.Time) bool {
+	if inv.ExpiresAt == 0 {
+		return false
+	}
+
+	if inv.Status != InvoicePending && inv.Status != InvoiceUnderpaid {
+		return false
+	}
+
+	return now.Unix() >= inv.ExpiresAt
+}
+
+func (inv *Invoice) hasTxid(txid string) bool {
+	for _, t := range inv.Txids {
+		if t == txid {
+			return true
+		}
+	}
+	return false
+}
+
+func (inv *Invoice) updateStatus() {
+	switch {
+	case inv.Received == 0:
+		inv.Status = InvoicePending
+	case inv.Received < inv.Amount:
+		inv.Status = InvoiceUnderpaid
+	case inv.Received == inv.Amount:
+		inv.Status = InvoicePaid
+	default:
+		inv.Status = InvoiceOverpaid
+	}
+}
+
+// ApplyTx adds the amounts the Tx sends to the Invoice's address. It
+// returns true if the Invoice changed. A Tx is only ever counted once.
+func (inv *Invoice) ApplyTx(tx Tx) bool {
+	if !inv.IsOpen() || inv.hasTxid(tx.TXID) {
+		return false
+	}
+
+	received := uint64(0)
+	for _, d := range tx.Destinations {
+		if d.Address == inv.Address {
+			received += d.Amount
+		}
+	}
+	if received == 0 {
+		return false
+	}
+
+	inv.Received += received
+	inv.Txids = append(inv.Txids, tx.TXID)
+	inv.updateStatus()
+	return true
+}
+
+func NewInvoice(id, address string, amount uint64, now time.Time, expiresIn time.Duration) (*Invoice, error) {
+	if address == "" {
+		return nil, fmt.Errorf("invoice requires an address")
+	}
+	if amount == 0 {
+		return nil, fmt.Errorf("invoice amount must be positive, got %d", amount)
+	}
+
+	if id == "" {
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		id = hex.EncodeToString(buf)
+	}
+
+	inv := &Invoice{
+		ID:        id,
+		Address:   address,
+		Amount:    amount,
+		Status:    InvoicePending,
+		CreatedAt: now.Unix(),
+		Txids:     []string{},
+	}
+	if expiresIn > 0 {
+		inv.ExpiresAt = now.Add(expiresIn).Unix()
+	}
+
+	return inv, nil
+}
+
+// InvoiceEventType is the type of the event published when the Invoice
+// gets to its current status
+func InvoiceEventType(inv Invoice) string {
+	switch inv.Status {
+	case InvoicePaid:
+		return InvoicePaidEvent
+	case InvoiceOverpaid:
+		return InvoiceOverpaidEvent
+	case InvoiceExpired:
+		return InvoiceExpiredEvent
+	default:
+		return InvoiceUnderpaidEvent
+	}
+}
@@ -0,0 +1,82 @@
+package events
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInvoice(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	inv, err := NewInvoice("", "addr1", 5, now, time.Minute)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, inv.ID)
+	assert.Equal(t, InvoicePending, inv.Status)
+	assert.Equal(t, int64(1060), inv.ExpiresAt)
+
+	inv, err = NewInvoice("order-1", "addr1", 5, now, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "order-1", inv.ID)
+	assert.Zero(t, inv.ExpiresAt)
+
+	_, err = NewInvoice("", "", 5, now, 0)
+	assert.Error(t, err)
+
+	_, err = NewInvoice("", "addr1", 0, now, 0)
+	assert.Error(t, err)
+}
+
+func TestInvoiceApplyTx(t *testing.T) {
+	cases := []struct {
+		Description    string
+		Amounts        []uint64
+		ExpectedStatus string
+	}{
+		{"Paid in one Tx", []uint64{10}, InvoicePaid},
+		{"Paid in several Txs", []uint64{4, 6}, InvoicePaid},
+		{"Underpaid", []uint64{4}, InvoiceUnderpaid},
+		{"Overpaid", []uint64{4, 7}, InvoiceOverpaid},
+	}
+	for _, c := range cases {
+		t.Run(c.Description, func(t *testing.T) {
+			inv, err := NewInvoice("", "addr1", 10, time.Unix(1000, 0), 0)
+			assert.Nil(t, err)
+
+			for i, amount := range c.Amounts {
+				tx := Tx{
+					TXID: fmt.Sprintf("tx%d", i),
+					Destinations: []Destination{
+						{Address: "addr1", Amount: amount},
+						{Address: "other addr", Amount: 100},
+					},
+				}
+				assert.True(t, inv.ApplyTx(tx))
+			}
+
+			assert.Equal(t, c.ExpectedStatus, inv.Status)
+			assert.Equal(t, len(c.Amounts), len(inv.Txids))
+		})
+	}
+
+	t.Run("Same Tx is only counted once", func(t *testing.T) {
+		inv, err := NewInvoice("", "addr1", 10, time.Unix(1000, 0), 0)
+		assert.Nil(t, err)
+
+		tx := Tx{TXID: "tx", Destinations: []Destination{{Address: "addr1", Amount: 4}}}
+		assert.True(t, inv.ApplyTx(tx))
+		assert.False(t, inv.ApplyTx(tx))
+		assert.Equal(t, uint64(4), inv.Received)
+	})
+
+	t.Run("Tx to another address", func(t *testing.T) {
+		inv, err := NewInvoice("", "addr1", 10, time.Unix(1000, 0), 0)
+		assert.Nil(t, err)
+
+		tx := Tx{TXID: "tx", Destinations: []Destination{{Address: "addr2", Amount: 4}}}
+		assert.False(t, inv.ApplyTx(tx))
+		assert.Equal(t, InvoicePending, inv.Status)
+	})
+}
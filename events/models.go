@@ -0,0 +1,50 @@
+package events
+
+// Destination is an amount received by one of the wallet's addresses
+type Destination struct {
+	Amount       uint64 `json:"amount"`
+	AmountXMR    string `json:"amount_xmr"`
+	AmountAtomic string `json:"amount_atomic,omitempty"`
+	Address      string `json:"address"`
+	AccountIndex int    `json:"account_index"`
+	SubaddrIndex int    `json:"subaddr_index"`
+	Label        string `json:"label"`
+}
+
+// Tx is the payload of transaction.created events
+type Tx struct {
+	TXID                string        `json:"txid"`
+	Wallet              string        `json:"wallet,omitempty"`
+	Destinations        []Destination `json:"destinations"`
+	Height              int           `json:"height"`
+	Timestamp           int           `json:"timestamp"`
+	UnlockTime          int           `json:"unlock_time"`
+	Confirmations       int           `json:"confirmations"`
+	PaymentID           string        `json:"payment_id,omitempty"`
+	IntegratedPaymentID string        `json:"integrated_payment_id,omitempty"`
+	Fee                 uint64        `json:"fee"`
+	FeeXMR              string        `json:"fee_xmr"`
+	Note                string        `json:"note,omitempty"`
+	Locked              bool          `json:"locked"`
+	DoubleSpendSeen     bool          `json:"double_spend_seen"`
+}
+
+// Block is the payload of block.created events
+type Block struct {
+	Hash       string   `json:"hash"`
+	Height     int      `json:"height"`
+	Timestamp  int      `json:"timestamp"`
+	PrevHashes []string `json:"prev_hashes"`
+	TxHashes   []string `json:"tx_hashes"`
+	// CatchUp is set on the blocks published late, because the
+	// notification for them was missed
+	CatchUp bool `json:"catch_up,omitempty"`
+}
+
+// UnresolvedTx describes a Tx that never became visible through the wallet
+type UnresolvedTx struct {
+	TXID     string `json:"txid"`
+	Reason   string `json:"reason"`
+	Attempts int    `json:"attempts"`
+	WaitedMs int64  `json:"waited_ms"`
+}
@@ -0,0 +1,283 @@
+package events
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const (
+	HMACSHA256 = "hmac-sha256"
+	Ed25519    = "ed25519"
+
+	// DefaultMaxSignatureAge is how far from the time it's verified at a
+	// signature may have been issued
+	DefaultMaxSignatureAge = 5 * time.Minute
+)
+
+// ErrInvalidSignature is returned for the events that are unsigned, or
+// whose signature doesn't match
+var ErrInvalidSignature = errors.New("invalid event signature")
+
+// Signature authenticates an Event. Value is the base64 signature of
+// SignedBytes, by the key KeyID. The signature also covers the Channel the
+// event was published to, and when it was issued, so that it can't be
+// replayed to another channel, or later on.
+type Signature struct {
+	Alg   string `json:"alg"`
+	KeyID string `json:"key_id,omitempty"`
+	// Channel is the NATS channel the event was published to
+	Channel string `json:"channel"`
+	// IssuedAt is when the event was signed, as a Unix timestamp
+	IssuedAt int64  `json:"issued_at"`
+	Value    string `json:"value"`
+}
+
+// signedEnvelope is what is signed: the envelope without its signature,
+// along with the channel and the time of the signature
+type signedEnvelope struct {
+	Type       string          `json:"type"`
+	Version    string          `json:"version"`
+	ID         string          `json:"id,omitempty"`
+	Data       json.RawMessage `json:"data"`
+	Encryption *Encryption     `json:"encryption,omitempty"`
+	Channel    string          `json:"channel"`
+	IssuedAt   int64           `json:"issued_at"`
+}
+
+// SignedBytes are the bytes of the event its signature covers: the
+// compact JSON of its envelope without the signature, with the channel
+// and issue time of the signature
+func SignedBytes(ev Event) ([]byte, error) {
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	env := signedEnvelope{Type: ev.Type, Version: ev.Version, ID: ev.ID, Data: data, Encryption: ev.Encryption}
+	if ev.Signature != nil {
+		env.Channel = ev.Signature.Channel
+		env.IssuedAt = ev.Signature.IssuedAt
+	}
+	return json.Marshal(env)
+}
+
+// Signer signs the events before they are published to the channel
+type Signer interface {
+	Sign(ev Event, channel string) (Event, error)
+}
+
+func nowOrDefault(now func() time.Time) time.Time {
+	if now == nil {
+		return time.Now()
+	}
+	return now()
+}
+
+type HMACSigner struct {
+	KeyID string
+	Key   []byte
+	// Now is the clock of the signatures. time.Now when nil.
+	Now func() time.Time
+}
+
+func (s *HMACSigner) Sign(ev Event, channel string) (Event, error) {
+	ev.Signature = &Signature{Alg: HMACSHA256, KeyID: s.KeyID, Channel: channel, IssuedAt: nowOrDefault(s.Now).Unix()}
+	signed, err := SignedBytes(ev)
+	if err != nil {
+		return ev, err
+	}
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write(signed)
+
+	ev.Signature.Value = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return ev, nil
+}
+
+type Ed25519Signer struct {
+	KeyID string
+	Key   ed25519.PrivateKey
+	// Now is the clock of the signatures. time.Now when nil.
+	Now func() time.Time
+}
+
+func (s *Ed25519Signer) Sign(ev Event, channel string) (Event, error) {
+	ev.Signature = &Signature{Alg: Ed25519, KeyID: s.KeyID, Channel: channel, IssuedAt: nowOrDefault(s.Now).Unix()}
+	signed, err := SignedBytes(ev)
+	if err != nil {
+		return ev, err
+	}
+
+	ev.Signature.Value = base64.StdEncoding.EncodeToString(ed25519.Sign(s.Key, signed))
+	return ev, nil
+}
+
+// ReadKeyFile reads a base64 encoded key
+func ReadKeyFile(path string) ([]byte, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, fmt.Errorf("key file %s isn't base64: %s", path, err)
+	}
+	return key, nil
+}
+
+// Ed25519PrivateKey accepts both private keys and their seeds
+func Ed25519PrivateKey(key []byte) (ed25519.PrivateKey, error) {
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	}
+	return nil, fmt.Errorf("ed25519 private keys are %d or %d bytes long, not %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(key))
+}
+
+// LoadSigner builds the Signer of the algorithm, with the key of the file
+func LoadSigner(alg, keyID, keyFile string) (Signer, error) {
+	key, err := ReadKeyFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	switch alg {
+	case HMACSHA256:
+		return &HMACSigner{KeyID: keyID, Key: key}, nil
+	case Ed25519:
+		private, err := Ed25519PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return &Ed25519Signer{KeyID: keyID, Key: private}, nil
+	}
+	return nil, fmt.Errorf("unknown signing algorithm %q", alg)
+}
+
+// Verifier checks the signatures of the events against its keys, which
+// are looked up by algorithm and key ID
+type Verifier struct {
+	// MaxAge is how far from the time they're verified at signatures may
+	// have been issued. Not checked when 0.
+	MaxAge time.Duration
+
+	hmacKeys    map[string][]byte
+	ed25519Keys map[string]ed25519.PublicKey
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{
+		MaxAge:      DefaultMaxSignatureAge,
+		hmacKeys:    map[string][]byte{},
+		ed25519Keys: map[string]ed25519.PublicKey{},
+	}
+}
+
+func (v *Verifier) AddHMACKey(keyID string, key []byte) {
+	v.hmacKeys[keyID] = key
+}
+
+func (v *Verifier) AddEd25519Key(keyID string, key ed25519.PublicKey) {
+	v.ed25519Keys[keyID] = key
+}
+
+// AddKeyFile adds the key of the file. Ed25519 files can hold either the
+// public key, or the private key it's derived from.
+func (v *Verifier) AddKeyFile(alg, keyID, keyFile string) error {
+	key, err := ReadKeyFile(keyFile)
+	if err != nil {
+		return err
+	}
+
+	switch alg {
+	case HMACSHA256:
+		v.AddHMACKey(keyID, key)
+	case Ed25519:
+		if len(key) == ed25519.PublicKeySize {
+			v.AddEd25519Key(keyID, ed25519.PublicKey(key))
+			return nil
+		}
+		private, err := Ed25519PrivateKey(key)
+		if err != nil {
+			return err
+		}
+		v.AddEd25519Key(keyID, private.Public().(ed25519.PublicKey))
+	default:
+		return fmt.Errorf("unknown signing algorithm %q", alg)
+	}
+	return nil
+}
+
+// Verify checks the signature of the encoded event received on the
+// channel now, and returns the event, with its data left encoded
+func (v *Verifier) Verify(payload []byte, channel string) (Event, error) {
+	return v.VerifyAt(payload, channel, time.Now())
+}
+
+// VerifyAt checks the signature of the encoded event received on the
+// channel at the given time, e.g. when NATS Streaming stored it. Any
+// channel is accepted when it's empty.
+func (v *Verifier) VerifyAt(payload []byte, channel string, at time.Time) (Event, error) {
+	data := json.RawMessage{}
+	ev := Event{Data: &data}
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return ev, fmt.Errorf("Unable to decode event: %w", err)
+	}
+	ev.Data = data
+
+	sig := ev.Signature
+	if sig == nil {
+		return ev, fmt.Errorf("%w: %s event is unsigned", ErrInvalidSignature, ev.Type)
+	}
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return ev, fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	signed, err := SignedBytes(ev)
+	if err != nil {
+		return ev, err
+	}
+
+	switch sig.Alg {
+	case HMACSHA256:
+		key, ok := v.hmacKeys[sig.KeyID]
+		if !ok {
+			return ev, fmt.Errorf("%w: unknown %s key %q", ErrInvalidSignature, sig.Alg, sig.KeyID)
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		if !hmac.Equal(value, mac.Sum(nil)) {
+			return ev, fmt.Errorf("%w: %s event doesn't match its signature", ErrInvalidSignature, ev.Type)
+		}
+	case Ed25519:
+		key, ok := v.ed25519Keys[sig.KeyID]
+		if !ok {
+			return ev, fmt.Errorf("%w: unknown %s key %q", ErrInvalidSignature, sig.Alg, sig.KeyID)
+		}
+		if !ed25519.Verify(key, signed, value) {
+			return ev, fmt.Errorf("%w: %s event doesn't match its signature", ErrInvalidSignature, ev.Type)
+		}
+	default:
+		return ev, fmt.Errorf("%w: unknown algorithm %q", ErrInvalidSignature, sig.Alg)
+	}
+
+	if channel != "" && sig.Channel != channel {
+		return ev, fmt.Errorf("%w: %s event was signed for channel %q, not %q", ErrInvalidSignature, ev.Type, sig.Channel, channel)
+	}
+	if v.MaxAge > 0 {
+		age := at.Sub(time.Unix(sig.IssuedAt, 0))
+		if age > v.MaxAge || age < -v.MaxAge {
+			return ev, fmt.Errorf("%w: %s event was signed at %s, more than %s from %s", ErrInvalidSignature, ev.Type, time.Unix(sig.IssuedAt, 0).UTC().Format(time.RFC3339), v.MaxAge, at.UTC().Format(time.RFC3339))
+		}
+	}
+	return ev, nil
+}
@@ -0,0 +1,127 @@
+package events
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKeyFile(t *testing.T, dir, name string, key []byte) string {
+	path := filepath.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600))
+	return path
+}
+
+func TestSignAndVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events-signing")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	private := ed25519.NewKeyFromSeed(seed)
+	cases := []struct {
+		Alg       string
+		SignerKey string
+		VerifyKey string
+		WrongKey  string
+	}{
+		{HMACSHA256, writeKeyFile(t, dir, "hmac", []byte("s3cret")), writeKeyFile(t, dir, "hmac", []byte("s3cret")), writeKeyFile(t, dir, "hmac2", []byte("other"))},
+		{Ed25519, writeKeyFile(t, dir, "seed", seed), writeKeyFile(t, dir, "pub", private.Public().(ed25519.PublicKey)), writeKeyFile(t, dir, "pub2", make([]byte, ed25519.PublicKeySize))},
+	}
+	for _, c := range cases {
+		t.Run(c.Alg, func(t *testing.T) {
+			signer, err := LoadSigner(c.Alg, "key1", c.SignerKey)
+			assert.Nil(t, err)
+			ev, err := signer.Sign(NewTXCreatedEvent(Tx{TXID: "abc", Fee: 10, Note: "<&>"}), DefaultChannel)
+			assert.Nil(t, err)
+			assert.Equal(t, c.Alg, ev.Signature.Alg)
+			assert.Equal(t, "key1", ev.Signature.KeyID)
+			assert.Equal(t, DefaultChannel, ev.Signature.Channel)
+
+			payload, err := json.Marshal(ev)
+			assert.Nil(t, err)
+
+			verifier := NewVerifier()
+			assert.Nil(t, verifier.AddKeyFile(c.Alg, "key1", c.VerifyKey))
+			verified, err := verifier.Verify(payload, DefaultChannel)
+			assert.Nil(t, err)
+			assert.Equal(t, TxCreated, verified.Type)
+
+			// Reformatting doesn't change what is signed
+			indented := bytes.Buffer{}
+			assert.Nil(t, json.Indent(&indented, payload, "", "  "))
+			_, err = verifier.Verify(indented.Bytes(), DefaultChannel)
+			assert.Nil(t, err)
+
+			tampered := bytes.Replace(payload, []byte(`"fee":10`), []byte(`"fee":11`), 1)
+			_, err = verifier.Verify(tampered, DefaultChannel)
+			assert.True(t, errors.Is(err, ErrInvalidSignature))
+
+			wrong := NewVerifier()
+			assert.Nil(t, wrong.AddKeyFile(c.Alg, "key1", c.WrongKey))
+			_, err = wrong.Verify(payload, DefaultChannel)
+			assert.True(t, errors.Is(err, ErrInvalidSignature))
+
+			_, err = NewVerifier().Verify(payload, DefaultChannel)
+			assert.True(t, errors.Is(err, ErrInvalidSignature))
+		})
+	}
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	payload, _ := json.Marshal(NewBlockCreatedEvent(Block{Hash: "abc"}))
+	assert.NotContains(t, string(payload), "signature")
+
+	_, err := NewVerifier().Verify(payload, DefaultChannel)
+	assert.True(t, errors.Is(err, ErrInvalidSignature))
+}
+
+func TestVerifyReplayed(t *testing.T) {
+	issuedAt := time.Unix(1000000, 0)
+	signer := &HMACSigner{KeyID: "key1", Key: []byte("s3cret"), Now: func() time.Time { return issuedAt }}
+	ev, err := signer.Sign(NewBlockCreatedEvent(Block{Hash: "abc"}), "monero")
+	assert.Nil(t, err)
+	assert.Equal(t, issuedAt.Unix(), ev.Signature.IssuedAt)
+	payload, _ := json.Marshal(ev)
+
+	verifier := NewVerifier()
+	verifier.AddHMACKey("key1", []byte("s3cret"))
+	_, err = verifier.VerifyAt(payload, "monero", issuedAt.Add(time.Minute))
+	assert.Nil(t, err)
+
+	t.Run("On another channel", func(t *testing.T) {
+		_, err := verifier.VerifyAt(payload, "monero.other", issuedAt)
+		assert.True(t, errors.Is(err, ErrInvalidSignature))
+
+		// Unless any channel is accepted
+		_, err = verifier.VerifyAt(payload, "", issuedAt)
+		assert.Nil(t, err)
+	})
+
+	t.Run("Too late or too early", func(t *testing.T) {
+		_, err := verifier.VerifyAt(payload, "monero", issuedAt.Add(DefaultMaxSignatureAge+time.Second))
+		assert.True(t, errors.Is(err, ErrInvalidSignature))
+		_, err = verifier.VerifyAt(payload, "monero", issuedAt.Add(-DefaultMaxSignatureAge-time.Second))
+		assert.True(t, errors.Is(err, ErrInvalidSignature))
+
+		// Unless the age isn't checked
+		verifier.MaxAge = 0
+		_, err = verifier.VerifyAt(payload, "monero", issuedAt.Add(time.Hour))
+		assert.Nil(t, err)
+	})
+
+	t.Run("Tampered channel", func(t *testing.T) {
+		tampered := bytes.Replace(payload, []byte(`"channel":"monero"`), []byte(`"channel":"other"`), 1)
+		_, err := verifier.VerifyAt(tampered, "other", issuedAt)
+		assert.True(t, errors.Is(err, ErrInvalidSignature))
+	})
+}
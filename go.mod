@@ -3,6 +3,7 @@ module github.com/xmrstuff/monero-nats-publisher
 go 1.15
 
 require (
+	filippo.io/age v1.0.0
 	github.com/golang/protobuf v1.4.3 // indirect
 	github.com/nats-io/nats-server/v2 v2.1.9
 	github.com/nats-io/nats-streaming-server v0.20.0
@@ -10,5 +11,7 @@ require (
 	github.com/nats-io/stan.go v0.8.2
 	github.com/stretchr/testify v1.7.0
 	github.com/urfave/cli/v2 v2.3.0
+	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5
+	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
 	google.golang.org/protobuf v1.25.0 // indirect
 )
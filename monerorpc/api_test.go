@@ -0,0 +1,39 @@
+package monerorpc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
+)
+
+func TestClientAsGetters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"result": {
+			"block_header": {"hash": "hash1", "height": 10, "prev_hash": "hash0"},
+			"tx_hashes": ["tx1"],
+			"transfers": [{"txid": "tx1", "type": "in", "amount": 5, "address": "addr1", "height": 10}]
+		}}`))
+	}))
+	defer server.Close()
+
+	client := monerorpc.NewRPCClient(server.URL)
+	var bg monerorpc.BlockGetter = client
+	var tg monerorpc.TxGetter = client
+
+	rpcBlock, err := bg.GetBlockByHash(context.Background(), "hash1")
+	assert.Nil(t, err)
+	blk := monerorpc.RpcBlockToBlock(*rpcBlock)
+	assert.Equal(t, "hash1", blk.Hash)
+	assert.Equal(t, []string{"hash0"}, blk.PrevHashes)
+
+	transfers, err := tg.GetTransferByTxid(context.Background(), "tx1")
+	assert.Nil(t, err)
+	tx, err := monerorpc.RpcTxToTx(transfers)
+	assert.Nil(t, err)
+	assert.Equal(t, "tx1", tx.TXID)
+	assert.Equal(t, "0.000000000005", tx.Destinations[0].AmountXMR)
+}
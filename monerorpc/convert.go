@@ -0,0 +1,161 @@
+package monerorpc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+// splitPaymentID tells apart the legacy (64 hex chars) payment IDs from the
+// short ones (16 hex chars) embedded in integrated addresses. The wallet
+// reports a zeroed payment ID when the Tx has none.
+func splitPaymentID(paymentID string) (legacy string, integrated string) {
+	if strings.Trim(paymentID, "0") == "" {
+		return "", ""
+	}
+
+	if len(paymentID) == 16 {
+		return "", paymentID
+	}
+	return paymentID, ""
+}
+
+// ErrNoIncomingTransfers is returned for Txs the wallet only reports
+// outgoing transfers of
+var ErrNoIncomingTransfers = errors.New("no incoming transfers")
+
+// TransferConflictError is returned when the transfers the wallet reports
+// for a single Tx disagree with each other
+type TransferConflictError struct {
+	TXID   string
+	Field  string
+	Values []string
+}
+
+func (e *TransferConflictError) Error() string {
+	return fmt.Sprintf("Conflicting %s across the transfers of tx %s: %s", e.Field, e.TXID, strings.Join(e.Values, ", "))
+}
+
+// checkConsistent returns a TransferConflictError if the values differ
+func checkConsistent(txid, field string, values []int) error {
+	for _, v := range values[1:] {
+		if v != values[0] {
+			strValues := []string{}
+			for _, v := range values {
+				strValues = append(strValues, strconv.Itoa(v))
+			}
+			return &TransferConflictError{TXID: txid, Field: field, Values: strValues}
+		}
+	}
+	return nil
+}
+
+// transferKey identifies a transfer, so the same one isn't counted twice
+// when the wallet reports it more than once
+type transferKey struct {
+	Type         string
+	Address      string
+	Amount       uint64
+	SubaddrIndex RpcSubaddressIndex
+}
+
+// RpcTxToTx converts the Monero Transaction representation
+// returned by the RPC, into the representation that we intend to
+// push through NATS.
+// The wallet reports one transfer per (type, subaddress). The incoming ones
+// are merged into a single Tx, adding up the amounts sent to each address.
+func RpcTxToTx(rpcTxs []RpcTx) (*events.Tx, error) {
+	if len(rpcTxs) == 0 {
+		return nil, fmt.Errorf("Unable to turn RPC result into TX: no transfers")
+	}
+
+	txid := rpcTxs[0].TXID
+	seen := map[transferKey]bool{}
+	incoming, heights, unlockTimes := []RpcTx{}, []int{}, []int{}
+	for _, rpcTx := range rpcTxs {
+		if rpcTx.TXID != txid {
+			return nil, &TransferConflictError{TXID: txid, Field: "txid", Values: []string{txid, rpcTx.TXID}}
+		}
+
+		key := transferKey{rpcTx.Type, rpcTx.Address, rpcTx.Amount, rpcTx.SubaddrIndex}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		// Outgoing transfers are not published, but they must agree
+		// with the incoming ones
+		heights = append(heights, rpcTx.Height)
+		unlockTimes = append(unlockTimes, rpcTx.UnlockTime)
+
+		if rpcTx.IsIncoming() {
+			incoming = append(incoming, rpcTx)
+		}
+	}
+
+	if err := checkConsistent(txid, "height", heights); err != nil {
+		return nil, err
+	}
+	if err := checkConsistent(txid, "unlock_time", unlockTimes); err != nil {
+		return nil, err
+	}
+
+	tx := events.Tx{}
+	destIdx := map[string]int{}
+	for _, rpcTx := range incoming {
+		tx.TXID = rpcTx.TXID
+		tx.Height = rpcTx.Height
+		tx.Timestamp = rpcTx.Timestamp
+		tx.UnlockTime = rpcTx.UnlockTime
+		if rpcTx.Confirmations > tx.Confirmations {
+			tx.Confirmations = rpcTx.Confirmations
+		}
+		tx.PaymentID, tx.IntegratedPaymentID = splitPaymentID(rpcTx.PaymentID)
+		tx.Fee = rpcTx.Fee
+		tx.FeeXMR = events.FormatXMR(rpcTx.Fee)
+		tx.Note = rpcTx.Note
+		tx.Locked = rpcTx.Locked
+		tx.DoubleSpendSeen = tx.DoubleSpendSeen || rpcTx.DoubleSpendSeen
+
+		if i, ok := destIdx[rpcTx.Address]; ok {
+			tx.Destinations[i].Amount += rpcTx.Amount
+			tx.Destinations[i].AmountXMR = events.FormatXMR(tx.Destinations[i].Amount)
+			continue
+		}
+
+		dest := events.Destination{
+			Amount:       rpcTx.Amount,
+			AmountXMR:    events.FormatXMR(rpcTx.Amount),
+			Address:      rpcTx.Address,
+			AccountIndex: rpcTx.SubaddrIndex.Major,
+			SubaddrIndex: rpcTx.SubaddrIndex.Minor,
+		}
+
+		destIdx[rpcTx.Address] = len(tx.Destinations)
+		tx.Destinations = append(tx.Destinations, dest)
+	}
+
+	if tx.TXID == "" || len(tx.Destinations) == 0 {
+		return nil, fmt.Errorf("Unable to turn RPC result into TX: %w: %+v", ErrNoIncomingTransfers, rpcTxs)
+	}
+
+	return &tx, nil
+}
+
+func RpcBlockToBlock(b RpcBlock) events.Block {
+	prevHashes := []string{}
+	if b.BlockHeader.PrevHash != "" {
+		prevHashes = append(prevHashes, b.BlockHeader.PrevHash)
+	}
+
+	return events.Block{
+		Hash:       b.BlockHeader.Hash,
+		Height:     b.BlockHeader.Height,
+		Timestamp:  b.BlockHeader.Timestamp,
+		PrevHashes: prevHashes,
+		TxHashes:   b.TxHashes,
+	}
+}
@@ -0,0 +1,257 @@
+package monerorpc
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRpcTransfersToTxSuccess(t *testing.T) {
+	transfers := []RpcTx{
+		{
+			TXID:          "dummy txid",
+			Height:        20,
+			Timestamp:     2000,
+			UnlockTime:    100,
+			Confirmations: 1,
+			Amount:        333333,
+			Address:       "addr1",
+			Type:          "in",
+		},
+		{
+			TXID:          "dummy txid",
+			Height:        20,
+			Timestamp:     2000,
+			UnlockTime:    100,
+			Confirmations: 1,
+			Amount:        666666,
+			Address:       "addr2",
+			Type:          "pool",
+		},
+		{
+			TXID:          "dummy txid",
+			Height:        20,
+			Timestamp:     2000,
+			UnlockTime:    100,
+			Confirmations: 1,
+			Amount:        99999,
+			Address:       "addr2",
+			Type:          "out",
+		},
+	}
+	tx, err := RpcTxToTx(transfers)
+	assert.Nil(t, err)
+
+	// The Transfer with type "out" was ignored
+	assert.Equal(t, 2, len(tx.Destinations))
+
+	for idx, _ := range tx.Destinations {
+		assert.Equal(t, transfers[idx].TXID, tx.TXID)
+		assert.Equal(t, transfers[idx].Height, tx.Height)
+		assert.Equal(t, transfers[idx].Timestamp, tx.Timestamp)
+		assert.Equal(t, transfers[idx].UnlockTime, tx.UnlockTime)
+		assert.Equal(t, transfers[idx].Confirmations, tx.Confirmations)
+
+		assert.Equal(t, transfers[idx].Address, tx.Destinations[idx].Address)
+		assert.Equal(t, transfers[idx].Amount, tx.Destinations[idx].Amount)
+	}
+}
+
+func TestRpcTransfersToTxExtraFields(t *testing.T) {
+	transfers := []RpcTx{
+		{
+			TXID:            "dummy txid",
+			Amount:          1,
+			Address:         "addr1",
+			Type:            "in",
+			SubaddrIndex:    RpcSubaddressIndex{Major: 1, Minor: 4},
+			PaymentID:       "0000000000000000",
+			Note:            "some note",
+			Fee:             30,
+			Locked:          true,
+			DoubleSpendSeen: true,
+		},
+	}
+	tx, err := RpcTxToTx(transfers)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "", tx.PaymentID)
+	assert.Equal(t, "", tx.IntegratedPaymentID)
+	assert.Equal(t, "some note", tx.Note)
+	assert.Equal(t, uint64(30), tx.Fee)
+	assert.Equal(t, "0.000000000030", tx.FeeXMR)
+	assert.True(t, tx.Locked)
+	assert.True(t, tx.DoubleSpendSeen)
+	assert.Equal(t, 1, tx.Destinations[0].AccountIndex)
+	assert.Equal(t, 4, tx.Destinations[0].SubaddrIndex)
+}
+
+func TestRpcTransfersToTxAggregation(t *testing.T) {
+	t.Run("Amounts to the same address are added up", func(t *testing.T) {
+		transfers := []RpcTx{
+			{TXID: "tx", Height: 20, Confirmations: 1, Amount: 1, Address: "addr1", Type: "in", SubaddrIndex: RpcSubaddressIndex{0, 1}},
+			{TXID: "tx", Height: 20, Confirmations: 2, Amount: 5, Address: "addr2", Type: "in", SubaddrIndex: RpcSubaddressIndex{0, 2}},
+			{TXID: "tx", Height: 20, Confirmations: 1, Amount: 3, Address: "addr1", Type: "in", SubaddrIndex: RpcSubaddressIndex{1, 1}},
+		}
+		tx, err := RpcTxToTx(transfers)
+		assert.Nil(t, err)
+
+		assert.Equal(t, 2, len(tx.Destinations))
+		assert.Equal(t, "addr1", tx.Destinations[0].Address)
+		assert.Equal(t, uint64(4), tx.Destinations[0].Amount)
+		assert.Equal(t, "0.000000000004", tx.Destinations[0].AmountXMR)
+		assert.Equal(t, "addr2", tx.Destinations[1].Address)
+		assert.Equal(t, uint64(5), tx.Destinations[1].Amount)
+
+		// The highest confirmations count wins, regardless of the order
+		assert.Equal(t, 2, tx.Confirmations)
+	})
+
+	t.Run("Repeated transfers are counted once", func(t *testing.T) {
+		transfer := RpcTx{TXID: "tx", Height: 20, Amount: 1, Address: "addr1", Type: "in"}
+		tx, err := RpcTxToTx([]RpcTx{transfer, transfer})
+		assert.Nil(t, err)
+
+		assert.Equal(t, 1, len(tx.Destinations))
+		assert.Equal(t, uint64(1), tx.Destinations[0].Amount)
+	})
+
+	errorCases := []struct {
+		Description string
+		Transfers   []RpcTx
+		Field       string
+	}{
+		{
+			"Inconsistent heights",
+			[]RpcTx{
+				{TXID: "tx", Height: 20, Amount: 1, Address: "addr1", Type: "in"},
+				{TXID: "tx", Height: 21, Amount: 1, Address: "addr2", Type: "in"},
+			},
+			"height",
+		},
+		{
+			"In and out transfers disagree",
+			[]RpcTx{
+				{TXID: "tx", Height: 20, UnlockTime: 0, Amount: 1, Address: "addr1", Type: "in"},
+				{TXID: "tx", Height: 20, UnlockTime: 100, Amount: 1, Address: "addr1", Type: "out"},
+			},
+			"unlock_time",
+		},
+		{
+			"Transfers of different Txs",
+			[]RpcTx{
+				{TXID: "tx1", Height: 20, Amount: 1, Address: "addr1", Type: "in"},
+				{TXID: "tx2", Height: 20, Amount: 1, Address: "addr1", Type: "in"},
+			},
+			"txid",
+		},
+	}
+	for _, c := range errorCases {
+		t.Run(c.Description, func(t *testing.T) {
+			tx, err := RpcTxToTx(c.Transfers)
+			assert.Nil(t, tx)
+
+			conflict, ok := err.(*TransferConflictError)
+			assert.True(t, ok)
+			assert.Equal(t, c.Field, conflict.Field)
+			assert.Equal(t, 2, len(conflict.Values))
+		})
+	}
+
+	t.Run("No transfers", func(t *testing.T) {
+		tx, err := RpcTxToTx([]RpcTx{})
+		assert.Nil(t, tx)
+		assert.Error(t, err)
+	})
+}
+
+func TestSplitPaymentID(t *testing.T) {
+	cases := []struct {
+		PaymentID          string
+		ExpectedLegacy     string
+		ExpectedIntegrated string
+	}{
+		{"", "", ""},
+		{"0000000000000000", "", ""},
+		{"0000000000000000000000000000000000000000000000000000000000000000", "", ""},
+		{"1234567890abcdef", "", "1234567890abcdef"},
+		{
+			"1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef",
+			"1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef",
+			"",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.PaymentID, func(t *testing.T) {
+			legacy, integrated := splitPaymentID(c.PaymentID)
+			assert.Equal(t, c.ExpectedLegacy, legacy)
+			assert.Equal(t, c.ExpectedIntegrated, integrated)
+		})
+	}
+}
+
+func TestRpcTransfersToTxFailure(t *testing.T) {
+	transfers := []RpcTx{
+		{
+			TXID:          "dummy txid",
+			Height:        20,
+			Timestamp:     2000,
+			UnlockTime:    100,
+			Confirmations: 1,
+			Amount:        99999,
+			Address:       "addr2",
+			Type:          "out",
+		},
+	}
+	tx, err := RpcTxToTx(transfers)
+	// No TX was created, because the only Transfer
+	// has type "out"
+	assert.Error(t, err)
+	assert.Nil(t, tx)
+}
+
+func TestRpcBlockToBlock(t *testing.T) {
+	prevHashCases := []string{"hash of prev block", ""}
+	expectedPrevHashes := [][]string{{"hash of prev block"}, {}}
+
+	for i := 0; i < len(prevHashCases); i++ {
+		t.Run("", func(t *testing.T) {
+			rb := RpcBlock{
+				BlockHeader: RpcBlockHeader{
+					Hash:      "some hash",
+					Height:    100,
+					Timestamp: 300,
+					PrevHash:  prevHashCases[i],
+				},
+				TxHashes: []string{"hash1", "hash2"},
+			}
+
+			b := RpcBlockToBlock(rb)
+
+			assert.Equal(t, rb.BlockHeader.Hash, b.Hash)
+			assert.Equal(t, rb.BlockHeader.Height, b.Height)
+			assert.Equal(t, rb.BlockHeader.Timestamp, b.Timestamp)
+			assert.Equal(t, expectedPrevHashes[i], b.PrevHashes)
+			assert.Equal(t, rb.TxHashes, b.TxHashes)
+		})
+	}
+}
+
+func TestAtomicAmountsJSONPrecision(t *testing.T) {
+	// Amounts above 2^53 would lose precision if decoded through a float64
+	payload := []byte(`{"amount": 18446744073709551615, "address": "addr1"}`)
+	rpcTx := RpcTx{}
+	assert.Nil(t, json.Unmarshal(payload, &rpcTx))
+	assert.Equal(t, uint64(math.MaxUint64), rpcTx.Amount)
+
+	tx, err := RpcTxToTx([]RpcTx{{TXID: "tx", Type: "in", Amount: rpcTx.Amount, Address: "addr1"}})
+	assert.Nil(t, err)
+
+	encoded, err := json.Marshal(tx.Destinations[0])
+	assert.Nil(t, err)
+	assert.Contains(t, string(encoded), `"amount":18446744073709551615`)
+	assert.Contains(t, string(encoded), `"amount_xmr":"18446744.073709551615"`)
+	assert.NotContains(t, string(encoded), `"amount_atomic"`)
+}
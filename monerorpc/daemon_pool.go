@@ -0,0 +1,304 @@
+package monerorpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDaemonMaxLag    = 2
+	defaultDaemonHealthTTL = 30 * time.Second
+)
+
+type DaemonClient interface {
+	BlockGetter
+	GetInfo(context.Context) (*RpcInfo, error)
+}
+
+type PooledDaemon struct {
+	URL    string
+	Client DaemonClient
+}
+
+// QuorumError is returned when two daemons disagree about a block
+type QuorumError struct {
+	Hash  string
+	URLs  [2]string
+	Field string
+}
+
+func (e *QuorumError) Error() string {
+	return fmt.Sprintf("daemons %s and %s disagree on the %s of block %s", e.URLs[0], e.URLs[1], e.Field, e.Hash)
+}
+
+// DaemonPool spreads the reads across several Monero Daemons, round-robin,
+// skipping the ones that are down, still syncing or lagging behind the
+// others. A read that fails on one daemon is retried on the next one.
+// In Quorum mode, blocks are only returned once two daemons agree on them,
+// to guard against a malicious or forked remote node.
+type DaemonPool struct {
+	Daemons []PooledDaemon
+	Quorum  bool
+	// MaxLag is how many blocks a daemon can be behind the highest one,
+	// and still be considered healthy
+	MaxLag    int
+	HealthTTL time.Duration
+
+	mu        sync.Mutex
+	next      int
+	healthy   []PooledDaemon
+	checkedAt time.Time
+}
+
+func NewDaemonPool(urls []string, quorum bool) *DaemonPool {
+	daemons := []PooledDaemon{}
+	for _, url := range urls {
+		daemons = append(daemons, PooledDaemon{URL: url, Client: NewRPCClient(url)})
+	}
+
+	return &DaemonPool{
+		Daemons:   daemons,
+		Quorum:    quorum,
+		MaxLag:    defaultDaemonMaxLag,
+		HealthTTL: defaultDaemonHealthTTL,
+	}
+}
+
+type daemonHealth struct {
+	Daemon PooledDaemon
+	Info   *RpcInfo
+	Err    error
+}
+
+// checkHealth queries every daemon's info concurrently. The healthy ones
+// are returned from the highest to the lowest. If none is healthy (e.g.
+// they are all syncing), the ones that answered are returned instead.
+func (p *DaemonPool) checkHealth(ctx context.Context) []PooledDaemon {
+	results := make([]daemonHealth, len(p.Daemons))
+	wg := sync.WaitGroup{}
+	for i, d := range p.Daemons {
+		wg.Add(1)
+		go func(i int, d PooledDaemon) {
+			defer wg.Done()
+			info, err := d.Client.GetInfo(ctx)
+			results[i] = daemonHealth{Daemon: d, Info: info, Err: err}
+		}(i, d)
+	}
+	wg.Wait()
+
+	answered := []daemonHealth{}
+	maxHeight := 0
+	for _, r := range results {
+		if r.Err != nil {
+			log.Printf("Daemon %s is down: %s", r.Daemon.URL, r.Err)
+			continue
+		}
+		answered = append(answered, r)
+		if r.Info.Height > maxHeight {
+			maxHeight = r.Info.Height
+		}
+	}
+	sort.SliceStable(answered, func(i, j int) bool {
+		return answered[i].Info.Height > answered[j].Info.Height
+	})
+
+	healthy, fallback := []PooledDaemon{}, []PooledDaemon{}
+	for _, r := range answered {
+		fallback = append(fallback, r.Daemon)
+		if !r.Info.Synchronized || r.Info.Height < maxHeight-p.MaxLag {
+			log.Printf("Daemon %s is unhealthy: height %d of %d, synchronized %t", r.Daemon.URL, r.Info.Height, maxHeight, r.Info.Synchronized)
+			continue
+		}
+		healthy = append(healthy, r.Daemon)
+	}
+
+	if len(healthy) == 0 {
+		return fallback
+	}
+	return healthy
+}
+
+// candidates returns the daemons to try, in order. The first one rotates on
+// every call.
+func (p *DaemonPool) candidates(ctx context.Context) ([]PooledDaemon, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	daemons := p.Daemons
+	if len(p.Daemons) > 1 {
+		if p.healthy == nil || time.Since(p.checkedAt) > p.HealthTTL {
+			p.healthy = p.checkHealth(ctx)
+			p.checkedAt = time.Now()
+		}
+		daemons = p.healthy
+	}
+	if len(daemons) == 0 {
+		// Checked again on the next call
+		p.healthy = nil
+		return nil, fmt.Errorf("no daemon available")
+	}
+
+	start := p.next % len(daemons)
+	p.next++
+	return append(append([]PooledDaemon{}, daemons[start:]...), daemons[:start]...), nil
+}
+
+func (p *DaemonPool) GetBlockByHash(ctx context.Context, hash string) (*RpcBlock, error) {
+	daemons, err := p.candidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var first *RpcBlock
+	var firstURL string
+	for _, d := range daemons {
+		b, err := d.Client.GetBlockByHash(ctx, hash)
+		if err != nil {
+			log.Printf("Failed to get block %s from daemon %s: %s", hash, d.URL, err)
+			continue
+		}
+
+		if !p.Quorum {
+			return b, nil
+		}
+		if first == nil {
+			first, firstURL = b, d.URL
+			continue
+		}
+
+		if field := diffBlocks(first, b); field != "" {
+			return nil, &QuorumError{Hash: hash, URLs: [2]string{firstURL, d.URL}, Field: field}
+		}
+		return first, nil
+	}
+
+	if first != nil {
+		return nil, fmt.Errorf("unable to get block %s from a second daemon for the quorum", hash)
+	}
+	return nil, fmt.Errorf("unable to get block %s from any daemon", hash)
+}
+
+// GetBlocksByHash fetches the blocks from a single daemon, in a batch when
+// it supports it. In Quorum mode, a second daemon has to agree on each one.
+func (p *DaemonPool) GetBlocksByHash(ctx context.Context, hashes []string) ([]*RpcBlock, error) {
+	daemons, err := p.candidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var first []*RpcBlock
+	var firstURL string
+	for _, d := range daemons {
+		blocks, err := GetBlocks(ctx, d.Client, hashes)
+		if err != nil {
+			log.Printf("Failed to get %d blocks from daemon %s: %s", len(hashes), d.URL, err)
+			continue
+		}
+
+		if !p.Quorum {
+			return blocks, nil
+		}
+		if first == nil {
+			first, firstURL = blocks, d.URL
+			continue
+		}
+
+		for i := range first {
+			if field := diffBlocks(first[i], blocks[i]); field != "" {
+				return nil, &QuorumError{Hash: hashes[i], URLs: [2]string{firstURL, d.URL}, Field: field}
+			}
+		}
+		return first, nil
+	}
+
+	if first != nil {
+		return nil, fmt.Errorf("unable to get %d blocks from a second daemon for the quorum", len(hashes))
+	}
+	return nil, fmt.Errorf("unable to get %d blocks from any daemon", len(hashes))
+}
+
+// GetBlockHeadersRange fetches the headers from a single daemon. In Quorum
+// mode, a second daemon has to agree on each one.
+func (p *DaemonPool) GetBlockHeadersRange(ctx context.Context, start, end int) ([]RpcBlockHeader, error) {
+	daemons, err := p.candidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var first []RpcBlockHeader
+	var firstURL string
+	var lastErr error
+	for _, d := range daemons {
+		headers, err := d.Client.GetBlockHeadersRange(ctx, start, end)
+		if err != nil {
+			log.Printf("Failed to get block headers %d-%d from daemon %s: %s", start, end, d.URL, err)
+			lastErr = err
+			continue
+		}
+
+		if !p.Quorum {
+			return headers, nil
+		}
+		if first == nil {
+			first, firstURL = headers, d.URL
+			continue
+		}
+
+		if len(first) != len(headers) {
+			return nil, fmt.Errorf("daemons %s and %s disagree on the number of block headers %d-%d", firstURL, d.URL, start, end)
+		}
+		for i := range first {
+			if field := diffHeaders(&first[i], &headers[i]); field != "" {
+				return nil, &QuorumError{Hash: first[i].Hash, URLs: [2]string{firstURL, d.URL}, Field: field}
+			}
+		}
+		return first, nil
+	}
+
+	if first != nil {
+		return nil, fmt.Errorf("unable to get block headers %d-%d from a second daemon for the quorum", start, end)
+	}
+	return nil, lastErr
+}
+
+// diffHeaders returns the first field the block headers differ on, if any
+func diffHeaders(a, b *RpcBlockHeader) string {
+	switch {
+	case a.Hash != b.Hash:
+		return "hash"
+	case a.Height != b.Height:
+		return "height"
+	case a.PrevHash != b.PrevHash:
+		return "prev_hash"
+	case a.Timestamp != b.Timestamp:
+		return "timestamp"
+	}
+	return ""
+}
+
+// diffBlocks returns the first field the blocks differ on, if any
+func diffBlocks(a, b *RpcBlock) string {
+	if field := diffHeaders(&a.BlockHeader, &b.BlockHeader); field != "" {
+		return field
+	}
+	if !equalStrings(a.TxHashes, b.TxHashes) {
+		return "tx_hashes"
+	}
+	return ""
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,268 @@
+package monerorpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MockedDaemon struct {
+	mu          sync.Mutex
+	Info        *RpcInfo
+	InfoErr     error
+	Block       *RpcBlock
+	BlockErr    error
+	Headers     []RpcBlockHeader
+	BlockCalls  int
+	HeaderCalls int
+	InfoCalls   int
+}
+
+func (d *MockedDaemon) GetInfo(ctx context.Context) (*RpcInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.InfoCalls++
+	return d.Info, d.InfoErr
+}
+
+func (d *MockedDaemon) GetBlockByHash(ctx context.Context, hash string) (*RpcBlock, error) {
+	d.BlockCalls++
+	return d.Block, d.BlockErr
+}
+
+func (d *MockedDaemon) GetBlockHeadersRange(ctx context.Context, start, end int) ([]RpcBlockHeader, error) {
+	d.HeaderCalls++
+	return d.Headers, d.BlockErr
+}
+
+func newTestBlock(hash string) *RpcBlock {
+	return &RpcBlock{
+		BlockHeader: RpcBlockHeader{Hash: hash, Height: 100, PrevHash: "prev"},
+		TxHashes:    []string{"tx1"},
+	}
+}
+
+func newTestDaemonPool(quorum bool, daemons ...*MockedDaemon) *DaemonPool {
+	pool := NewDaemonPool([]string{}, quorum)
+	for i, d := range daemons {
+		pool.Daemons = append(pool.Daemons, PooledDaemon{URL: fmt.Sprintf("daemon%d", i), Client: d})
+	}
+	return pool
+}
+
+func TestDaemonPoolRoundRobin(t *testing.T) {
+	d1 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Block: newTestBlock("b")}
+	d2 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Block: newTestBlock("b")}
+	pool := newTestDaemonPool(false, d1, d2)
+
+	for i := 0; i < 4; i++ {
+		b, err := pool.GetBlockByHash(context.Background(), "b")
+		assert.Nil(t, err)
+		assert.Equal(t, "b", b.BlockHeader.Hash)
+	}
+	assert.Equal(t, 2, d1.BlockCalls)
+	assert.Equal(t, 2, d2.BlockCalls)
+
+	// Health is checked once per TTL
+	assert.Equal(t, 1, d1.InfoCalls)
+}
+
+func TestDaemonPoolSkipsUnhealthy(t *testing.T) {
+	cases := []struct {
+		Description string
+		Unhealthy   *MockedDaemon
+	}{
+		{"Down", &MockedDaemon{InfoErr: fmt.Errorf("Dummy error")}},
+		{"Not synchronized", &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: false}}},
+		{"Lagging", &MockedDaemon{Info: &RpcInfo{Height: 90, Synchronized: true}}},
+	}
+	for _, c := range cases {
+		t.Run(c.Description, func(t *testing.T) {
+			healthy := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Block: newTestBlock("b")}
+			pool := newTestDaemonPool(false, c.Unhealthy, healthy)
+
+			for i := 0; i < 3; i++ {
+				_, err := pool.GetBlockByHash(context.Background(), "b")
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, 0, c.Unhealthy.BlockCalls)
+			assert.Equal(t, 3, healthy.BlockCalls)
+		})
+	}
+}
+
+func TestDaemonPoolFailover(t *testing.T) {
+	failing := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, BlockErr: fmt.Errorf("Dummy error")}
+	working := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Block: newTestBlock("b"), Headers: []RpcBlockHeader{{Hash: "h"}}}
+	pool := newTestDaemonPool(false, failing, working)
+
+	b, err := pool.GetBlockByHash(context.Background(), "b")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", b.BlockHeader.Hash)
+
+	headers, err := pool.GetBlockHeadersRange(context.Background(), 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "h", headers[0].Hash)
+
+	t.Run("Every daemon fails", func(t *testing.T) {
+		other := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, BlockErr: fmt.Errorf("Dummy error")}
+		pool := newTestDaemonPool(false, failing, other)
+
+		_, err := pool.GetBlockByHash(context.Background(), "b")
+		assert.Error(t, err)
+		_, err = pool.GetBlockHeadersRange(context.Background(), 1, 2)
+		assert.Error(t, err)
+	})
+}
+
+func TestDaemonPoolFallsBackWhenNoneIsHealthy(t *testing.T) {
+	// e.g. every daemon is still syncing
+	d1 := &MockedDaemon{Info: &RpcInfo{Height: 50, Synchronized: false}, Block: newTestBlock("b")}
+	d2 := &MockedDaemon{Info: &RpcInfo{Height: 60, Synchronized: false}, Block: newTestBlock("b")}
+	pool := newTestDaemonPool(false, d1, d2)
+
+	_, err := pool.GetBlockByHash(context.Background(), "b")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, d2.BlockCalls)
+
+	t.Run("Every daemon is down", func(t *testing.T) {
+		down := &MockedDaemon{InfoErr: fmt.Errorf("Dummy error")}
+		pool := newTestDaemonPool(false, down, down)
+
+		_, err := pool.GetBlockByHash(context.Background(), "b")
+		assert.Error(t, err)
+	})
+}
+
+func TestDaemonPoolSingleDaemon(t *testing.T) {
+	// A single daemon is used as is, even while syncing
+	d := &MockedDaemon{Info: &RpcInfo{Height: 50, Synchronized: false}, Block: newTestBlock("b")}
+	pool := newTestDaemonPool(true, d)
+	pool.Quorum = false
+
+	_, err := pool.GetBlockByHash(context.Background(), "b")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, d.InfoCalls)
+}
+
+func TestDaemonPoolQuorum(t *testing.T) {
+	t.Run("Daemons agree", func(t *testing.T) {
+		d1 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Block: newTestBlock("b")}
+		d2 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Block: newTestBlock("b")}
+		pool := newTestDaemonPool(true, d1, d2)
+
+		b, err := pool.GetBlockByHash(context.Background(), "b")
+		assert.Nil(t, err)
+		assert.Equal(t, "b", b.BlockHeader.Hash)
+		assert.Equal(t, 1, d1.BlockCalls)
+		assert.Equal(t, 1, d2.BlockCalls)
+	})
+
+	t.Run("Daemons disagree", func(t *testing.T) {
+		forked := newTestBlock("b")
+		forked.TxHashes = []string{"tx2"}
+		d1 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Block: newTestBlock("b")}
+		d2 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Block: forked}
+		pool := newTestDaemonPool(true, d1, d2)
+
+		b, err := pool.GetBlockByHash(context.Background(), "b")
+		assert.Nil(t, b)
+		quorumErr, ok := err.(*QuorumError)
+		assert.True(t, ok)
+		assert.Equal(t, "tx_hashes", quorumErr.Field)
+	})
+
+	t.Run("No second daemon", func(t *testing.T) {
+		d1 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Block: newTestBlock("b")}
+		d2 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, BlockErr: fmt.Errorf("Dummy error")}
+		pool := newTestDaemonPool(true, d1, d2)
+
+		b, err := pool.GetBlockByHash(context.Background(), "b")
+		assert.Nil(t, b)
+		assert.Error(t, err)
+	})
+}
+
+func TestDaemonPoolHeadersQuorum(t *testing.T) {
+	headers := func(prevHash string) []RpcBlockHeader {
+		return []RpcBlockHeader{{Hash: "h1", Height: 1, PrevHash: "h0"}, {Hash: "h2", Height: 2, PrevHash: prevHash}}
+	}
+
+	t.Run("Daemons agree", func(t *testing.T) {
+		d1 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Headers: headers("h1")}
+		d2 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Headers: headers("h1")}
+		pool := newTestDaemonPool(true, d1, d2)
+
+		got, err := pool.GetBlockHeadersRange(context.Background(), 1, 2)
+		assert.Nil(t, err)
+		assert.Len(t, got, 2)
+		assert.Equal(t, 1, d1.HeaderCalls)
+		assert.Equal(t, 1, d2.HeaderCalls)
+	})
+
+	t.Run("Daemons disagree", func(t *testing.T) {
+		d1 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Headers: headers("h1")}
+		d2 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Headers: headers("forked")}
+		pool := newTestDaemonPool(true, d1, d2)
+
+		got, err := pool.GetBlockHeadersRange(context.Background(), 1, 2)
+		assert.Nil(t, got)
+		quorumErr, ok := err.(*QuorumError)
+		assert.True(t, ok)
+		assert.Equal(t, "h2", quorumErr.Hash)
+		assert.Equal(t, "prev_hash", quorumErr.Field)
+	})
+
+	t.Run("No second daemon", func(t *testing.T) {
+		d1 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Headers: headers("h1")}
+		d2 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, BlockErr: fmt.Errorf("Dummy error")}
+		pool := newTestDaemonPool(true, d1, d2)
+
+		_, err := pool.GetBlockHeadersRange(context.Background(), 1, 2)
+		assert.Error(t, err)
+	})
+}
+
+func TestDaemonPoolGetBlocksByHash(t *testing.T) {
+	t.Run("Failover", func(t *testing.T) {
+		failing := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, BlockErr: fmt.Errorf("Dummy error")}
+		working := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Block: newTestBlock("b")}
+		pool := newTestDaemonPool(false, failing, working)
+
+		blocks, err := pool.GetBlocksByHash(context.Background(), []string{"b", "b"})
+		assert.Nil(t, err)
+		assert.Len(t, blocks, 2)
+		assert.Equal(t, 2, working.BlockCalls)
+	})
+
+	t.Run("Quorum disagree", func(t *testing.T) {
+		forked := newTestBlock("b")
+		forked.BlockHeader.Timestamp = 1
+		d1 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Block: newTestBlock("b")}
+		d2 := &MockedDaemon{Info: &RpcInfo{Height: 100, Synchronized: true}, Block: forked}
+		pool := newTestDaemonPool(true, d1, d2)
+
+		blocks, err := pool.GetBlocksByHash(context.Background(), []string{"b"})
+		assert.Nil(t, blocks)
+		quorumErr, ok := err.(*QuorumError)
+		assert.True(t, ok)
+		assert.Equal(t, "timestamp", quorumErr.Field)
+	})
+}
+
+func TestDiffBlocks(t *testing.T) {
+	a := newTestBlock("b")
+	assert.Equal(t, "", diffBlocks(a, newTestBlock("b")))
+	assert.Equal(t, "hash", diffBlocks(a, newTestBlock("c")))
+
+	b := newTestBlock("b")
+	b.BlockHeader.PrevHash = "other"
+	assert.Equal(t, "prev_hash", diffBlocks(a, b))
+
+	b = newTestBlock("b")
+	b.BlockHeader.Height = 101
+	assert.Equal(t, "height", diffBlocks(a, b))
+}
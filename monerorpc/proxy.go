@@ -0,0 +1,145 @@
+package monerorpc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Circuits through Tor are slow to build, and onion services slower to
+// reach
+const (
+	proxiedRPCTimeout = 30 * time.Second
+	onionRPCTimeout   = 90 * time.Second
+)
+
+// SOCKS5Dialer opens connections through a SOCKS5 proxy such as Tor.
+// With RemoteResolve (socks5h://), host names are resolved by the proxy,
+// which is required for .onion addresses and avoids DNS leaks.
+type SOCKS5Dialer struct {
+	ProxyAddr     string
+	RemoteResolve bool
+	Username      string
+	Password      string
+	Timeout       time.Duration
+}
+
+// NewSOCKS5Dialer parses a socks5:// or socks5h:// proxy URL. Credentials in
+// the URL are sent to the proxy as they are; otherwise the endpoint is used
+// as username, so that Tor (IsolateSOCKSAuth, on by default) isolates each
+// endpoint on its own circuits.
+func NewSOCKS5Dialer(proxyURL, endpoint string) (*SOCKS5Dialer, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %s: %s", proxyURL, err)
+	}
+
+	d := &SOCKS5Dialer{ProxyAddr: u.Host, Timeout: proxiedRPCTimeout}
+	switch u.Scheme {
+	case "socks5":
+	case "socks5h":
+		d.RemoteResolve = true
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected socks5 or socks5h", u.Scheme)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("proxy URL %s has no port", proxyURL)
+	}
+
+	if u.User != nil {
+		d.Username = u.User.Username()
+		d.Password, _ = u.User.Password()
+	} else {
+		sum := sha256.Sum256([]byte(endpoint))
+		d.Username = hex.EncodeToString(sum[:8])
+		d.Password = "isolate"
+	}
+	return d, nil
+}
+
+func (d *SOCKS5Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if !d.RemoteResolve {
+		// golang.org/x/net/proxy hands host names over to the proxy
+		resolved, err := resolveLocally(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		addr = resolved
+	}
+
+	var auth *proxy.Auth
+	if d.Username != "" {
+		auth = &proxy.Auth{User: d.Username, Password: d.Password}
+	}
+	dialer, err := proxy.SOCKS5("tcp", d.ProxyAddr, auth, &net.Dialer{Timeout: d.Timeout})
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialer.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("SOCKS5 proxy %s: %w", d.ProxyAddr, err)
+	}
+	return conn, nil
+}
+
+// resolveLocally replaces the host name of addr with its first IP address
+func resolveLocally(ctx context.Context, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	if strings.HasSuffix(host, ".onion") {
+		return "", fmt.Errorf("%s can only be resolved by the proxy, use socks5h://", host)
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ips[0].IP.String(), port), nil
+}
+
+// SetProxy routes the client's requests through the SOCKS5 proxy. Each
+// client is isolated on its own circuits, and gets a longer timeout,
+// longer still for onion services.
+func (c *RPCClient) SetProxy(proxyURL string) error {
+	if proxyURL == "" {
+		return nil
+	}
+
+	dialer, err := NewSOCKS5Dialer(proxyURL, c.Host)
+	if err != nil {
+		return err
+	}
+
+	timeout := proxiedRPCTimeout
+	if u, err := url.Parse(c.Host); err == nil && strings.HasSuffix(u.Hostname(), ".onion") {
+		timeout = onionRPCTimeout
+	}
+	dialer.Timeout = timeout
+	c.HTTPClient.Timeout = timeout
+
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: timeout,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if digest, ok := c.HTTPClient.Transport.(*DigestTransport); ok {
+		digest.Transport = transport
+	} else {
+		c.HTTPClient.Transport = transport
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package monerorpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	socksVersion      = 0x05
+	socksAuthNone     = 0x00
+	socksAuthPassword = 0x02
+	socksAtypIPv4     = 0x01
+	socksAtypDomain   = 0x03
+)
+
+// socksStandIn is a minimal SOCKS5 server that connects every request to
+// Target, whatever the requested address, and records what it was asked
+type socksStandIn struct {
+	Target string
+	Reply  byte
+
+	listener net.Listener
+	mu       sync.Mutex
+	users    []string
+	hosts    []string
+}
+
+func newSOCKSStandIn(t *testing.T, target string) *socksStandIn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	s := &socksStandIn{Target: target, listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socksStandIn) URL(scheme string) string {
+	return scheme + "://" + s.listener.Addr().String()
+}
+
+func (s *socksStandIn) Close() {
+	s.listener.Close()
+}
+
+func (s *socksStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return
+	}
+	methods := make([]byte, header[1])
+	io.ReadFull(conn, methods)
+
+	// Like Tor, username/password authentication is preferred when offered
+	user := ""
+	if bytes.IndexByte(methods, socksAuthPassword) >= 0 {
+		conn.Write([]byte{socksVersion, socksAuthPassword})
+		buf := make([]byte, 2)
+		io.ReadFull(conn, buf)
+		username := make([]byte, buf[1])
+		io.ReadFull(conn, username)
+		io.ReadFull(conn, buf[:1])
+		io.ReadFull(conn, make([]byte, buf[0]))
+		conn.Write([]byte{0x01, 0x00})
+		user = string(username)
+	} else {
+		conn.Write([]byte{socksVersion, socksAuthNone})
+	}
+
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	host := ""
+	switch req[3] {
+	case socksAtypIPv4:
+		ip := make([]byte, net.IPv4len)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case socksAtypDomain:
+		l := make([]byte, 1)
+		io.ReadFull(conn, l)
+		name := make([]byte, l[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	}
+	// The port is ignored, everything goes to Target
+	io.ReadFull(conn, make([]byte, 2))
+
+	s.mu.Lock()
+	s.users = append(s.users, user)
+	s.hosts = append(s.hosts, host)
+	s.mu.Unlock()
+
+	if s.Reply != 0 {
+		conn.Write([]byte{socksVersion, s.Reply, 0x00, socksAtypIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+
+	target, err := net.Dial("tcp", s.Target)
+	if err != nil {
+		conn.Write([]byte{socksVersion, 0x05, 0x00, socksAtypIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{socksVersion, 0x00, 0x00, socksAtypIPv4, 127, 0, 0, 1, 0, 0})
+
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func TestSetProxy(t *testing.T) {
+	jsonResp := `{"result": {"height": 100, "synchronized": true, "status": "OK"}}`
+	server := makeServer(t, "/json_rpc", "POST", "", 200, jsonResp)
+	defer server.Close()
+	serverAddr := server.Listener.Addr().String()
+	_, port, _ := net.SplitHostPort(serverAddr)
+
+	t.Run("Host names are resolved by the proxy", func(t *testing.T) {
+		proxy := newSOCKSStandIn(t, serverAddr)
+		defer proxy.Close()
+
+		client := NewRPCClient("http://node.example.onion:" + port)
+		assert.Nil(t, client.SetProxy(proxy.URL("socks5h")))
+		assert.Equal(t, onionRPCTimeout, client.HTTPClient.Timeout)
+
+		info, err := client.GetInfo(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, 100, info.Height)
+		assert.Equal(t, []string{"node.example.onion"}, proxy.hosts)
+	})
+
+	t.Run("IP addresses", func(t *testing.T) {
+		proxy := newSOCKSStandIn(t, serverAddr)
+		defer proxy.Close()
+
+		client := NewRPCClient(server.URL)
+		assert.Nil(t, client.SetProxy(proxy.URL("socks5")))
+		assert.Equal(t, proxiedRPCTimeout, client.HTTPClient.Timeout)
+
+		_, err := client.GetInfo(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"127.0.0.1"}, proxy.hosts)
+	})
+
+	t.Run("Endpoints are isolated", func(t *testing.T) {
+		proxy := newSOCKSStandIn(t, serverAddr)
+		defer proxy.Close()
+
+		for _, host := range []string{"http://a.example:" + port, "http://b.example:" + port, "http://a.example:" + port} {
+			client := NewRPCClient(host)
+			assert.Nil(t, client.SetProxy(proxy.URL("socks5h")))
+			_, err := client.GetInfo(context.Background())
+			assert.Nil(t, err)
+		}
+
+		assert.Equal(t, 3, len(proxy.users))
+		assert.NotEmpty(t, proxy.users[0])
+		assert.NotEqual(t, proxy.users[0], proxy.users[1])
+		assert.Equal(t, proxy.users[0], proxy.users[2])
+	})
+
+	t.Run("Credentials from the proxy URL", func(t *testing.T) {
+		proxy := newSOCKSStandIn(t, serverAddr)
+		defer proxy.Close()
+
+		client := NewRPCClient(server.URL)
+		assert.Nil(t, client.SetProxy("socks5h://alice:secret@"+proxy.listener.Addr().String()))
+		_, err := client.GetInfo(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"alice"}, proxy.users)
+	})
+
+	t.Run("Digest authentication still applies", func(t *testing.T) {
+		client := NewAuthenticatedRPCClient(server.URL, "user", "pass")
+		assert.Nil(t, client.SetProxy("socks5h://127.0.0.1:9050"))
+		digest, ok := client.HTTPClient.Transport.(*DigestTransport)
+		assert.True(t, ok)
+		assert.NotNil(t, digest.Transport)
+	})
+
+	t.Run("Proxy refuses the connection", func(t *testing.T) {
+		proxy := newSOCKSStandIn(t, serverAddr)
+		proxy.Reply = 0x04
+		defer proxy.Close()
+
+		client := NewRPCClient(server.URL)
+		assert.Nil(t, client.SetProxy(proxy.URL("socks5h")))
+		_, err := client.GetInfo(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "host unreachable")
+	})
+
+	t.Run("Onion addresses require socks5h", func(t *testing.T) {
+		proxy := newSOCKSStandIn(t, serverAddr)
+		defer proxy.Close()
+
+		client := NewRPCClient("http://node.example.onion:" + port)
+		assert.Nil(t, client.SetProxy(proxy.URL("socks5")))
+		client.HTTPClient.Timeout = time.Second
+		_, err := client.GetInfo(context.Background())
+		assert.Error(t, err)
+		assert.Empty(t, proxy.hosts)
+	})
+}
+
+func TestNewSOCKS5DialerErrors(t *testing.T) {
+	for _, proxyURL := range []string{"http://127.0.0.1:9050", "socks5h://127.0.0.1", "::"} {
+		_, err := NewSOCKS5Dialer(proxyURL, "http://node")
+		assert.Error(t, err, proxyURL)
+	}
+}
@@ -0,0 +1,248 @@
+// Package monerorpc is a client of the Monero Wallet and Daemon JSON-RPC
+// APIs, for what the publisher needs from them.
+package monerorpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultFinalityDepth is how many blocks deep a block header has to be
+// before it's cached
+const defaultFinalityDepth = 10
+
+type RPCRequestPayload struct {
+	ID      string      `json:"id"`
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type RpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type RpcResponse struct {
+	ID      string      `json:"id"`
+	JSONRPC string      `json:"jsonrpc"`
+	Result  interface{} `json:"result"`
+	Error   *RpcError   `json:"error"`
+}
+
+type RPCClient struct {
+	HTTPClient *http.Client
+	Host       string
+	BasePath   string
+
+	// Cache keeps immutable results (blocks by hash, and headers at least
+	// FinalityDepth blocks deep). No caching when nil.
+	Cache         *RPCCache
+	FinalityDepth int
+
+	lastID uint64
+
+	labelsMu sync.Mutex
+	labels   map[RpcSubaddressIndex]string
+
+	tipMu     sync.Mutex
+	tipHeight int
+
+	capsMu sync.Mutex
+	caps   *DaemonCapabilities
+}
+
+// nextID returns a request ID unique to this client, so that responses can
+// be matched with their requests
+func (c *RPCClient) nextID() string {
+	return strconv.FormatUint(atomic.AddUint64(&c.lastID, 1), 10)
+}
+
+// observeHeight records the highest block height seen so far, which tells
+// how deep (and then how final) other blocks are
+func (c *RPCClient) observeHeight(height int) {
+	c.tipMu.Lock()
+	defer c.tipMu.Unlock()
+	if height > c.tipHeight {
+		c.tipHeight = height
+	}
+}
+
+// isFinal tells whether a block at this height is deep enough to be cached
+func (c *RPCClient) isFinal(height int) bool {
+	c.tipMu.Lock()
+	defer c.tipMu.Unlock()
+	return c.tipHeight > 0 && height <= c.tipHeight-c.FinalityDepth
+}
+
+func (c *RPCClient) BaseURL() string {
+	return fmt.Sprintf("%s/%s", c.Host, c.BasePath)
+}
+
+// post sends the JSON encoded body, and returns the response for the caller
+// to decode and close
+func (c *RPCClient) post(ctx context.Context, body interface{}) (*http.Response, error) {
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(body); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL(), buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rawResp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if rawResp.StatusCode != 200 {
+		rawResp.Body.Close()
+		// RPC returns 200 unless something went really wrong
+		return nil, fmt.Errorf("Unknown Error. Code %d", rawResp.StatusCode)
+	}
+	return rawResp, nil
+}
+
+func (c *RPCClient) MakeRequest(ctx context.Context, rpcReq interface{}, result interface{}) error {
+	id, method := "", ""
+	if payload, ok := rpcReq.(RPCRequestPayload); ok {
+		id, method = c.nextID(), payload.Method
+		payload.ID = id
+		rpcReq = payload
+	}
+
+	rawResp, err := c.post(ctx, rpcReq)
+	if err != nil {
+		return err
+	}
+	defer rawResp.Body.Close()
+
+	resp := RpcResponse{
+		Result: result,
+	}
+	if err := json.NewDecoder(rawResp.Body).Decode(&resp); err != nil {
+		return err
+	}
+
+	if id != "" && resp.ID != "" && resp.ID != id {
+		return fmt.Errorf("RPC response id %s doesn't match request id %s", resp.ID, id)
+	}
+
+	if resp.Result == nil && resp.Error == nil {
+		return fmt.Errorf("Unable to parse RPC response: %+v", resp)
+	}
+
+	if resp.Error != nil {
+		return c.rpcError(method, resp.Error)
+	}
+	return nil
+}
+
+// rpcError tells apart the methods the server doesn't serve from the other
+// RPC errors
+func (c *RPCClient) rpcError(method string, rpcErr *RpcError) error {
+	if rpcErr.Code == rpcMethodNotFound && method != "" {
+		return &UnsupportedError{Method: method, Host: c.Host, Capabilities: c.Capabilities()}
+	}
+	return fmt.Errorf("RPC Error. %+v", rpcErr)
+}
+
+// RPCBatchCall is one of the requests of a batch, along with where to decode
+// its result, and the error it failed with
+type RPCBatchCall struct {
+	Request RPCRequestPayload
+	Result  interface{}
+	Err     error
+}
+
+type rpcBatchResponse struct {
+	ID     string          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RpcError       `json:"error"`
+}
+
+// MakeBatchRequest sends the calls as a single JSON-RPC 2.0 batch. Each call
+// gets a unique ID, and its response is matched by ID, since the server may
+// answer in any order. The returned error is about the batch as a whole;
+// the errors of each call are set on its Err.
+func (c *RPCClient) MakeBatchRequest(ctx context.Context, calls []*RPCBatchCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	byID := map[string]*RPCBatchCall{}
+	payloads := []RPCRequestPayload{}
+	for _, call := range calls {
+		call.Request.ID = c.nextID()
+		call.Err = nil
+		byID[call.Request.ID] = call
+		payloads = append(payloads, call.Request)
+	}
+
+	rawResp, err := c.post(ctx, payloads)
+	if err != nil {
+		return err
+	}
+	defer rawResp.Body.Close()
+
+	resps := []rpcBatchResponse{}
+	if err := json.NewDecoder(rawResp.Body).Decode(&resps); err != nil {
+		return fmt.Errorf("Unable to parse RPC batch response: %w", err)
+	}
+
+	for _, resp := range resps {
+		call, ok := byID[resp.ID]
+		if !ok {
+			return fmt.Errorf("RPC batch response has unexpected id %q", resp.ID)
+		}
+		delete(byID, resp.ID)
+
+		switch {
+		case resp.Error != nil:
+			call.Err = c.rpcError(call.Request.Method, resp.Error)
+		case len(resp.Result) == 0 || string(resp.Result) == "null":
+			call.Err = fmt.Errorf("Unable to parse RPC response: %+v", resp)
+		default:
+			call.Err = json.Unmarshal(resp.Result, call.Result)
+		}
+	}
+
+	for id, call := range byID {
+		call.Err = fmt.Errorf("RPC batch response is missing id %s", id)
+	}
+	return nil
+}
+
+func NewRPCClient(host string) *RPCClient {
+	return &RPCClient{
+		Host:     host,
+		BasePath: "json_rpc",
+		HTTPClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		FinalityDepth: defaultFinalityDepth,
+	}
+}
+
+// NewAuthenticatedRPCClient returns a client for RPC servers started with
+// --rpc-login
+func NewAuthenticatedRPCClient(host, username, password string) *RPCClient {
+	c := NewRPCClient(host)
+	if username != "" {
+		c.HTTPClient.Transport = &DigestTransport{
+			Username: username,
+			Password: password,
+		}
+	}
+	return c
+}
@@ -0,0 +1,35 @@
+package monerorpc
+
+import "context"
+
+type CreateAddressParams struct {
+	AccountIndex int    `json:"account_index"`
+	Label        string `json:"label,omitempty"`
+}
+
+type RpcCreatedAddress struct {
+	Address      string `json:"address"`
+	AddressIndex int    `json:"address_index"`
+}
+
+func NewCreateAddressPayload(accountIndex int, label string) RPCRequestPayload {
+	return RPCRequestPayload{
+		ID:      "0",
+		JSONRPC: "2.0",
+		Method:  "create_address",
+		Params: CreateAddressParams{
+			AccountIndex: accountIndex,
+			Label:        label,
+		},
+	}
+}
+
+// CreateAddress asks the Monero Wallet RPC for a new subaddress in the given account
+func (c *RPCClient) CreateAddress(ctx context.Context, accountIndex int, label string) (*RpcCreatedAddress, error) {
+	rpcReq := NewCreateAddressPayload(accountIndex, label)
+	result := RpcCreatedAddress{}
+	if err := c.MakeRequest(ctx, rpcReq, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
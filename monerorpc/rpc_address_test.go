@@ -0,0 +1,65 @@
+package monerorpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCreateAddressPayload(t *testing.T) {
+	req := NewCreateAddressPayload(2, "order 1")
+	assert.Equal(t, "0", req.ID)
+	assert.Equal(t, "2.0", req.JSONRPC)
+	assert.Equal(t, "create_address", req.Method)
+	params, ok := req.Params.(CreateAddressParams)
+	assert.True(t, ok)
+	assert.Equal(t, 2, params.AccountIndex)
+	assert.Equal(t, "order 1", params.Label)
+}
+
+func TestCreateAddressSuccess(t *testing.T) {
+	jsonResp := `
+		{
+			"result": {
+				"address": "7BG5jr9QS5sGMdpbBrZEwVLZjSKJGJBsXdZLt8wiXyhfLUy3fz4GdMEbuQ8ojyMEunBhjsmdMtnfz4L8Jz4S1u3iKwSkq2e",
+				"address_index": 5
+			}
+		}
+	`
+	server := makeServer(t, "/json_rpc", "POST", "", 200, jsonResp)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	client.HTTPClient = server.Client()
+
+	addr, err := client.CreateAddress(context.Background(), 0, "label")
+	assert.Nil(t, err)
+	assert.Equal(t, "7BG5jr9QS5sGMdpbBrZEwVLZjSKJGJBsXdZLt8wiXyhfLUy3fz4GdMEbuQ8ojyMEunBhjsmdMtnfz4L8Jz4S1u3iKwSkq2e", addr.Address)
+	assert.Equal(t, 5, addr.AddressIndex)
+}
+
+func TestCreateAddressErrors(t *testing.T) {
+	errorCases := []struct {
+		Description string
+		RespCode    int
+		JSONResp    string
+	}{
+		{"Unexpected HTTP error", 500, ""},
+		{"Malformed response payload", 200, "[]"},
+		{"RPC Error", 200, `{"error": {"code": -13, "message": "No wallet file"}}`},
+	}
+	for _, c := range errorCases {
+		t.Run(c.Description, func(t *testing.T) {
+			server := makeServer(t, "/json_rpc", "POST", "", c.RespCode, c.JSONResp)
+			defer server.Close()
+
+			client := NewRPCClient(server.URL)
+			client.HTTPClient = server.Client()
+
+			addr, err := client.CreateAddress(context.Background(), 0, "")
+			assert.Nil(t, addr)
+			assert.Error(t, err)
+		})
+	}
+}
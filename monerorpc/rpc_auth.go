@@ -0,0 +1,153 @@
+package monerorpc
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DigestTransport authenticates requests with HTTP Digest authentication
+// (RFC 2617, MD5 with qop=auth), which is what monero-wallet-rpc and
+// monerod use for --rpc-login.
+// The last challenge is reused, so only the first request needs an extra
+// round trip.
+type DigestTransport struct {
+	Username  string
+	Password  string
+	Transport http.RoundTripper
+
+	mu        sync.Mutex
+	challenge map[string]string
+	nc        int
+}
+
+func (t *DigestTransport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+	return t.Transport
+}
+
+// parseDigestChallenge parses the parameters of a WWW-Authenticate header.
+// It returns nil if it's not a Digest challenge.
+func parseDigestChallenge(header string) map[string]string {
+	const prefix = "Digest "
+	if !strings.HasPrefix(header, prefix) {
+		return nil
+	}
+
+	params := map[string]string{}
+	for _, part := range splitDigestParams(header[len(prefix):]) {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+	return params
+}
+
+// splitDigestParams splits on the commas that are not quoted
+func splitDigestParams(s string) []string {
+	parts := []string{}
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *DigestTransport) authorization(req *http.Request) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.challenge == nil {
+		return "", false
+	}
+	t.nc++
+
+	cnonceBytes := make([]byte, 8)
+	rand.Read(cnonceBytes)
+	cnonce := hex.EncodeToString(cnonceBytes)
+	nc := fmt.Sprintf("%08x", t.nc)
+
+	realm, nonce, opaque := t.challenge["realm"], t.challenge["nonce"], t.challenge["opaque"]
+	uri := req.URL.RequestURI()
+	ha1 := md5Hex(fmt.Sprintf("%s:%s:%s", t.Username, realm, t.Password))
+	ha2 := md5Hex(fmt.Sprintf("%s:%s", req.Method, uri))
+
+	var response string
+	qop := ""
+	if strings.Contains(t.challenge["qop"], "auth") {
+		qop = "auth"
+		response = md5Hex(fmt.Sprintf("%s:%s:%s:%s:%s:%s", ha1, nonce, nc, cnonce, qop, ha2))
+	} else {
+		response = md5Hex(fmt.Sprintf("%s:%s:%s", ha1, nonce, ha2))
+	}
+
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=MD5, response="%s"`,
+		t.Username, realm, nonce, uri, response)
+	if qop != "" {
+		auth += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+	if opaque != "" {
+		auth += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return auth, true
+}
+
+func (t *DigestTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+
+	if auth, ok := t.authorization(req); ok {
+		req.Header.Set("Authorization", auth)
+	}
+	return t.transport().RoundTrip(req)
+}
+
+func (t *DigestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.roundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge := parseDigestChallenge(resp.Header.Get("WWW-Authenticate"))
+	if challenge == nil {
+		return resp, nil
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// The server sent a new challenge, either because this is the first
+	// request or because the nonce expired
+	t.mu.Lock()
+	t.challenge = challenge
+	t.nc = 0
+	t.mu.Unlock()
+
+	return t.roundTrip(req)
+}
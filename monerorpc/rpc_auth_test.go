@@ -0,0 +1,81 @@
+package monerorpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// makeDigestServer emulates the Digest authentication of monero-wallet-rpc
+func makeDigestServer(t *testing.T, username, password, respBody string) (*httptest.Server, *int) {
+	const realm, nonce = "monero-rpc", "dcd98b7102dd2f0e8b11d0f600bfb0c093"
+	challenges := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		params := parseDigestChallenge(req.Header.Get("Authorization"))
+		if params == nil {
+			challenges++
+			rw.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest qop="auth",algorithm=MD5,realm="%s",nonce="%s",stale=false`, realm, nonce))
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ha1 := md5Hex(fmt.Sprintf("%s:%s:%s", username, realm, password))
+		ha2 := md5Hex(fmt.Sprintf("%s:%s", req.Method, params["uri"]))
+		expected := md5Hex(fmt.Sprintf("%s:%s:%s:%s:%s:%s", ha1, nonce, params["nc"], params["cnonce"], params["qop"], ha2))
+		if params["username"] != username || params["response"] != expected {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		rw.WriteHeader(200)
+		rw.Write([]byte(respBody))
+	}))
+	return server, &challenges
+}
+
+func TestDigestTransport(t *testing.T) {
+	server, challenges := makeDigestServer(t, "user", "pass", `{"result": {"height": 300}}`)
+	defer server.Close()
+
+	client := NewAuthenticatedRPCClient(server.URL, "user", "pass")
+
+	ctx := context.Background()
+	height, err := client.GetHeight(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 300, height)
+
+	// The challenge is reused
+	height, err = client.GetHeight(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 300, height)
+	assert.Equal(t, 1, *challenges)
+}
+
+func TestDigestTransportWrongCredentials(t *testing.T) {
+	server, _ := makeDigestServer(t, "user", "pass", `{"result": {"height": 300}}`)
+	defer server.Close()
+
+	client := NewAuthenticatedRPCClient(server.URL, "user", "wrong")
+	_, err := client.GetHeight(context.Background())
+	assert.Error(t, err)
+
+	// Without credentials the challenge is not answered
+	client = NewRPCClient(server.URL)
+	_, err = client.GetHeight(context.Background())
+	assert.Error(t, err)
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	params := parseDigestChallenge(`Digest qop="auth,auth-int",realm="a, b",nonce="abc", opaque=xyz`)
+	assert.Equal(t, "auth,auth-int", params["qop"])
+	assert.Equal(t, "a, b", params["realm"])
+	assert.Equal(t, "abc", params["nonce"])
+	assert.Equal(t, "xyz", params["opaque"])
+
+	assert.Nil(t, parseDigestChallenge(`Basic realm="x"`))
+}
@@ -0,0 +1,248 @@
+package monerorpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// BlockGetter fetches blocks from a Monero Daemon
+type BlockGetter interface {
+	GetBlockByHash(context.Context, string) (*RpcBlock, error)
+	GetBlockHeadersRange(context.Context, int, int) ([]RpcBlockHeader, error)
+}
+
+// BlocksGetter fetches several blocks at once, e.g. in a single batch
+// request
+type BlocksGetter interface {
+	GetBlocksByHash(context.Context, []string) ([]*RpcBlock, error)
+}
+
+// GetBlocks fetches the blocks in a single call when the getter supports it,
+// one by one otherwise
+func GetBlocks(ctx context.Context, bg BlockGetter, hashes []string) ([]*RpcBlock, error) {
+	if batch, ok := bg.(BlocksGetter); ok {
+		return batch.GetBlocksByHash(ctx, hashes)
+	}
+
+	blocks := make([]*RpcBlock, 0, len(hashes))
+	for _, hash := range hashes {
+		b, err := bg.GetBlockByHash(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+type RpcBlockHeader struct {
+	Hash      string `json:"hash"`
+	Height    int    `json:"Height"`
+	Timestamp int    `json:"timestamp"`
+	PrevHash  string `json:"prev_hash"`
+}
+
+type RpcBlockHeaders struct {
+	Headers []RpcBlockHeader `json:"headers"`
+}
+
+type RpcBlock struct {
+	BlockHeader RpcBlockHeader `json:"block_header"`
+	TxHashes    []string       `json:"tx_hashes"`
+}
+
+type GetBlockParams struct {
+	Hash string `json:"hash"`
+}
+
+func NewGetBlockPayload(hash string) RPCRequestPayload {
+	return RPCRequestPayload{
+		ID:      "0",
+		JSONRPC: "2.0",
+		Method:  "get_block",
+		Params: GetBlockParams{
+			Hash: hash,
+		},
+	}
+}
+
+func blockCacheKey(hash string) string {
+	return "get_block:" + hash
+}
+
+func headerCacheKey(height int) string {
+	return fmt.Sprintf("header:%d", height)
+}
+
+// cachedBlock returns a copy of the cached block, so that callers can't
+// alter the cache
+func (c *RPCClient) cachedBlock(hash string) (*RpcBlock, bool) {
+	if c.Cache == nil {
+		return nil, false
+	}
+	v, ok := c.Cache.Get(blockCacheKey(hash))
+	if !ok {
+		return nil, false
+	}
+	b := v.(RpcBlock)
+	b.TxHashes = append([]string{}, b.TxHashes...)
+	return &b, true
+}
+
+// cacheBlock stores the block. A block fetched by hash never changes, even
+// when it gets orphaned.
+func (c *RPCClient) cacheBlock(b *RpcBlock) {
+	c.observeHeight(b.BlockHeader.Height)
+	if c.Cache == nil {
+		return
+	}
+	stored := *b
+	stored.TxHashes = append([]string{}, b.TxHashes...)
+	c.Cache.Add(blockCacheKey(b.BlockHeader.Hash), stored)
+}
+
+func (c *RPCClient) GetBlockByHash(ctx context.Context, hash string) (*RpcBlock, error) {
+	if b, ok := c.cachedBlock(hash); ok {
+		return b, nil
+	}
+
+	rpcReq := NewGetBlockPayload(hash)
+	rpcBlock := RpcBlock{}
+	err := c.MakeRequest(ctx, rpcReq, &rpcBlock)
+	if err != nil {
+		return nil, err
+	}
+	c.cacheBlock(&rpcBlock)
+	return &rpcBlock, nil
+}
+
+// GetBlocksByHash fetches the blocks the cache doesn't have in a single
+// batch request
+func (c *RPCClient) GetBlocksByHash(ctx context.Context, hashes []string) ([]*RpcBlock, error) {
+	blocks := make([]*RpcBlock, len(hashes))
+	calls, idx := []*RPCBatchCall{}, []int{}
+	for i, hash := range hashes {
+		if b, ok := c.cachedBlock(hash); ok {
+			blocks[i] = b
+			continue
+		}
+		calls = append(calls, &RPCBatchCall{Request: NewGetBlockPayload(hash), Result: &RpcBlock{}})
+		idx = append(idx, i)
+	}
+
+	if err := c.MakeBatchRequest(ctx, calls); err != nil {
+		return nil, err
+	}
+
+	for i, call := range calls {
+		if call.Err != nil {
+			return nil, fmt.Errorf("Unable to get block %s: %w", hashes[idx[i]], call.Err)
+		}
+		b := call.Result.(*RpcBlock)
+		c.cacheBlock(b)
+		blocks[idx[i]] = b
+	}
+	return blocks, nil
+}
+
+type GetBlocksRangeParams struct {
+	StartHeight int `json:"start_height"`
+	EndHeight   int `json:"end_height"`
+}
+
+func NewGetBlocksRangePayload(start, end int) RPCRequestPayload {
+	return RPCRequestPayload{
+		ID:      "0",
+		JSONRPC: "2.0",
+		Method:  "get_block_headers_range",
+		Params: GetBlocksRangeParams{
+			StartHeight: start,
+			EndHeight:   end,
+		},
+	}
+}
+
+// cachedHeaders returns the headers of the range, if they're all cached
+func (c *RPCClient) cachedHeaders(start, end int) ([]RpcBlockHeader, bool) {
+	if c.Cache == nil || end < start {
+		return nil, false
+	}
+
+	headers := []RpcBlockHeader{}
+	for height := start; height <= end; height++ {
+		v, ok := c.Cache.Get(headerCacheKey(height))
+		if !ok {
+			return nil, false
+		}
+		headers = append(headers, v.(RpcBlockHeader))
+	}
+	return headers, true
+}
+
+// GetBlockHeadersRange caches the headers once they're FinalityDepth blocks
+// deep, since the ones above may still be replaced by a reorg. Ranges
+// larger than the daemon serves at once are split. A daemon that wasn't
+// probed is probed the first time such a range fails, and the range is
+// requested again if it turns out to be restricted.
+func (c *RPCClient) GetBlockHeadersRange(ctx context.Context, start, end int) ([]RpcBlockHeader, error) {
+	headers, err := c.getBlockHeadersRanges(ctx, start, end)
+	if err == nil || c.Capabilities() != nil || end-start+1 <= restrictedHeaderRangeLimit {
+		return headers, err
+	}
+
+	caps, probeErr := c.Probe(ctx)
+	if probeErr != nil || caps.HeaderRangeLimit <= 0 {
+		return nil, err
+	}
+	log.Printf("Daemon %s runs with restricted RPC: block header ranges are fetched %d at a time", c.Host, caps.HeaderRangeLimit)
+	return c.getBlockHeadersRanges(ctx, start, end)
+}
+
+func (c *RPCClient) getBlockHeadersRanges(ctx context.Context, start, end int) ([]RpcBlockHeader, error) {
+	limit := 0
+	if caps := c.Capabilities(); caps != nil {
+		limit = caps.HeaderRangeLimit
+	}
+	if limit <= 0 || end-start+1 <= limit {
+		return c.getBlockHeadersRange(ctx, start, end)
+	}
+
+	headers := []RpcBlockHeader{}
+	for from := start; from <= end; from += limit {
+		to := from + limit - 1
+		if to > end {
+			to = end
+		}
+		chunk, err := c.getBlockHeadersRange(ctx, from, to)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, chunk...)
+	}
+	return headers, nil
+}
+
+func (c *RPCClient) getBlockHeadersRange(ctx context.Context, start, end int) ([]RpcBlockHeader, error) {
+	if headers, ok := c.cachedHeaders(start, end); ok {
+		return headers, nil
+	}
+
+	rpcReq := NewGetBlocksRangePayload(start, end)
+	rpcBlocks := RpcBlockHeaders{}
+	if err := c.MakeRequest(ctx, rpcReq, &rpcBlocks); err != nil {
+		return nil, err
+	}
+
+	for _, h := range rpcBlocks.Headers {
+		c.observeHeight(h.Height)
+	}
+	if c.Cache != nil {
+		for _, h := range rpcBlocks.Headers {
+			if c.isFinal(h.Height) {
+				c.Cache.Add(headerCacheKey(h.Height), h)
+			}
+		}
+	}
+	return rpcBlocks.Headers, nil
+}
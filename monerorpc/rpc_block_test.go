@@ -1,8 +1,11 @@
-package main
+package monerorpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -167,3 +170,131 @@ func TestGetBlockHeadersRangeErrors(t *testing.T) {
 		})
 	}
 }
+
+// makeBlocksServer serves get_block and get_block_headers_range for a chain
+// of the given length, counting the requests it gets
+func makeBlocksServer(t *testing.T, chainLength int, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		*requests++
+
+		raw := json.RawMessage{}
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&raw))
+		batch := []map[string]json.RawMessage{}
+		isBatch := json.Unmarshal(raw, &batch) == nil
+		if !isBatch {
+			single := map[string]json.RawMessage{}
+			assert.Nil(t, json.Unmarshal(raw, &single))
+			batch = append(batch, single)
+		}
+
+		resps := []map[string]interface{}{}
+		for _, r := range batch {
+			var result interface{}
+			switch string(r["method"]) {
+			case `"get_block"`:
+				params := GetBlockParams{}
+				assert.Nil(t, json.Unmarshal(r["params"], &params))
+				result = RpcBlock{BlockHeader: RpcBlockHeader{Hash: params.Hash, Height: chainLength - 1}, TxHashes: []string{"tx"}}
+			case `"get_block_headers_range"`:
+				params := GetBlocksRangeParams{}
+				assert.Nil(t, json.Unmarshal(r["params"], &params))
+				headers := []RpcBlockHeader{}
+				for h := params.StartHeight; h <= params.EndHeight; h++ {
+					headers = append(headers, RpcBlockHeader{Hash: fmt.Sprintf("hash%d", h), Height: h})
+				}
+				result = RpcBlockHeaders{Headers: headers}
+			}
+			resps = append(resps, map[string]interface{}{"id": r["id"], "result": result})
+		}
+
+		if isBatch {
+			json.NewEncoder(rw).Encode(resps)
+		} else {
+			json.NewEncoder(rw).Encode(resps[0])
+		}
+	}))
+}
+
+func TestGetBlockByHashCache(t *testing.T) {
+	requests := 0
+	server := makeBlocksServer(t, 100, &requests)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	client.Cache = NewRPCCache(10)
+
+	for i := 0; i < 3; i++ {
+		block, err := client.GetBlockByHash(context.Background(), "hash")
+		assert.Nil(t, err)
+		assert.Equal(t, "hash", block.BlockHeader.Hash)
+
+		// Changing the returned block doesn't change the cached one
+		block.TxHashes[0] = "changed"
+	}
+	assert.Equal(t, 1, requests)
+
+	block, _ := client.GetBlockByHash(context.Background(), "hash")
+	assert.Equal(t, "tx", block.TxHashes[0])
+}
+
+func TestGetBlocksByHash(t *testing.T) {
+	requests := 0
+	server := makeBlocksServer(t, 100, &requests)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	client.Cache = NewRPCCache(10)
+
+	_, err := client.GetBlockByHash(context.Background(), "b")
+	assert.Nil(t, err)
+
+	blocks, err := client.GetBlocksByHash(context.Background(), []string{"a", "b", "c"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(blocks))
+	for i, hash := range []string{"a", "b", "c"} {
+		assert.Equal(t, hash, blocks[i].BlockHeader.Hash)
+	}
+	// One request for b, and one batch for a and c
+	assert.Equal(t, 2, requests)
+
+	_, err = client.GetBlocksByHash(context.Background(), []string{"a", "c"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestGetBlockHeadersRangeCache(t *testing.T) {
+	requests := 0
+	server := makeBlocksServer(t, 100, &requests)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	client.Cache = NewRPCCache(100)
+
+	// The tip is unknown yet, so nothing is final
+	_, err := client.GetBlockHeadersRange(context.Background(), 50, 60)
+	assert.Nil(t, err)
+	_, err = client.GetBlockHeadersRange(context.Background(), 50, 60)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, requests)
+
+	// Learn that the tip is at 99
+	_, err = client.GetBlockByHash(context.Background(), "tip")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, requests)
+
+	headers, err := client.GetBlockHeadersRange(context.Background(), 80, 95)
+	assert.Nil(t, err)
+	assert.Equal(t, 16, len(headers))
+	assert.Equal(t, 4, requests)
+
+	// Headers up to 89 are final, and then cached
+	headers, err = client.GetBlockHeadersRange(context.Background(), 80, 89)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(headers))
+	assert.Equal(t, "hash80", headers[0].Hash)
+	assert.Equal(t, 4, requests)
+
+	_, err = client.GetBlockHeadersRange(context.Background(), 85, 90)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, requests)
+}
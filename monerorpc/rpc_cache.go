@@ -0,0 +1,66 @@
+package monerorpc
+
+import (
+	"container/list"
+	"sync"
+)
+
+// RPCCache is a fixed size LRU cache for RPC results that can't change,
+// e.g. blocks fetched by hash
+type RPCCache struct {
+	Size int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type rpcCacheEntry struct {
+	Key   string
+	Value interface{}
+}
+
+func NewRPCCache(size int) *RPCCache {
+	return &RPCCache{
+		Size:  size,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+func (c *RPCCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*rpcCacheEntry).Value, true
+}
+
+// Add stores the value, evicting the least recently used one when full
+func (c *RPCCache) Add(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value.(*rpcCacheEntry).Value = value
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&rpcCacheEntry{Key: key, Value: value})
+	for c.ll.Len() > c.Size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*rpcCacheEntry).Key)
+	}
+}
+
+func (c *RPCCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
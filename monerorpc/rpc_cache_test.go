@@ -0,0 +1,30 @@
+package monerorpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRPCCache(t *testing.T) {
+	c := NewRPCCache(2)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	// b is the least recently used one
+	c.Add("c", 3)
+	assert.Equal(t, 2, c.Len())
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+
+	c.Add("c", 4)
+	v, _ = c.Get("c")
+	assert.Equal(t, 4, v)
+	assert.Equal(t, 2, c.Len())
+}
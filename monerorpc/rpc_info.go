@@ -0,0 +1,33 @@
+package monerorpc
+
+import "context"
+
+type RpcInfo struct {
+	Height       int    `json:"height"`
+	TargetHeight int    `json:"target_height"`
+	Synchronized bool   `json:"synchronized"`
+	Status       string `json:"status"`
+	Restricted   bool   `json:"restricted"`
+	Version      string `json:"version"`
+}
+
+func NewGetInfoPayload() RPCRequestPayload {
+	return RPCRequestPayload{
+		ID:      "0",
+		JSONRPC: "2.0",
+		Method:  "get_info",
+		Params:  struct{}{},
+	}
+}
+
+// GetInfo returns the general state of the Monero Daemon
+func (c *RPCClient) GetInfo(ctx context.Context) (*RpcInfo, error) {
+	rpcReq := NewGetInfoPayload()
+	info := RpcInfo{}
+	if err := c.MakeRequest(ctx, rpcReq, &info); err != nil {
+		return nil, err
+	}
+	// Height is the length of the chain, the top block is one below it
+	c.observeHeight(info.Height - 1)
+	return &info, nil
+}
@@ -0,0 +1,64 @@
+package monerorpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewGetInfoPayload(t *testing.T) {
+	req := NewGetInfoPayload()
+	assert.Equal(t, "0", req.ID)
+	assert.Equal(t, "2.0", req.JSONRPC)
+	assert.Equal(t, "get_info", req.Method)
+}
+
+func TestGetInfoSuccess(t *testing.T) {
+	jsonResp := `
+		{
+			"result": {
+				"height": 2300000,
+				"target_height": 2300001,
+				"synchronized": true,
+				"status": "OK"
+			}
+		}
+	`
+	server := makeServer(t, "/json_rpc", "POST", "", 200, jsonResp)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	client.HTTPClient = server.Client()
+
+	info, err := client.GetInfo(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2300000, info.Height)
+	assert.Equal(t, 2300001, info.TargetHeight)
+	assert.True(t, info.Synchronized)
+}
+
+func TestGetInfoErrors(t *testing.T) {
+	errorCases := []struct {
+		Description string
+		RespCode    int
+		JSONResp    string
+	}{
+		{"Unexpected HTTP error", 500, ""},
+		{"Malformed response payload", 200, "[]"},
+		{"RPC Error", 200, `{"error": {"code": -32601, "message": "Method not found"}}`},
+	}
+	for _, c := range errorCases {
+		t.Run(c.Description, func(t *testing.T) {
+			server := makeServer(t, "/json_rpc", "POST", "", c.RespCode, c.JSONResp)
+			defer server.Close()
+
+			client := NewRPCClient(server.URL)
+			client.HTTPClient = server.Client()
+
+			info, err := client.GetInfo(context.Background())
+			assert.Nil(t, info)
+			assert.Error(t, err)
+		})
+	}
+}
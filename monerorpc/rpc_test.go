@@ -0,0 +1,149 @@
+package monerorpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeServer(t *testing.T, expectedURL string, expectedMethod string, expectedTXID string, respStatus int, respBody string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// Make sure we're using the expected URL and HTTP method
+		assert.Equal(t, expectedURL, req.URL.String())
+		assert.Equal(t, expectedMethod, req.Method)
+
+		// Make sure we're passing the expected request body
+		// reqData := RpcRequest{}
+		// err := json.NewDecoder(req.Body).Decode(&reqData)
+		// assert.Nil(t, err)
+		// assert.Equal(t, expectedTXID, reqData.Params.TXID)
+		assert.Equal(t, "application/json", req.Header["Content-Type"][0])
+
+		rw.WriteHeader(respStatus)
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte(respBody))
+	}))
+}
+
+// makeEchoServer answers every request with its own params as the result.
+// Batches are answered in reverse order, and the requests are recorded.
+func makeEchoServer(t *testing.T, reqs *[]RPCRequestPayload) *httptest.Server {
+	mu := sync.Mutex{}
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		raw := json.RawMessage{}
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&raw))
+
+		batch := []RPCRequestPayload{}
+		isBatch := json.Unmarshal(raw, &batch) == nil
+		if !isBatch {
+			single := RPCRequestPayload{}
+			assert.Nil(t, json.Unmarshal(raw, &single))
+			batch = append(batch, single)
+		}
+
+		mu.Lock()
+		*reqs = append(*reqs, batch...)
+		mu.Unlock()
+
+		resps := []map[string]interface{}{}
+		for i := len(batch) - 1; i >= 0; i-- {
+			r := map[string]interface{}{"id": batch[i].ID, "jsonrpc": "2.0"}
+			if batch[i].Method == "fail" {
+				r["error"] = map[string]interface{}{"code": -1, "message": "failed"}
+			} else {
+				r["result"] = batch[i].Params
+			}
+			resps = append(resps, r)
+		}
+
+		if isBatch {
+			json.NewEncoder(rw).Encode(resps)
+		} else {
+			json.NewEncoder(rw).Encode(resps[0])
+		}
+	}))
+}
+
+type echoParams struct {
+	Value string `json:"value"`
+}
+
+func newEchoPayload(method, value string) RPCRequestPayload {
+	return RPCRequestPayload{ID: "0", JSONRPC: "2.0", Method: method, Params: echoParams{value}}
+}
+
+func TestMakeRequestUniqueIDs(t *testing.T) {
+	reqs := []RPCRequestPayload{}
+	server := makeEchoServer(t, &reqs)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	for i := 0; i < 3; i++ {
+		result := echoParams{}
+		assert.Nil(t, client.MakeRequest(context.Background(), newEchoPayload("echo", "v"), &result))
+		assert.Equal(t, "v", result.Value)
+	}
+
+	ids := map[string]bool{}
+	for _, r := range reqs {
+		ids[r.ID] = true
+	}
+	assert.Equal(t, 3, len(ids))
+}
+
+func TestMakeRequestMismatchedID(t *testing.T) {
+	server := makeServer(t, "/json_rpc", "POST", "", 200, `{"id": "other", "result": {}}`)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	result := echoParams{}
+	assert.Error(t, client.MakeRequest(context.Background(), newEchoPayload("echo", "v"), &result))
+}
+
+func TestMakeBatchRequest(t *testing.T) {
+	reqs := []RPCRequestPayload{}
+	server := makeEchoServer(t, &reqs)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	calls := []*RPCBatchCall{}
+	for i := 0; i < 3; i++ {
+		calls = append(calls, &RPCBatchCall{Request: newEchoPayload("echo", fmt.Sprintf("v%d", i)), Result: &echoParams{}})
+	}
+	calls = append(calls, &RPCBatchCall{Request: newEchoPayload("fail", "x"), Result: &echoParams{}})
+
+	assert.Nil(t, client.MakeBatchRequest(context.Background(), calls))
+	assert.Equal(t, 4, len(reqs))
+
+	// Responses came back in reverse order
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, calls[i].Err)
+		assert.Equal(t, fmt.Sprintf("v%d", i), calls[i].Result.(*echoParams).Value)
+	}
+	assert.Error(t, calls[3].Err)
+
+	t.Run("Missing responses", func(t *testing.T) {
+		server := makeServer(t, "/json_rpc", "POST", "", 200, `[]`)
+		defer server.Close()
+
+		client := NewRPCClient(server.URL)
+		calls := []*RPCBatchCall{{Request: newEchoPayload("echo", "v"), Result: &echoParams{}}}
+		assert.Nil(t, client.MakeBatchRequest(context.Background(), calls))
+		assert.Error(t, calls[0].Err)
+	})
+
+	t.Run("Batches not supported", func(t *testing.T) {
+		server := makeServer(t, "/json_rpc", "POST", "", 200, `{"error": {"code": -32600, "message": "Invalid Request"}}`)
+		defer server.Close()
+
+		client := NewRPCClient(server.URL)
+		calls := []*RPCBatchCall{{Request: newEchoPayload("echo", "v"), Result: &echoParams{}}}
+		assert.Error(t, client.MakeBatchRequest(context.Background(), calls))
+	})
+}
@@ -0,0 +1,209 @@
+package monerorpc
+
+import "context"
+
+// TxGetter fetches the transfers of a Tx from a Monero Wallet
+type TxGetter interface {
+	GetTransferByTxid(context.Context, string) ([]RpcTx, error)
+	GetAddressLabel(context.Context, int, int) (string, error)
+}
+
+type RpcSubaddressIndex struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+}
+
+type RpcTx struct {
+	TXID            string               `json:"txid"`
+	Address         string               `json:"address"`
+	Amount          uint64               `json:"amount"`
+	Confirmations   int                  `json:"confirmations"`
+	Height          int                  `json:"height"`
+	Timestamp       int                  `json:"timestamp"`
+	UnlockTime      int                  `json:"unlock_time"`
+	Type            string               `json:"type"`
+	SubaddrIndex    RpcSubaddressIndex   `json:"subaddr_index"`
+	SubaddrIndices  []RpcSubaddressIndex `json:"subaddr_indices"`
+	PaymentID       string               `json:"payment_id"`
+	Note            string               `json:"note"`
+	Fee             uint64               `json:"fee"`
+	Locked          bool                 `json:"locked"`
+	DoubleSpendSeen bool                 `json:"double_spend_seen"`
+}
+
+func (t *RpcTx) IsIncoming() bool {
+	validTypes := map[string]int{"in": 1, "pool": 1}
+	_, ok := validTypes[t.Type]
+	return ok
+}
+
+// RpcResultTransfers holds both shapes of the get_transfer_by_txid result.
+// Newer wallets return every transfer in "transfers", and the first one
+// again in "transfer"; older ones only return "transfer".
+type RpcResultTransfers struct {
+	Transfer  *RpcTx  `json:"transfer"`
+	Transfers []RpcTx `json:"transfers"`
+}
+
+// All merges both shapes of the result, without repeating the transfer
+// that newer wallets return in both
+func (r *RpcResultTransfers) All() []RpcTx {
+	if r.Transfer == nil {
+		return r.Transfers
+	}
+
+	for _, t := range r.Transfers {
+		if t.Type == r.Transfer.Type && t.Address == r.Transfer.Address && t.Amount == r.Transfer.Amount && t.SubaddrIndex == r.Transfer.SubaddrIndex {
+			return r.Transfers
+		}
+	}
+	return append([]RpcTx{*r.Transfer}, r.Transfers...)
+}
+
+type GetTransferParams struct {
+	TXID string `json:"txid"`
+}
+
+func NewGetTransferPayload(txid string) RPCRequestPayload {
+	return RPCRequestPayload{
+		ID:      "0",
+		JSONRPC: "2.0",
+		Method:  "get_transfer_by_txid",
+		Params: GetTransferParams{
+			TXID: txid,
+		},
+	}
+}
+
+func (c *RPCClient) GetTransferByTxid(ctx context.Context, txid string) ([]RpcTx, error) {
+	rpcReq := NewGetTransferPayload(txid)
+	result := RpcResultTransfers{}
+	err := c.MakeRequest(ctx, rpcReq, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result.All(), nil
+}
+
+type GetAddressParams struct {
+	AccountIndex int   `json:"account_index"`
+	AddressIndex []int `json:"address_index"`
+}
+
+type RpcAddress struct {
+	Address      string `json:"address"`
+	AddressIndex int    `json:"address_index"`
+	Label        string `json:"label"`
+	Used         bool   `json:"used"`
+}
+
+type RpcResultAddresses struct {
+	Address   string       `json:"address"`
+	Addresses []RpcAddress `json:"addresses"`
+}
+
+func NewGetAddressPayload(accountIndex int, addressIndices []int) RPCRequestPayload {
+	return RPCRequestPayload{
+		ID:      "0",
+		JSONRPC: "2.0",
+		Method:  "get_address",
+		Params: GetAddressParams{
+			AccountIndex: accountIndex,
+			AddressIndex: addressIndices,
+		},
+	}
+}
+
+// GetAddressLabel returns the label of the given subaddress. Labels are
+// cached for the lifetime of the client, as they are rarely updated.
+func (c *RPCClient) GetAddressLabel(ctx context.Context, accountIndex, addressIndex int) (string, error) {
+	idx := RpcSubaddressIndex{Major: accountIndex, Minor: addressIndex}
+
+	c.labelsMu.Lock()
+	label, ok := c.labels[idx]
+	c.labelsMu.Unlock()
+	if ok {
+		return label, nil
+	}
+
+	rpcReq := NewGetAddressPayload(accountIndex, []int{addressIndex})
+	result := RpcResultAddresses{}
+	if err := c.MakeRequest(ctx, rpcReq, &result); err != nil {
+		return "", err
+	}
+
+	for _, addr := range result.Addresses {
+		if addr.AddressIndex == addressIndex {
+			label = addr.Label
+		}
+	}
+
+	c.labelsMu.Lock()
+	if c.labels == nil {
+		c.labels = map[RpcSubaddressIndex]string{}
+	}
+	c.labels[idx] = label
+	c.labelsMu.Unlock()
+
+	return label, nil
+}
+
+type GetTransfersParams struct {
+	In             bool `json:"in"`
+	Pool           bool `json:"pool"`
+	FilterByHeight bool `json:"filter_by_height"`
+	MinHeight      int  `json:"min_height"`
+}
+
+type RpcResultIncomingTransfers struct {
+	In   []RpcTx `json:"in"`
+	Pool []RpcTx `json:"pool"`
+}
+
+func NewGetTransfersPayload(minHeight int) RPCRequestPayload {
+	return RPCRequestPayload{
+		ID:      "0",
+		JSONRPC: "2.0",
+		Method:  "get_transfers",
+		Params: GetTransfersParams{
+			In:             true,
+			Pool:           true,
+			FilterByHeight: true,
+			MinHeight:      minHeight,
+		},
+	}
+}
+
+// GetIncomingTransfers returns the incoming transfers above minHeight
+// (excluded), along with the ones still in the pool
+func (c *RPCClient) GetIncomingTransfers(ctx context.Context, minHeight int) ([]RpcTx, error) {
+	rpcReq := NewGetTransfersPayload(minHeight)
+	result := RpcResultIncomingTransfers{}
+	if err := c.MakeRequest(ctx, rpcReq, &result); err != nil {
+		return nil, err
+	}
+	return append(result.In, result.Pool...), nil
+}
+
+type RpcResultHeight struct {
+	Height int `json:"height"`
+}
+
+func NewGetHeightPayload() RPCRequestPayload {
+	return RPCRequestPayload{
+		ID:      "0",
+		JSONRPC: "2.0",
+		Method:  "get_height",
+		Params:  struct{}{},
+	}
+}
+
+// GetHeight returns the wallet's current blockchain height
+func (c *RPCClient) GetHeight(ctx context.Context) (int, error) {
+	rpcReq := NewGetHeightPayload()
+	result := RpcResultHeight{}
+	if err := c.MakeRequest(ctx, rpcReq, &result); err != nil {
+		return 0, err
+	}
+	return result.Height, nil
+}
@@ -0,0 +1,260 @@
+package monerorpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewGetTransferPayload(t *testing.T) {
+	txid := "dummy txid"
+	req := NewGetTransferPayload(txid)
+	assert.Equal(t, "0", req.ID)
+	assert.Equal(t, "2.0", req.JSONRPC)
+	assert.Equal(t, "get_transfer_by_txid", req.Method)
+	params, ok := req.Params.(GetTransferParams)
+	assert.True(t, ok)
+	assert.Equal(t, txid, params.TXID)
+}
+
+func TestGetTransferByTxidSuccess(t *testing.T) {
+	txid := "3c05afeedd910877a9f23e25de2204fdb85b4b26c0d7da74fdea1a8ff25bddf3"
+	jsonResp := fmt.Sprintf(`
+		{
+			"result": {
+				"transfers": [
+					{
+						"txid": "%s",
+						"height": 300,
+						"timestamp": 1535918400,
+						"address": "addr1",
+						"amount": 1,
+						"confirmations": 20,
+						"subaddr_index": {"major": 0, "minor": 7},
+						"payment_id": "1234567890abcdef",
+						"fee": 30,
+						"double_spend_seen": false
+					},
+					{
+						"txid": "%s",
+						"height": 300,
+						"timestamp": 1535918400,
+						"address": "addr2",
+						"amount": 2,
+						"confirmations": 20
+					}
+				]
+			}
+		}
+	`, txid, txid)
+	server := makeServer(t, "/json_rpc", "POST", txid, 200, jsonResp)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	client.HTTPClient = server.Client()
+
+	ctx := context.Background()
+	transfers, err := client.GetTransferByTxid(ctx, txid)
+	assert.Nil(t, err)
+	assert.Equal(t, txid, transfers[0].TXID)
+	assert.Equal(t, txid, transfers[1].TXID)
+	assert.Equal(t, "addr1", transfers[0].Address)
+	assert.Equal(t, "addr2", transfers[1].Address)
+	assert.Equal(t, uint64(1), transfers[0].Amount)
+	assert.Equal(t, uint64(2), transfers[1].Amount)
+	assert.Equal(t, RpcSubaddressIndex{Major: 0, Minor: 7}, transfers[0].SubaddrIndex)
+	assert.Equal(t, "1234567890abcdef", transfers[0].PaymentID)
+	assert.Equal(t, uint64(30), transfers[0].Fee)
+}
+
+func TestGetTransferByTxidResponseShapes(t *testing.T) {
+	cases := []struct {
+		Description       string
+		JSONResp          string
+		ExpectedAddresses []string
+	}{
+		{
+			"Only the singular transfer",
+			`{"result": {"transfer": {"txid": "tx", "address": "addr1", "amount": 1, "type": "in"}}}`,
+			[]string{"addr1"},
+		},
+		{
+			"Singular transfer repeated in transfers",
+			`{"result": {
+				"transfer": {"txid": "tx", "address": "addr1", "amount": 1, "type": "in"},
+				"transfers": [
+					{"txid": "tx", "address": "addr1", "amount": 1, "type": "in"},
+					{"txid": "tx", "address": "addr2", "amount": 2, "type": "in"}
+				]
+			}}`,
+			[]string{"addr1", "addr2"},
+		},
+		{
+			"Singular transfer not in transfers",
+			`{"result": {
+				"transfer": {"txid": "tx", "address": "addr1", "amount": 1, "type": "in"},
+				"transfers": [{"txid": "tx", "address": "addr2", "amount": 2, "type": "in"}]
+			}}`,
+			[]string{"addr1", "addr2"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Description, func(t *testing.T) {
+			server := makeServer(t, "/json_rpc", "POST", "tx", 200, c.JSONResp)
+			defer server.Close()
+
+			client := NewRPCClient(server.URL)
+			client.HTTPClient = server.Client()
+
+			transfers, err := client.GetTransferByTxid(context.Background(), "tx")
+			assert.Nil(t, err)
+
+			addresses := []string{}
+			for _, transfer := range transfers {
+				addresses = append(addresses, transfer.Address)
+			}
+			assert.Equal(t, c.ExpectedAddresses, addresses)
+		})
+	}
+}
+
+func TestGetTransferByTxidErrors(t *testing.T) {
+	errorCases := []struct {
+		Description string
+		RespCode    int
+		JSONResp    string
+	}{
+		{"Unexpected HTTP error", 500, ""},
+		{"Malformed response payload", 200, "[]"},
+		{"RPC Error", 200, `{"error": {"code": -8, "message": "some RPC error"}}`},
+	}
+	for _, c := range errorCases {
+		t.Run(c.Description, func(t *testing.T) {
+			txid := "invalid"
+			server := makeServer(t, "/json_rpc", "POST", txid, c.RespCode, c.JSONResp)
+			defer server.Close()
+
+			client := NewRPCClient(server.URL)
+			client.HTTPClient = server.Client()
+
+			ctx := context.Background()
+			tx, err := client.GetTransferByTxid(ctx, txid)
+			assert.Nil(t, tx)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewGetAddressPayload(t *testing.T) {
+	req := NewGetAddressPayload(1, []int{2, 3})
+	assert.Equal(t, "0", req.ID)
+	assert.Equal(t, "2.0", req.JSONRPC)
+	assert.Equal(t, "get_address", req.Method)
+	params, ok := req.Params.(GetAddressParams)
+	assert.True(t, ok)
+	assert.Equal(t, 1, params.AccountIndex)
+	assert.Equal(t, []int{2, 3}, params.AddressIndex)
+}
+
+func TestGetAddressLabel(t *testing.T) {
+	jsonResp := `
+		{
+			"result": {
+				"address": "primary",
+				"addresses": [
+					{"address": "sub", "address_index": 2, "label": "order 1", "used": true}
+				]
+			}
+		}
+	`
+	calls := 0
+	server := makeServer(t, "/json_rpc", "POST", "", 200, jsonResp)
+	defer server.Close()
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		handler.ServeHTTP(rw, req)
+	})
+
+	client := NewRPCClient(server.URL)
+	client.HTTPClient = server.Client()
+
+	ctx := context.Background()
+	label, err := client.GetAddressLabel(ctx, 0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "order 1", label)
+
+	// The label is cached
+	label, err = client.GetAddressLabel(ctx, 0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "order 1", label)
+	assert.Equal(t, 1, calls)
+}
+
+func TestGetAddressLabelErrors(t *testing.T) {
+	server := makeServer(t, "/json_rpc", "POST", "", 200, `{"error": {"code": -2, "message": "address index is out of bound"}}`)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	client.HTTPClient = server.Client()
+
+	label, err := client.GetAddressLabel(context.Background(), 0, 2000)
+	assert.Error(t, err)
+	assert.Equal(t, "", label)
+}
+
+func TestGetIncomingTransfersSuccess(t *testing.T) {
+	jsonResp := `
+		{
+			"result": {
+				"in": [{"txid": "tx1", "height": 300, "address": "addr1", "amount": 1, "type": "in"}],
+				"pool": [{"txid": "tx2", "height": 0, "address": "addr2", "amount": 2, "type": "pool"}]
+			}
+		}
+	`
+	server := makeServer(t, "/json_rpc", "POST", "", 200, jsonResp)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	client.HTTPClient = server.Client()
+
+	transfers, err := client.GetIncomingTransfers(context.Background(), 299)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(transfers))
+	assert.Equal(t, "tx1", transfers[0].TXID)
+	assert.Equal(t, "tx2", transfers[1].TXID)
+
+	params, ok := NewGetTransfersPayload(299).Params.(GetTransfersParams)
+	assert.True(t, ok)
+	assert.True(t, params.In)
+	assert.True(t, params.Pool)
+	assert.True(t, params.FilterByHeight)
+	assert.Equal(t, 299, params.MinHeight)
+}
+
+func TestGetIncomingTransfersErrors(t *testing.T) {
+	server := makeServer(t, "/json_rpc", "POST", "", 200, `{"error": {"code": -13, "message": "No wallet file"}}`)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	client.HTTPClient = server.Client()
+
+	transfers, err := client.GetIncomingTransfers(context.Background(), 0)
+	assert.Nil(t, transfers)
+	assert.Error(t, err)
+}
+
+func TestGetHeight(t *testing.T) {
+	server := makeServer(t, "/json_rpc", "POST", "", 200, `{"result": {"height": 2300000}}`)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	client.HTTPClient = server.Client()
+
+	height, err := client.GetHeight(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2300000, height)
+}
@@ -0,0 +1,142 @@
+package monerorpc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// restrictedHeaderRangeLimit is how many headers a daemon running with
+	// --restricted-rpc returns per get_block_headers_range request
+	restrictedHeaderRangeLimit = 1000
+
+	rpcMethodNotFound = -32601
+
+	// ProbeTimeout bounds how long probing a daemon may take, so that an
+	// unresponsive daemon doesn't hold up the startup
+	ProbeTimeout = 10 * time.Second
+)
+
+type RpcVersion struct {
+	// Version is the RPC version, major << 16 | minor
+	Version uint32 `json:"version"`
+	Release bool   `json:"release"`
+	Status  string `json:"status"`
+}
+
+func (v *RpcVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Version>>16, v.Version&0xffff)
+}
+
+func NewGetVersionPayload() RPCRequestPayload {
+	return RPCRequestPayload{
+		ID:      "0",
+		JSONRPC: "2.0",
+		Method:  "get_version",
+		Params:  struct{}{},
+	}
+}
+
+// GetVersion returns the RPC version of the Monero Daemon
+func (c *RPCClient) GetVersion(ctx context.Context) (*RpcVersion, error) {
+	rpcReq := NewGetVersionPayload()
+	version := RpcVersion{}
+	if err := c.MakeRequest(ctx, rpcReq, &version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// DaemonCapabilities is what a daemon told about itself at startup
+type DaemonCapabilities struct {
+	RPCVersion string
+	// DaemonVersion is e.g. "0.17.1.9-release"
+	DaemonVersion string
+	Restricted    bool
+	// HeaderRangeLimit is the max number of headers per
+	// get_block_headers_range request. No limit when 0.
+	HeaderRangeLimit int
+}
+
+// UnsupportedError is returned for the RPC methods the daemon doesn't
+// serve, e.g. the ones that --restricted-rpc disables, instead of the raw
+// RPC error
+type UnsupportedError struct {
+	Method       string
+	Host         string
+	Capabilities *DaemonCapabilities
+}
+
+func (e *UnsupportedError) Error() string {
+	if e.Capabilities == nil {
+		return fmt.Sprintf("%s is not supported by %s", e.Method, e.Host)
+	}
+
+	mode := "unrestricted"
+	if e.Capabilities.Restricted {
+		mode = "restricted"
+	}
+	return fmt.Sprintf("%s is not supported by %s (RPC version %s, %s RPC)", e.Method, e.Host, e.Capabilities.RPCVersion, mode)
+}
+
+// Probe asks the daemon its version and whether it runs with
+// --restricted-rpc, so that requests can be adapted to what it serves
+func (c *RPCClient) Probe(ctx context.Context) (*DaemonCapabilities, error) {
+	ctx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+	defer cancel()
+
+	version, err := c.GetVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info, err := c.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	caps := &DaemonCapabilities{
+		RPCVersion:    version.String(),
+		DaemonVersion: info.Version,
+		Restricted:    info.Restricted,
+	}
+	if caps.Restricted {
+		caps.HeaderRangeLimit = restrictedHeaderRangeLimit
+	}
+
+	c.capsMu.Lock()
+	c.caps = caps
+	c.capsMu.Unlock()
+	return caps, nil
+}
+
+// Capabilities returns what Probe found, or nil if it wasn't called
+func (c *RPCClient) Capabilities() *DaemonCapabilities {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	return c.caps
+}
+
+// Probe probes every daemon of the pool, and logs what they support. The
+// daemons that can't be probed are used without adapting to them.
+func (p *DaemonPool) Probe(ctx context.Context) {
+	for _, d := range p.Daemons {
+		rpcClient, ok := d.Client.(*RPCClient)
+		if !ok {
+			continue
+		}
+
+		caps, err := rpcClient.Probe(ctx)
+		if err != nil {
+			log.Printf("Unable to probe daemon %s: %s", d.URL, err)
+			continue
+		}
+
+		if caps.Restricted {
+			log.Printf("Daemon %s runs %s (RPC version %s) with restricted RPC: block header ranges are fetched %d at a time", d.URL, caps.DaemonVersion, caps.RPCVersion, caps.HeaderRangeLimit)
+		} else {
+			log.Printf("Daemon %s runs %s (RPC version %s)", d.URL, caps.DaemonVersion, caps.RPCVersion)
+		}
+	}
+}
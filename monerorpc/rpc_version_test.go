@@ -0,0 +1,125 @@
+package monerorpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// makeRestrictedServer behaves like a daemon started with --restricted-rpc:
+// header ranges are capped, and get_block is not served
+func makeRestrictedServer(t *testing.T, ranges *[][2]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rpcReq := struct {
+			ID     string          `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}{}
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&rpcReq))
+
+		resp := map[string]interface{}{"id": rpcReq.ID}
+		switch rpcReq.Method {
+		case "get_version":
+			resp["result"] = map[string]interface{}{"version": 3<<16 | 5, "release": true, "status": "OK"}
+		case "get_info":
+			resp["result"] = map[string]interface{}{"height": 5000, "synchronized": true, "restricted": true, "version": "0.17.1.9-release", "status": "OK"}
+		case "get_block_headers_range":
+			params := GetBlocksRangeParams{}
+			assert.Nil(t, json.Unmarshal(rpcReq.Params, &params))
+			*ranges = append(*ranges, [2]int{params.StartHeight, params.EndHeight})
+			if params.EndHeight-params.StartHeight+1 > restrictedHeaderRangeLimit {
+				resp["error"] = map[string]interface{}{"code": -2, "message": "Too many block headers requested."}
+				break
+			}
+			headers := []RpcBlockHeader{}
+			for h := params.StartHeight; h <= params.EndHeight; h++ {
+				headers = append(headers, RpcBlockHeader{Hash: fmt.Sprintf("hash%d", h), Height: h})
+			}
+			resp["result"] = RpcBlockHeaders{Headers: headers}
+		default:
+			resp["error"] = map[string]interface{}{"code": rpcMethodNotFound, "message": "Method not found"}
+		}
+		json.NewEncoder(rw).Encode(resp)
+	}))
+}
+
+func TestNewGetVersionPayload(t *testing.T) {
+	req := NewGetVersionPayload()
+	assert.Equal(t, "0", req.ID)
+	assert.Equal(t, "2.0", req.JSONRPC)
+	assert.Equal(t, "get_version", req.Method)
+}
+
+func TestProbe(t *testing.T) {
+	ranges := [][2]int{}
+	server := makeRestrictedServer(t, &ranges)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	assert.Nil(t, client.Capabilities())
+
+	caps, err := client.Probe(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "3.5", caps.RPCVersion)
+	assert.Equal(t, "0.17.1.9-release", caps.DaemonVersion)
+	assert.True(t, caps.Restricted)
+	assert.Equal(t, restrictedHeaderRangeLimit, caps.HeaderRangeLimit)
+	assert.Equal(t, caps, client.Capabilities())
+
+	t.Run("Probing fails", func(t *testing.T) {
+		server := makeServer(t, "/json_rpc", "POST", "", 500, "")
+		defer server.Close()
+
+		client := NewRPCClient(server.URL)
+		_, err := client.Probe(context.Background())
+		assert.Error(t, err)
+		assert.Nil(t, client.Capabilities())
+	})
+}
+
+func TestGetBlockHeadersRangeSplit(t *testing.T) {
+	ranges := [][2]int{}
+	server := makeRestrictedServer(t, &ranges)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+
+	// Unprobed, the whole range is requested at once, and the daemon is
+	// probed once that fails
+	headers, err := client.GetBlockHeadersRange(context.Background(), 0, 2499)
+	assert.Nil(t, err)
+	assert.NotNil(t, client.Capabilities())
+	assert.Equal(t, 2500, len(headers))
+	assert.Equal(t, "hash2499", headers[2499].Hash)
+	assert.Equal(t, [][2]int{{0, 2499}, {0, 999}, {1000, 1999}, {2000, 2499}}, ranges)
+
+	ranges = ranges[:0]
+	headers, err = client.GetBlockHeadersRange(context.Background(), 0, 2499)
+	assert.Nil(t, err)
+	assert.Equal(t, 2500, len(headers))
+	assert.Equal(t, [][2]int{{0, 999}, {1000, 1999}, {2000, 2499}}, ranges)
+}
+
+func TestUnsupportedError(t *testing.T) {
+	ranges := [][2]int{}
+	server := makeRestrictedServer(t, &ranges)
+	defer server.Close()
+
+	client := NewRPCClient(server.URL)
+	_, err := client.GetBlockByHash(context.Background(), "hash")
+	unsupported := &UnsupportedError{}
+	assert.True(t, errors.As(err, &unsupported))
+	assert.Equal(t, "get_block is not supported by "+server.URL, err.Error())
+
+	_, err = client.Probe(context.Background())
+	assert.Nil(t, err)
+
+	_, err = client.GetBlockByHash(context.Background(), "hash")
+	assert.Equal(t, "get_block is not supported by "+server.URL+" (RPC version 3.5, restricted RPC)", err.Error())
+}
@@ -0,0 +1,380 @@
+package publisher
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	AgentTx    = "tx"
+	AgentBlock = "block"
+
+	agentDialTimeout    = 500 * time.Millisecond
+	agentIOTimeout      = 5 * time.Second
+	agentQueueSize      = 1000
+	agentIdleWait       = time.Hour
+	agentQueueFileName  = "agent-queue.json"
+	agentSocketFileName = "agent.sock"
+
+	defaultAgentMaxAttempts    = 5
+	defaultAgentInitialBackoff = time.Second
+	defaultAgentMaxBackoff     = time.Minute
+	defaultAgentDrainTimeout   = 30 * time.Second
+)
+
+// DefaultAgentSocket is where the tx and block commands look for an agent:
+// in the state directory, or else in the user's runtime directory. Both
+// are private to the user, unlike the temporary directory. It's empty, and
+// hand-off disabled, when there's neither.
+func DefaultAgentSocket(stateDir string) string {
+	if stateDir != "" {
+		return filepath.Join(stateDir, agentSocketFileName)
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "monero-nats-publisher.sock")
+	}
+	return ""
+}
+
+// NewAgentQueueStore keeps the queue of the agent in the state directory
+func NewAgentQueueStore(stateDir string) *JSONFileStore {
+	return NewJSONFileStore(stateDir, agentQueueFileName)
+}
+
+// ErrAgentUnavailable is returned by HandOff when no agent is listening
+var ErrAgentUnavailable = errors.New("agent unavailable")
+
+// AgentRequest is what hook invocations hand off to the agent: the kind of
+// notification and the txid or block hash it's about
+type AgentRequest struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+}
+
+type AgentResponse struct {
+	Queued    bool   `json:"queued"`
+	Duplicate bool   `json:"duplicate"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AgentHandler processes a txid or block hash
+type AgentHandler func(string) error
+
+// agentJob is a queued request, along with its failed attempts
+type agentJob struct {
+	AgentRequest
+	Attempts  int       `json:"attempts"`
+	NotBefore time.Time `json:"not_before"`
+
+	running bool
+}
+
+// Agent is a resident process that keeps its connections open, and
+// processes the notifications handed off through a Unix socket one at a
+// time, in the order they arrive.
+// Failed requests are retried with an exponential backoff, up to
+// MaxAttempts times. With a Store, the queue is saved on every change, so
+// the requests an agent didn't get to are processed by the next one.
+// On shutdown, the requests due are processed for up to DrainTimeout.
+type Agent struct {
+	SocketPath     string
+	Handlers       map[string]AgentHandler
+	Store          *JSONFileStore
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	DrainTimeout   time.Duration
+
+	mu    sync.Mutex
+	queue []agentJob
+	wake  chan struct{}
+}
+
+func NewAgent(socketPath string, handlers map[string]AgentHandler) *Agent {
+	return &Agent{
+		SocketPath:     socketPath,
+		Handlers:       handlers,
+		MaxAttempts:    defaultAgentMaxAttempts,
+		InitialBackoff: defaultAgentInitialBackoff,
+		MaxBackoff:     defaultAgentMaxBackoff,
+		DrainTimeout:   defaultAgentDrainTimeout,
+		wake:           make(chan struct{}, 1),
+	}
+}
+
+// save persists the queue. It's called with the lock held.
+func (a *Agent) save() error {
+	if a.Store == nil {
+		return nil
+	}
+	return a.Store.Save(a.queue)
+}
+
+func (a *Agent) load() error {
+	if a.Store == nil {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.Store.Load(&a.queue); err != nil {
+		return err
+	}
+	if len(a.queue) > 0 {
+		log.Printf("Resuming %d queued requests", len(a.queue))
+	}
+	return nil
+}
+
+// Enqueue queues the request, unless an identical one is still waiting to
+// be processed. Processing it once will publish the latest state anyway.
+func (a *Agent) Enqueue(req AgentRequest) AgentResponse {
+	if _, ok := a.Handlers[req.Kind]; !ok || req.ID == "" {
+		return AgentResponse{Error: fmt.Sprintf("invalid request %+v", req)}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, job := range a.queue {
+		if job.AgentRequest == req && !job.running {
+			return AgentResponse{Queued: true, Duplicate: true}
+		}
+	}
+	if len(a.queue) >= agentQueueSize {
+		return AgentResponse{Error: "queue is full"}
+	}
+
+	a.queue = append(a.queue, agentJob{AgentRequest: req})
+	if err := a.save(); err != nil {
+		a.queue = a.queue[:len(a.queue)-1]
+		return AgentResponse{Error: fmt.Sprintf("Unable to save the queue: %s", err)}
+	}
+
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+	return AgentResponse{Queued: true}
+}
+
+// next marks the first job due as running, and returns it. Otherwise, it
+// returns how long until the next one is due.
+func (a *Agent) next(now time.Time) (agentJob, time.Duration, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	wait := agentIdleWait
+	for i := range a.queue {
+		job := &a.queue[i]
+		if job.running {
+			continue
+		}
+		if !job.NotBefore.After(now) {
+			job.running = true
+			return *job, 0, true
+		}
+		if d := job.NotBefore.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	return agentJob{}, wait, false
+}
+
+// process runs the handler of the job, and then removes it from the queue,
+// or schedules its retry
+func (a *Agent) process(job agentJob) {
+	err := a.Handlers[job.Kind](job.ID)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := 0
+	for i < len(a.queue) && !a.queue[i].running {
+		i++
+	}
+	if i == len(a.queue) {
+		return
+	}
+
+	switch {
+	case err == nil:
+		a.queue = append(a.queue[:i], a.queue[i+1:]...)
+	case job.Attempts+1 >= a.MaxAttempts:
+		log.Printf("Failed to process %s %s, giving up after %d attempts: %s", job.Kind, job.ID, job.Attempts+1, err)
+		a.queue = append(a.queue[:i], a.queue[i+1:]...)
+	default:
+		job.Attempts++
+		job.NotBefore = time.Now().Add(a.backoff(job.Attempts))
+		job.running = false
+		a.queue[i] = job
+		log.Printf("Failed to process %s %s, retrying at %s: %s", job.Kind, job.ID, job.NotBefore.Format(time.RFC3339), err)
+	}
+
+	if err := a.save(); err != nil {
+		log.Printf("Unable to save the agent queue: %s", err)
+	}
+}
+
+// backoff is the delay before the retry that follows the given number of
+// failed attempts
+func (a *Agent) backoff(attempts int) time.Duration {
+	backoff := a.InitialBackoff
+	for i := 1; i < attempts && backoff < a.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > a.MaxBackoff {
+		backoff = a.MaxBackoff
+	}
+	return backoff
+}
+
+func (a *Agent) work(ctx context.Context, done chan<- struct{}) {
+	defer close(done)
+	for ctx.Err() == nil {
+		job, wait, ok := a.next(time.Now())
+		if ok {
+			a.process(job)
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+		case <-a.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+	a.drain()
+}
+
+// drain processes the jobs due, until there's none left or DrainTimeout
+// expires
+func (a *Agent) drain() {
+	deadline := time.Now().Add(a.DrainTimeout)
+	for time.Now().Before(deadline) {
+		job, _, ok := a.next(time.Now())
+		if !ok {
+			break
+		}
+		a.process(job)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.queue) == 0 {
+		return
+	}
+	if a.Store != nil {
+		log.Printf("Leaving %d requests queued for the next agent", len(a.queue))
+	} else {
+		log.Printf("Dropping %d queued requests", len(a.queue))
+	}
+}
+
+func (a *Agent) handleConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(agentIOTimeout))
+
+	req := AgentRequest{}
+	resp := AgentResponse{}
+	if err := checkPeer(conn); err != nil {
+		log.Printf("Rejecting connection: %s", err)
+		resp.Error = err.Error()
+	} else if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		resp.Error = fmt.Sprintf("Unable to parse request: %s", err)
+	} else {
+		resp = a.Enqueue(req)
+	}
+
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		log.Printf("Unable to respond to %+v: %s", req, err)
+	}
+}
+
+// Serve listens on the Unix socket until the context is done, and then
+// drains the queue. Only the user running the agent, and root, can hand
+// off requests.
+func (a *Agent) Serve(ctx context.Context) error {
+	if err := a.load(); err != nil {
+		return err
+	}
+
+	// A socket file left behind by a previous agent would make Listen fail
+	if conn, err := net.DialTimeout("unix", a.SocketPath, agentDialTimeout); err == nil {
+		conn.Close()
+		return fmt.Errorf("an agent is already listening on %s", a.SocketPath)
+	}
+	os.Remove(a.SocketPath)
+
+	if err := os.MkdirAll(filepath.Dir(a.SocketPath), 0700); err != nil {
+		return err
+	}
+	l, err := net.Listen("unix", a.SocketPath)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(a.SocketPath, 0600); err != nil {
+		l.Close()
+		return err
+	}
+	log.Printf("Agent listening on %s", a.SocketPath)
+
+	workerDone := make(chan struct{})
+	go a.work(ctx, workerDone)
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				<-workerDone
+				return nil
+			default:
+				return err
+			}
+		}
+		go a.handleConn(conn)
+	}
+}
+
+// HandOff passes the request to the agent listening on the socket. It
+// returns ErrAgentUnavailable when there is none, so the caller can do
+// the work itself.
+func HandOff(socketPath string, req AgentRequest) (*AgentResponse, error) {
+	conn, err := net.DialTimeout("unix", socketPath, agentDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAgentUnavailable, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(agentIOTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+
+	resp := AgentResponse{}
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Error != "" {
+		return &resp, fmt.Errorf("agent rejected %+v: %s", req, resp.Error)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,277 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingHandler struct {
+	mu    sync.Mutex
+	IDs   []string
+	Block chan struct{}
+}
+
+func (h *recordingHandler) Handle(id string) error {
+	if h.Block != nil {
+		<-h.Block
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.IDs = append(h.IDs, id)
+	return nil
+}
+
+func (h *recordingHandler) Handled() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string{}, h.IDs...)
+}
+
+func startTestAgent(t *testing.T, handlers map[string]AgentHandler) (*Agent, func()) {
+	return startTestAgentWith(t, handlers, func(*Agent) {})
+}
+
+func startTestAgentWith(t *testing.T, handlers map[string]AgentHandler, setup func(*Agent)) (*Agent, func()) {
+	dir, err := ioutil.TempDir("", "publisher-agent")
+	assert.Nil(t, err)
+
+	agent := NewAgent(filepath.Join(dir, "agent.sock"), handlers)
+	setup(agent)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- agent.Serve(ctx) }()
+
+	// Wait for the agent to listen
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(agent.SocketPath); err == nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return agent, func() {
+		cancel()
+		assert.Nil(t, <-done)
+		os.RemoveAll(dir)
+	}
+}
+
+func waitForHandled(h *recordingHandler, count int) []string {
+	for i := 0; i < 100; i++ {
+		if handled := h.Handled(); len(handled) >= count {
+			return handled
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return h.Handled()
+}
+
+func TestAgentHandOff(t *testing.T) {
+	txs, blocks := &recordingHandler{}, &recordingHandler{}
+	agent, stop := startTestAgent(t, map[string]AgentHandler{
+		AgentTx:    txs.Handle,
+		AgentBlock: blocks.Handle,
+	})
+	defer stop()
+
+	resp, err := HandOff(agent.SocketPath, AgentRequest{Kind: AgentTx, ID: "tx1"})
+	assert.Nil(t, err)
+	assert.True(t, resp.Queued)
+
+	_, err = HandOff(agent.SocketPath, AgentRequest{Kind: AgentBlock, ID: "block1"})
+	assert.Nil(t, err)
+	_, err = HandOff(agent.SocketPath, AgentRequest{Kind: AgentTx, ID: "tx2"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"tx1", "tx2"}, waitForHandled(txs, 2))
+	assert.Equal(t, []string{"block1"}, waitForHandled(blocks, 1))
+
+	t.Run("Invalid requests are rejected", func(t *testing.T) {
+		_, err := HandOff(agent.SocketPath, AgentRequest{Kind: "unknown", ID: "id"})
+		assert.Error(t, err)
+		assert.False(t, errors.Is(err, ErrAgentUnavailable))
+
+		_, err = HandOff(agent.SocketPath, AgentRequest{Kind: AgentTx})
+		assert.Error(t, err)
+	})
+
+	t.Run("A second agent can't listen on the same socket", func(t *testing.T) {
+		other := NewAgent(agent.SocketPath, map[string]AgentHandler{})
+		assert.Error(t, other.Serve(context.Background()))
+	})
+}
+
+func TestAgentDedupesPendingRequests(t *testing.T) {
+	txs := &recordingHandler{Block: make(chan struct{})}
+	agent := NewAgent("", map[string]AgentHandler{AgentTx: txs.Handle})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go agent.work(ctx, done)
+
+	// The first request is being processed, so the same one is queued again
+	assert.False(t, agent.Enqueue(AgentRequest{Kind: AgentTx, ID: "tx1"}).Duplicate)
+	for i := 0; i < 100 && !agent.isRunning(0); i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.False(t, agent.Enqueue(AgentRequest{Kind: AgentTx, ID: "tx1"}).Duplicate)
+
+	// But not while it's still waiting in the queue
+	resp := agent.Enqueue(AgentRequest{Kind: AgentTx, ID: "tx1"})
+	assert.True(t, resp.Queued)
+	assert.True(t, resp.Duplicate)
+	assert.False(t, agent.Enqueue(AgentRequest{Kind: AgentTx, ID: "tx2"}).Duplicate)
+
+	close(txs.Block)
+	assert.Equal(t, []string{"tx1", "tx1", "tx2"}, waitForHandled(txs, 3))
+}
+
+func (a *Agent) isRunning(i int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.queue) > i && a.queue[i].running
+}
+
+func TestAgentRetries(t *testing.T) {
+	t.Run("Retried until it succeeds", func(t *testing.T) {
+		failures := 2
+		txs := &recordingHandler{}
+		agent := NewAgent("", map[string]AgentHandler{AgentTx: func(id string) error {
+			if failures > 0 {
+				failures--
+				return fmt.Errorf("Dummy error")
+			}
+			return txs.Handle(id)
+		}})
+		agent.InitialBackoff = time.Millisecond
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		done := make(chan struct{})
+		go agent.work(ctx, done)
+
+		agent.Enqueue(AgentRequest{Kind: AgentTx, ID: "tx1"})
+		assert.Equal(t, []string{"tx1"}, waitForHandled(txs, 1))
+	})
+
+	t.Run("Given up after MaxAttempts", func(t *testing.T) {
+		calls := 0
+		agent := NewAgent("", map[string]AgentHandler{AgentTx: func(id string) error {
+			calls++
+			return fmt.Errorf("Dummy error")
+		}})
+		agent.InitialBackoff = time.Millisecond
+		agent.MaxAttempts = 3
+
+		agent.Enqueue(AgentRequest{Kind: AgentTx, ID: "tx1"})
+		for i := 0; i < 100 && len(agent.queue) > 0; i++ {
+			if job, _, ok := agent.next(time.Now().Add(time.Second)); ok {
+				agent.process(job)
+			}
+		}
+		assert.Equal(t, 3, calls)
+		assert.Empty(t, agent.queue)
+	})
+
+	t.Run("Backoff", func(t *testing.T) {
+		agent := NewAgent("", nil)
+		agent.InitialBackoff = time.Second
+		agent.MaxBackoff = 5 * time.Second
+		assert.Equal(t, time.Second, agent.backoff(1))
+		assert.Equal(t, 4*time.Second, agent.backoff(3))
+		assert.Equal(t, 5*time.Second, agent.backoff(10))
+	})
+}
+
+func TestAgentQueueIsPersisted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-agent")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	first := NewAgent("", map[string]AgentHandler{AgentTx: func(string) error { return nil }})
+	first.Store = NewAgentQueueStore(dir)
+	assert.True(t, first.Enqueue(AgentRequest{Kind: AgentTx, ID: "tx1"}).Queued)
+
+	// The next agent processes what the first one didn't get to
+	txs := &recordingHandler{}
+	agent, stop := startTestAgentWith(t, map[string]AgentHandler{AgentTx: txs.Handle}, func(a *Agent) {
+		a.Store = NewAgentQueueStore(dir)
+	})
+	defer stop()
+	assert.Equal(t, []string{"tx1"}, waitForHandled(txs, 1))
+
+	for i := 0; i < 100 && agent.isRunning(0); i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	queue := []agentJob{}
+	assert.Nil(t, NewAgentQueueStore(dir).Load(&queue))
+	assert.Empty(t, queue)
+}
+
+func TestAgentDrainsOnShutdown(t *testing.T) {
+	txs := &recordingHandler{Block: make(chan struct{})}
+	agent := NewAgent("", map[string]AgentHandler{AgentTx: txs.Handle})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go agent.work(ctx, done)
+
+	agent.Enqueue(AgentRequest{Kind: AgentTx, ID: "tx1"})
+	agent.Enqueue(AgentRequest{Kind: AgentTx, ID: "tx2"})
+	cancel()
+	close(txs.Block)
+	<-done
+
+	assert.Equal(t, []string{"tx1", "tx2"}, txs.Handled())
+}
+
+func TestDefaultAgentSocket(t *testing.T) {
+	assert.Equal(t, filepath.Join("state", "agent.sock"), DefaultAgentSocket("state"))
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	defer os.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	os.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	assert.Equal(t, "/run/user/1000/monero-nats-publisher.sock", DefaultAgentSocket(""))
+	os.Setenv("XDG_RUNTIME_DIR", "")
+	assert.Equal(t, "", DefaultAgentSocket(""))
+}
+
+func TestAgentHandlerErrors(t *testing.T) {
+	calls := make(chan string, 2)
+	agent, stop := startTestAgent(t, map[string]AgentHandler{
+		AgentTx: func(id string) error {
+			calls <- id
+			return fmt.Errorf("Dummy error")
+		},
+	})
+	defer stop()
+
+	// A failing request doesn't stop the agent
+	_, err := HandOff(agent.SocketPath, AgentRequest{Kind: AgentTx, ID: "tx1"})
+	assert.Nil(t, err)
+	_, err = HandOff(agent.SocketPath, AgentRequest{Kind: AgentTx, ID: "tx2"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "tx1", <-calls)
+	assert.Equal(t, "tx2", <-calls)
+}
+
+func TestHandOffWithoutAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-agent")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = HandOff(filepath.Join(dir, "missing.sock"), AgentRequest{Kind: AgentTx, ID: "tx1"})
+	assert.True(t, errors.Is(err, ErrAgentUnavailable))
+}
@@ -0,0 +1,37 @@
+package publisher_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"github.com/xmrstuff/monero-nats-publisher/publisher"
+)
+
+type channelPublisher struct {
+	Payloads map[string][][]byte
+}
+
+func (p *channelPublisher) Publish(payload []byte, channel string) error {
+	p.Payloads[channel] = append(p.Payloads[channel], payload)
+	return nil
+}
+
+func (p *channelPublisher) IsConnected() bool {
+	return true
+}
+
+func TestEventPublishing(t *testing.T) {
+	p := &channelPublisher{Payloads: map[string][][]byte{}}
+	var ep publisher.BlockEventPublisher = &publisher.EventPublishing{Publisher: p}
+
+	assert.Nil(t, ep.PushBlockEvent(events.Block{Hash: "hash1", Height: 10}))
+	assert.Equal(t, 1, len(p.Payloads[events.DefaultChannel]))
+
+	blk := events.Block{}
+	ev := events.Event{Data: &blk}
+	assert.Nil(t, json.Unmarshal(p.Payloads[events.DefaultChannel][0], &ev))
+	assert.Equal(t, events.BlockCreated, ev.Type)
+	assert.Equal(t, "hash1", blk.Hash)
+}
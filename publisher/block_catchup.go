@@ -0,0 +1,140 @@
+package publisher
+
+import (
+	"context"
+	"log"
+
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
+)
+
+const blocksFileName = "blocks.json"
+
+// BlockState is the last block published from this host
+type BlockState struct {
+	LastHeight int    `json:"last_height"`
+	LastHash   string `json:"last_hash"`
+}
+
+// BlockStateStore keeps the BlockState in the local state directory
+type BlockStateStore struct {
+	Store *JSONFileStore
+}
+
+// Load returns a zero BlockState, with no LastHash, when no block was
+// published yet
+func (s *BlockStateStore) Load() (BlockState, error) {
+	state := BlockState{}
+	err := s.Store.Load(&state)
+	return state, err
+}
+
+// Record stores the block as the last published one, unless a higher one
+// was published already (e.g. the block comes from a reorg)
+func (s *BlockStateStore) Record(blk events.Block) error {
+	state, err := s.Load()
+	if err != nil {
+		return err
+	}
+	if state.LastHash != "" && blk.Height < state.LastHeight {
+		return nil
+	}
+	return s.Store.Save(BlockState{LastHeight: blk.Height, LastHash: blk.Hash})
+}
+
+func NewBlockStateStore(stateDir string) *BlockStateStore {
+	return &BlockStateStore{
+		Store: NewJSONFileStore(stateDir, blocksFileName),
+	}
+}
+
+// BlockCatchUpPublisher publishes the blocks missed since the last
+// published one (e.g. a failed block-notify invocation), in order, before
+// publishing the block itself. At most MaxCatchUp blocks are caught up,
+// the ones closest to the block, and none below IgnoreBelowHeight.
+type BlockCatchUpPublisher struct {
+	BlockEventPublisher
+	Getter            monerorpc.BlockGetter
+	State             *BlockStateStore
+	MaxCatchUp        int
+	MaxExtraAncestors int
+	IgnoreBelowHeight int
+}
+
+func (p *BlockCatchUpPublisher) PushBlockEvent(blk events.Block) error {
+	state, err := p.State.Load()
+	if err != nil {
+		return err
+	}
+
+	if state.LastHash != "" && blk.Height > state.LastHeight+1 && p.MaxCatchUp > 0 {
+		if err := p.catchUp(state.LastHeight+1, blk.Height-1); err != nil {
+			return err
+		}
+	}
+
+	if err := p.BlockEventPublisher.PushBlockEvent(blk); err != nil {
+		return err
+	}
+	return p.State.Record(blk)
+}
+
+// catchUp fetches the headers of the missed blocks and of their ancestors
+// in a single range, and the missed blocks in a single batch
+func (p *BlockCatchUpPublisher) catchUp(start, end int) error {
+	if end-start+1 > p.MaxCatchUp {
+		log.Printf("Skipping blocks %d to %d, only the last %d missing blocks are caught up", start, end-p.MaxCatchUp, p.MaxCatchUp)
+		start = end - p.MaxCatchUp + 1
+	}
+	if start < p.IgnoreBelowHeight {
+		start = p.IgnoreBelowHeight
+	}
+	if start > end {
+		return nil
+	}
+	log.Printf("Catching up blocks %d to %d", start, end)
+
+	rangeStart := start - p.MaxExtraAncestors
+	if rangeStart < 0 {
+		rangeStart = 0
+	}
+
+	ctx := context.Background()
+	headers, err := p.Getter.GetBlockHeadersRange(ctx, rangeStart, end)
+	if err != nil {
+		return err
+	}
+	hashByHeight := map[int]string{}
+	hashes := []string{}
+	for _, h := range headers {
+		hashByHeight[h.Height] = h.Hash
+		if h.Height >= start {
+			hashes = append(hashes, h.Hash)
+		}
+	}
+
+	rpcBlocks, err := monerorpc.GetBlocks(ctx, p.Getter, hashes)
+	if err != nil {
+		return err
+	}
+
+	for _, rpcBlock := range rpcBlocks {
+		blk := monerorpc.RpcBlockToBlock(*rpcBlock)
+		blk.PrevHashes = []string{}
+		for height := blk.Height - p.MaxExtraAncestors; height < blk.Height; height++ {
+			if hash, ok := hashByHeight[height]; ok {
+				blk.PrevHashes = append(blk.PrevHashes, hash)
+			}
+		}
+		blk.CatchUp = true
+
+		if err := p.BlockEventPublisher.PushBlockEvent(blk); err != nil {
+			return err
+		}
+		// Recorded one by one, so that a failure resumes from there
+		if err := p.State.Record(blk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
+)
+
+// fakeChain serves a chain where the block at height h has hash "hash<h>"
+type fakeChain struct {
+	Height     int
+	BatchCalls int
+	RangeCalls int
+}
+
+func (c *fakeChain) GetBlockByHash(ctx context.Context, hash string) (*monerorpc.RpcBlock, error) {
+	height := 0
+	if _, err := fmt.Sscanf(hash, "hash%d", &height); err != nil || height > c.Height {
+		return nil, fmt.Errorf("unknown block %s", hash)
+	}
+	return &monerorpc.RpcBlock{BlockHeader: monerorpc.RpcBlockHeader{Hash: hash, Height: height, PrevHash: fmt.Sprintf("hash%d", height-1)}}, nil
+}
+
+func (c *fakeChain) GetBlocksByHash(ctx context.Context, hashes []string) ([]*monerorpc.RpcBlock, error) {
+	c.BatchCalls++
+	blocks := []*monerorpc.RpcBlock{}
+	for _, hash := range hashes {
+		b, err := c.GetBlockByHash(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+func (c *fakeChain) GetBlockHeadersRange(ctx context.Context, start, end int) ([]monerorpc.RpcBlockHeader, error) {
+	c.RangeCalls++
+	headers := []monerorpc.RpcBlockHeader{}
+	for h := start; h <= end; h++ {
+		headers = append(headers, monerorpc.RpcBlockHeader{Hash: fmt.Sprintf("hash%d", h), Height: h})
+	}
+	return headers, nil
+}
+
+func newTestBlockCatchUpPublisher(t *testing.T, p BlockEventPublisher) (*BlockCatchUpPublisher, func()) {
+	dir, err := ioutil.TempDir("", "publisher-blocks")
+	assert.Nil(t, err)
+
+	return &BlockCatchUpPublisher{
+		BlockEventPublisher: p,
+		Getter:              &fakeChain{Height: 100},
+		State:               NewBlockStateStore(dir),
+		MaxCatchUp:          3,
+		MaxExtraAncestors:   1,
+	}, func() { os.RemoveAll(dir) }
+}
+
+func publishedHeights(blocks []events.Block) (heights []int, catchUps []bool) {
+	for _, b := range blocks {
+		heights = append(heights, b.Height)
+		catchUps = append(catchUps, b.CatchUp)
+	}
+	return heights, catchUps
+}
+
+func TestBlockCatchUpPublisher(t *testing.T) {
+	t.Run("Nothing recorded yet", func(t *testing.T) {
+		p := &MockedBlockEventPublisher{Returns: []error{nil}}
+		publisher, cleanup := newTestBlockCatchUpPublisher(t, p)
+		defer cleanup()
+
+		assert.Nil(t, publisher.PushBlockEvent(events.Block{Hash: "hash50", Height: 50}))
+		assert.Equal(t, 1, p.CallsCount)
+
+		state, err := publisher.State.Load()
+		assert.Nil(t, err)
+		assert.Equal(t, BlockState{LastHeight: 50, LastHash: "hash50"}, state)
+	})
+
+	t.Run("Next block", func(t *testing.T) {
+		p := &MockedBlockEventPublisher{Returns: []error{nil}}
+		publisher, cleanup := newTestBlockCatchUpPublisher(t, p)
+		defer cleanup()
+		assert.Nil(t, publisher.State.Record(events.Block{Hash: "hash49", Height: 49}))
+
+		assert.Nil(t, publisher.PushBlockEvent(events.Block{Hash: "hash50", Height: 50}))
+		assert.Equal(t, 1, p.CallsCount)
+	})
+
+	t.Run("Missed blocks are published first", func(t *testing.T) {
+		p := &MockedBlockEventPublisher{Returns: []error{nil, nil, nil}}
+		publisher, cleanup := newTestBlockCatchUpPublisher(t, p)
+		defer cleanup()
+		assert.Nil(t, publisher.State.Record(events.Block{Hash: "hash47", Height: 47}))
+
+		assert.Nil(t, publisher.PushBlockEvent(events.Block{Hash: "hash50", Height: 50}))
+
+		heights, catchUps := publishedHeights(p.PassedBlocks)
+		assert.Equal(t, []int{48, 49, 50}, heights)
+		assert.Equal(t, []bool{true, true, false}, catchUps)
+		assert.Equal(t, []string{"hash47"}, p.PassedBlocks[0].PrevHashes)
+		assert.Equal(t, []string{"hash48"}, p.PassedBlocks[1].PrevHashes)
+		// The missed blocks and their ancestors are fetched at once
+		assert.Equal(t, 1, publisher.Getter.(*fakeChain).BatchCalls)
+		assert.Equal(t, 1, publisher.Getter.(*fakeChain).RangeCalls)
+
+		state, err := publisher.State.Load()
+		assert.Nil(t, err)
+		assert.Equal(t, 50, state.LastHeight)
+	})
+
+	t.Run("Only the last missed blocks are caught up", func(t *testing.T) {
+		p := &MockedBlockEventPublisher{Returns: []error{nil, nil, nil, nil}}
+		publisher, cleanup := newTestBlockCatchUpPublisher(t, p)
+		defer cleanup()
+		assert.Nil(t, publisher.State.Record(events.Block{Hash: "hash40", Height: 40}))
+
+		assert.Nil(t, publisher.PushBlockEvent(events.Block{Hash: "hash50", Height: 50}))
+
+		heights, _ := publishedHeights(p.PassedBlocks)
+		assert.Equal(t, []int{47, 48, 49, 50}, heights)
+	})
+
+	t.Run("Blocks below the ignored height are not caught up", func(t *testing.T) {
+		p := &MockedBlockEventPublisher{Returns: []error{nil, nil}}
+		publisher, cleanup := newTestBlockCatchUpPublisher(t, p)
+		defer cleanup()
+		publisher.IgnoreBelowHeight = 49
+		assert.Nil(t, publisher.State.Record(events.Block{Hash: "hash46", Height: 46}))
+
+		assert.Nil(t, publisher.PushBlockEvent(events.Block{Hash: "hash50", Height: 50}))
+
+		heights, _ := publishedHeights(p.PassedBlocks)
+		assert.Equal(t, []int{49, 50}, heights)
+	})
+
+	t.Run("Catch up disabled", func(t *testing.T) {
+		p := &MockedBlockEventPublisher{Returns: []error{nil}}
+		publisher, cleanup := newTestBlockCatchUpPublisher(t, p)
+		defer cleanup()
+		publisher.MaxCatchUp = 0
+		assert.Nil(t, publisher.State.Record(events.Block{Hash: "hash40", Height: 40}))
+
+		assert.Nil(t, publisher.PushBlockEvent(events.Block{Hash: "hash50", Height: 50}))
+		assert.Equal(t, 1, p.CallsCount)
+	})
+
+	t.Run("Publishing fails while catching up", func(t *testing.T) {
+		p := &MockedBlockEventPublisher{Returns: []error{nil, fmt.Errorf("Dummy error")}}
+		publisher, cleanup := newTestBlockCatchUpPublisher(t, p)
+		defer cleanup()
+		assert.Nil(t, publisher.State.Record(events.Block{Hash: "hash47", Height: 47}))
+
+		assert.Error(t, publisher.PushBlockEvent(events.Block{Hash: "hash50", Height: 50}))
+		assert.Equal(t, 2, p.CallsCount)
+
+		// Resumes after the last block that was published
+		state, err := publisher.State.Load()
+		assert.Nil(t, err)
+		assert.Equal(t, 48, state.LastHeight)
+	})
+
+	t.Run("Lower block", func(t *testing.T) {
+		p := &MockedBlockEventPublisher{Returns: []error{nil}}
+		publisher, cleanup := newTestBlockCatchUpPublisher(t, p)
+		defer cleanup()
+		assert.Nil(t, publisher.State.Record(events.Block{Hash: "hash50", Height: 50}))
+
+		assert.Nil(t, publisher.PushBlockEvent(events.Block{Hash: "other49", Height: 49}))
+		assert.Equal(t, 1, p.CallsCount)
+
+		state, err := publisher.State.Load()
+		assert.Nil(t, err)
+		assert.Equal(t, 50, state.LastHeight)
+	})
+}
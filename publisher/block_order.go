@@ -0,0 +1,90 @@
+package publisher
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+const (
+	blocksLockFileName = "blocks.lock"
+
+	defaultBlockHoldPoll = 200 * time.Millisecond
+)
+
+// OrderedBlockPublisher publishes blocks in non-decreasing height order
+// across the publisher processes of a host. Publishing is serialized by a
+// lock file, and checked against the last published height, the
+// watermark.
+// A block that arrives before its predecessor is held until the
+// predecessor is published, for up to HoldTimeout. After that it's
+// published anyway, and catching up (see BlockCatchUpPublisher) fills the
+// gap. Blocks below the watermark are dropped, since publishing them would
+// break the order.
+type OrderedBlockPublisher struct {
+	BlockEventPublisher
+	LockPath     string
+	State        *BlockStateStore
+	HoldTimeout  time.Duration
+	PollInterval time.Duration
+}
+
+func (p *OrderedBlockPublisher) PushBlockEvent(blk events.Block) error {
+	deadline := time.Now().Add(p.HoldTimeout)
+	for {
+		published, err := p.tryPush(blk, !time.Now().Before(deadline))
+		if err != nil || published {
+			return err
+		}
+		time.Sleep(p.PollInterval)
+	}
+}
+
+// tryPush publishes the block if it's its turn, or if force is set. It
+// returns false when the block has to wait for its predecessor.
+func (p *OrderedBlockPublisher) tryPush(blk events.Block, force bool) (bool, error) {
+	if err := os.MkdirAll(filepath.Dir(p.LockPath), 0700); err != nil {
+		return false, err
+	}
+	lock := &FileLock{Path: p.LockPath}
+	if err := lock.Lock(); err != nil {
+		return false, fmt.Errorf("Unable to acquire lock %s: %s", p.LockPath, err)
+	}
+	defer lock.Unlock()
+
+	state, err := p.State.Load()
+	if err != nil {
+		return false, err
+	}
+
+	if state.LastHash != "" {
+		switch {
+		case blk.Height < state.LastHeight:
+			log.Printf("Dropping block %s at height %d, block %d was published already", blk.Hash, blk.Height, state.LastHeight)
+			return true, nil
+		case blk.Height > state.LastHeight+1 && !force:
+			return false, nil
+		case blk.Height > state.LastHeight+1:
+			log.Printf("Block %d was not published in time, publishing block %d", state.LastHeight+1, blk.Height)
+		}
+	}
+
+	if err := p.BlockEventPublisher.PushBlockEvent(blk); err != nil {
+		return false, err
+	}
+	return true, p.State.Record(blk)
+}
+
+func NewOrderedBlockPublisher(stateDir string, p BlockEventPublisher, holdTimeout time.Duration) *OrderedBlockPublisher {
+	return &OrderedBlockPublisher{
+		BlockEventPublisher: p,
+		LockPath:            filepath.Join(stateDir, blocksLockFileName),
+		State:               NewBlockStateStore(stateDir),
+		HoldTimeout:         holdTimeout,
+		PollInterval:        defaultBlockHoldPoll,
+	}
+}
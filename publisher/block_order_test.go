@@ -0,0 +1,104 @@
+package publisher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+type blockRecorder struct {
+	mu      sync.Mutex
+	Heights []int
+}
+
+func (r *blockRecorder) PushBlockEvent(b events.Block) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Heights = append(r.Heights, b.Height)
+	return nil
+}
+
+func newTestOrderedBlockPublisher(t *testing.T, holdTimeout time.Duration) (*OrderedBlockPublisher, *blockRecorder, func()) {
+	dir, err := ioutil.TempDir("", "publisher-blocks")
+	assert.Nil(t, err)
+
+	r := &blockRecorder{}
+	p := NewOrderedBlockPublisher(dir, r, holdTimeout)
+	p.PollInterval = 10 * time.Millisecond
+	return p, r, func() { os.RemoveAll(dir) }
+}
+
+func testBlock(height int) events.Block {
+	return events.Block{Hash: fmt.Sprintf("hash%d", height), Height: height}
+}
+
+func TestOrderedBlockPublisher(t *testing.T) {
+	t.Run("Blocks in order", func(t *testing.T) {
+		p, r, cleanup := newTestOrderedBlockPublisher(t, time.Second)
+		defer cleanup()
+
+		assert.Nil(t, p.PushBlockEvent(testBlock(50)))
+		assert.Nil(t, p.PushBlockEvent(testBlock(51)))
+		// Another block at the same height, e.g. after a reorg
+		assert.Nil(t, p.PushBlockEvent(events.Block{Hash: "other51", Height: 51}))
+		assert.Equal(t, []int{50, 51, 51}, r.Heights)
+
+		state, err := p.State.Load()
+		assert.Nil(t, err)
+		assert.Equal(t, BlockState{LastHeight: 51, LastHash: "other51"}, state)
+	})
+
+	t.Run("Blocks below the watermark are dropped", func(t *testing.T) {
+		p, r, cleanup := newTestOrderedBlockPublisher(t, time.Second)
+		defer cleanup()
+
+		assert.Nil(t, p.PushBlockEvent(testBlock(50)))
+		assert.Nil(t, p.PushBlockEvent(testBlock(49)))
+		assert.Equal(t, []int{50}, r.Heights)
+	})
+
+	t.Run("Late arrivals are held until their predecessor is published", func(t *testing.T) {
+		p, r, cleanup := newTestOrderedBlockPublisher(t, 5*time.Second)
+		defer cleanup()
+		assert.Nil(t, p.PushBlockEvent(testBlock(50)))
+
+		wg := sync.WaitGroup{}
+		for _, height := range []int{53, 52, 51} {
+			wg.Add(1)
+			go func(height int) {
+				defer wg.Done()
+				assert.Nil(t, p.PushBlockEvent(testBlock(height)))
+			}(height)
+			time.Sleep(30 * time.Millisecond)
+		}
+		wg.Wait()
+
+		assert.Equal(t, []int{50, 51, 52, 53}, r.Heights)
+	})
+
+	t.Run("Held blocks are published once the timeout expires", func(t *testing.T) {
+		p, r, cleanup := newTestOrderedBlockPublisher(t, 50*time.Millisecond)
+		defer cleanup()
+		assert.Nil(t, p.PushBlockEvent(testBlock(50)))
+
+		start := time.Now()
+		assert.Nil(t, p.PushBlockEvent(testBlock(52)))
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+		assert.Equal(t, []int{50, 52}, r.Heights)
+	})
+
+	t.Run("Without holding", func(t *testing.T) {
+		p, r, cleanup := newTestOrderedBlockPublisher(t, 0)
+		defer cleanup()
+		assert.Nil(t, p.PushBlockEvent(testBlock(50)))
+		assert.Nil(t, p.PushBlockEvent(testBlock(52)))
+		assert.Nil(t, p.PushBlockEvent(testBlock(51)))
+		assert.Equal(t, []int{50, 52}, r.Heights)
+	})
+}
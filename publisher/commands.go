@@ -0,0 +1,166 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
+)
+
+const commandTimeout = 30 * time.Second
+
+type AddressCreator interface {
+	CreateAddress(context.Context, int, string) (*monerorpc.RpcCreatedAddress, error)
+}
+
+// DecodeCommand parses a Command of the expected type. Commands sent with
+// a different major version are rejected.
+func DecodeCommand(payload []byte, cmdType string, data interface{}) error {
+	cmd := events.Command{}
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return fmt.Errorf("Unable to parse command: %s", err)
+	}
+
+	if cmd.Type != cmdType {
+		return fmt.Errorf("Unexpected command type %q, expected %q", cmd.Type, cmdType)
+	}
+
+	major, err := events.MajorVersion(cmd.Version)
+	if err != nil {
+		return fmt.Errorf("Unsupported command version: %s", err)
+	}
+	if supported, _ := events.MajorVersion(events.CommandVersion); major != supported {
+		return fmt.Errorf("Unsupported command version %q", cmd.Version)
+	}
+
+	if len(cmd.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(cmd.Data, data)
+}
+
+// HandleCreateAddress creates a new subaddress through the Monero Wallet RPC
+func HandleCreateAddress(ctx context.Context, payload []byte, ac AddressCreator) events.CommandResponse {
+	req := events.CreateAddressRequest{}
+	if err := DecodeCommand(payload, events.CreateAddressCommand, &req); err != nil {
+		return events.NewCommandErrorResponse(err)
+	}
+
+	addr, err := ac.CreateAddress(ctx, req.AccountIndex, req.Label)
+	if err != nil {
+		return events.NewCommandErrorResponse(err)
+	}
+
+	return events.NewCommandResponse(events.AddressCreated, events.CreatedAddress{
+		Address:      addr.Address,
+		AccountIndex: req.AccountIndex,
+		AddressIndex: addr.AddressIndex,
+		Label:        req.Label,
+	})
+}
+
+// HandleCreateInvoice registers an Invoice in the store, created now
+func HandleCreateInvoice(payload []byte, store *InvoiceStore, now time.Time) events.CommandResponse {
+	req := events.CreateInvoiceRequest{}
+	if err := DecodeCommand(payload, events.CreateInvoiceCommand, &req); err != nil {
+		return events.NewCommandErrorResponse(err)
+	}
+	if req.ExpiresIn < 0 {
+		return events.NewCommandErrorResponse(fmt.Errorf("expires_in can't be negative"))
+	}
+
+	inv, err := events.NewInvoice(req.ID, req.Address, req.Amount, now, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		return events.NewCommandErrorResponse(err)
+	}
+	if err := store.Add(*inv); err != nil {
+		return events.NewCommandErrorResponse(err)
+	}
+
+	inv.AmountXMR = events.FormatXMR(inv.Amount)
+	return events.NewCommandResponse(events.InvoiceCreated, *inv)
+}
+
+// CommandServer serves the publisher's commands through NATS request/reply
+type CommandServer struct {
+	Conn    *nats.Conn
+	Subject string
+	Wallet  AddressCreator
+	// Invoices is where create_invoice commands register the invoices.
+	// They aren't served when nil.
+	Invoices *InvoiceStore
+}
+
+func (s *CommandServer) reply(msg *nats.Msg, resp events.CommandResponse) {
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Unable to encode response to %s: %s", msg.Subject, err)
+		return
+	}
+
+	if err := msg.Respond(payload); err != nil {
+		log.Printf("Unable to respond to %s: %s", msg.Subject, err)
+	}
+}
+
+func (s *CommandServer) handleCreateAddress(msg *nats.Msg) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	s.reply(msg, HandleCreateAddress(ctx, msg.Data, s.Wallet))
+}
+
+func (s *CommandServer) handleCreateInvoice(msg *nats.Msg) {
+	s.reply(msg, HandleCreateInvoice(msg.Data, s.Invoices, time.Now()))
+}
+
+// Serve subscribes to the commands' subjects, and serves them until the
+// context is done
+func (s *CommandServer) Serve(ctx context.Context) error {
+	handlers := map[string]nats.MsgHandler{events.CreateAddressCommand: s.handleCreateAddress}
+	if s.Invoices != nil {
+		handlers[events.CreateInvoiceCommand] = s.handleCreateInvoice
+	}
+
+	subs := []*nats.Subscription{}
+	drain := func() error {
+		var err error
+		for _, sub := range subs {
+			if drainErr := sub.Drain(); drainErr != nil && err == nil {
+				err = drainErr
+			}
+		}
+		return err
+	}
+	for cmdType, handler := range handlers {
+		subject := fmt.Sprintf("%s.%s", s.Subject, cmdType)
+		sub, err := s.Conn.Subscribe(subject, handler)
+		if err != nil {
+			drain()
+			return err
+		}
+		subs = append(subs, sub)
+		log.Printf("Serving %s", subject)
+	}
+
+	<-ctx.Done()
+	return drain()
+}
+
+func NewCommandServer(natsHost string, wallet AddressCreator) (*CommandServer, error) {
+	nc, err := nats.Connect(natsHost)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CommandServer{
+		Conn:    nc,
+		Subject: events.CommandsSubject,
+		Wallet:  wallet,
+	}, nil
+}
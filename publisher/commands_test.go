@@ -0,0 +1,169 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-streaming-server/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
+)
+
+type MockedAddressCreator struct {
+	AccountArgs []int
+	LabelArgs   []string
+	Address     *monerorpc.RpcCreatedAddress
+	Err         error
+}
+
+func (m *MockedAddressCreator) CreateAddress(ctx context.Context, account int, label string) (*monerorpc.RpcCreatedAddress, error) {
+	m.AccountArgs = append(m.AccountArgs, account)
+	m.LabelArgs = append(m.LabelArgs, label)
+	return m.Address, m.Err
+}
+
+func TestHandleCreateAddress(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		ac := MockedAddressCreator{Address: &monerorpc.RpcCreatedAddress{Address: "addr", AddressIndex: 3}}
+		payload := []byte(`{"type": "create_address", "version": "1.0", "data": {"account_index": 1, "label": "order 1"}}`)
+
+		resp := HandleCreateAddress(context.Background(), payload, &ac)
+		assert.Empty(t, resp.Error)
+		assert.Equal(t, events.AddressCreated, resp.Type)
+		assert.Equal(t, events.CommandVersion, resp.Version)
+		assert.Equal(t, events.CreatedAddress{Address: "addr", AccountIndex: 1, AddressIndex: 3, Label: "order 1"}, resp.Data)
+
+		assert.Equal(t, []int{1}, ac.AccountArgs)
+		assert.Equal(t, []string{"order 1"}, ac.LabelArgs)
+	})
+
+	errorCases := []struct {
+		Description string
+		Payload     string
+	}{
+		{"Malformed command", `[]`},
+		{"Wrong command type", `{"type": "something_else", "version": "1.0", "data": {}}`},
+		{"Unsupported version", `{"type": "create_address", "version": "2.0", "data": {}}`},
+		{"Malformed data", `{"type": "create_address", "version": "1.0", "data": {"account_index": "x"}}`},
+	}
+	for _, c := range errorCases {
+		t.Run(c.Description, func(t *testing.T) {
+			ac := MockedAddressCreator{}
+
+			resp := HandleCreateAddress(context.Background(), []byte(c.Payload), &ac)
+			assert.Equal(t, events.CommandFailed, resp.Type)
+			assert.NotEmpty(t, resp.Error)
+			assert.Equal(t, 0, len(ac.AccountArgs))
+		})
+	}
+
+	t.Run("RPC Error", func(t *testing.T) {
+		ac := MockedAddressCreator{Err: fmt.Errorf("Dummy error")}
+		payload := []byte(`{"type": "create_address", "version": "1.0", "data": {}}`)
+
+		resp := HandleCreateAddress(context.Background(), payload, &ac)
+		assert.Equal(t, events.CommandFailed, resp.Type)
+		assert.Equal(t, "Dummy error", resp.Error)
+	})
+}
+
+func TestHandleCreateInvoice(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-commands")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	store := NewInvoiceStore(dir)
+	now := time.Unix(1000, 0)
+
+	payload := []byte(`{"type": "create_invoice", "version": "1.0", "data": {"id": "inv1", "address": "addr1", "amount": 5, "expires_in": 60}}`)
+	resp := HandleCreateInvoice(payload, store, now)
+	assert.Empty(t, resp.Error)
+	assert.Equal(t, events.InvoiceCreated, resp.Type)
+	inv := resp.Data.(events.Invoice)
+	assert.Equal(t, "inv1", inv.ID)
+	assert.Equal(t, int64(1060), inv.ExpiresAt)
+
+	invoices, err := store.List()
+	assert.Nil(t, err)
+	assert.Len(t, invoices, 1)
+	assert.Equal(t, events.InvoicePending, invoices[0].Status)
+
+	errorCases := []struct {
+		Description string
+		Payload     string
+	}{
+		{"Wrong command type", `{"type": "create_address", "version": "1.0", "data": {"address": "addr2", "amount": 5}}`},
+		{"No address", `{"type": "create_invoice", "version": "1.0", "data": {"amount": 5}}`},
+		{"No amount", `{"type": "create_invoice", "version": "1.0", "data": {"address": "addr2"}}`},
+		{"Negative expiry", `{"type": "create_invoice", "version": "1.0", "data": {"address": "addr2", "amount": 5, "expires_in": -1}}`},
+		{"Address of an open invoice", `{"type": "create_invoice", "version": "1.0", "data": {"address": "addr1", "amount": 5}}`},
+	}
+	for _, c := range errorCases {
+		t.Run(c.Description, func(t *testing.T) {
+			resp := HandleCreateInvoice([]byte(c.Payload), store, now)
+			assert.Equal(t, events.CommandFailed, resp.Type)
+			assert.NotEmpty(t, resp.Error)
+		})
+	}
+
+	invoices, err = store.List()
+	assert.Nil(t, err)
+	assert.Len(t, invoices, 1)
+}
+
+func TestCommandServerServe(t *testing.T) {
+	ss, err := server.RunServer(ClusterID)
+	assert.Nil(t, err)
+	defer ss.Shutdown()
+
+	ac := MockedAddressCreator{Address: &monerorpc.RpcCreatedAddress{Address: "addr", AddressIndex: 3}}
+	cs, err := NewCommandServer(ss.ClientURL(), &ac)
+	assert.Nil(t, err)
+	defer cs.Conn.Close()
+
+	dir, err := ioutil.TempDir("", "publisher-commands")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	cs.Invoices = NewInvoiceStore(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- cs.Serve(ctx) }()
+
+	nc, err := nats.Connect(ss.ClientURL())
+	assert.Nil(t, err)
+	defer nc.Close()
+
+	// Wait for the subscription to be in place
+	subject := events.CommandsSubject + "." + events.CreateAddressCommand
+	var msg *nats.Msg
+	for i := 0; i < 20; i++ {
+		msg, err = nc.Request(subject, []byte(`{"type": "create_address", "version": "1.0", "data": {"account_index": 1}}`), time.Second)
+		if err == nil {
+			break
+		}
+	}
+	assert.Nil(t, err)
+
+	resp := events.CommandResponse{Data: &events.CreatedAddress{}}
+	assert.Nil(t, json.Unmarshal(msg.Data, &resp))
+	assert.Equal(t, events.AddressCreated, resp.Type)
+	assert.Equal(t, "addr", resp.Data.(*events.CreatedAddress).Address)
+	assert.Equal(t, 1, resp.Data.(*events.CreatedAddress).AccountIndex)
+
+	msg, err = nc.Request(events.CommandsSubject+"."+events.CreateInvoiceCommand, []byte(`{"type": "create_invoice", "version": "1.0", "data": {"address": "addr", "amount": 5}}`), time.Second)
+	assert.Nil(t, err)
+	resp = events.CommandResponse{Data: &events.Invoice{}}
+	assert.Nil(t, json.Unmarshal(msg.Data, &resp))
+	assert.Equal(t, events.InvoiceCreated, resp.Type)
+	assert.Equal(t, uint64(5), resp.Data.(*events.Invoice).Amount)
+
+	cancel()
+	assert.Nil(t, <-done)
+}
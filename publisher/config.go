@@ -0,0 +1,246 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+// Duration is a time.Duration written as a string (e.g. "10s") in the
+// config file
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(raw []byte) error {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return fmt.Errorf("durations must be strings like \"10s\": %s", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+type WalletConfig struct {
+	Name          string `json:"name"`
+	URL           string `json:"url"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	SubjectPrefix string `json:"subject_prefix"`
+	// Proxy is the SOCKS5 proxy to reach the wallet through. Defaults to
+	// --wallet-proxy.
+	Proxy string `json:"proxy"`
+	// StartHeight is the height to look for Txs from. Defaults to the
+	// wallet's height when the watcher starts.
+	StartHeight int `json:"start_height"`
+}
+
+// Channel is the NATS channel the wallet's events are published to
+func (w *WalletConfig) Channel() string {
+	if w.SubjectPrefix == "" {
+		return events.DefaultChannel
+	}
+	return fmt.Sprintf("%s.%s", w.SubjectPrefix, events.DefaultChannel)
+}
+
+// Config is the publisher's configuration file, for the settings that
+// don't fit in CLI flags
+type Config struct {
+	PollInterval Duration       `json:"poll_interval"`
+	Wallets      []WalletConfig `json:"wallets"`
+	// Sink is where the events are published. NATS when not set
+	Sink *SinkConfig `json:"sink"`
+	// Sinks fan the events out to several sinks instead, each with its
+	// own delivery policy
+	Sinks []SinkConfig `json:"sinks"`
+	// Encryption lists the subjects whose events are encrypted, and who
+	// for
+	Encryption []EncryptionConfig `json:"encryption"`
+	// Rules drop or route Txs, before they are published
+	Rules []Rule `json:"rules"`
+	// Profiles publish the events rendered their own way too
+	Profiles []ProfileConfig `json:"profiles"`
+
+	profiles []*Profile
+}
+
+// OutputProfiles are the Profiles, as parsed when the config was loaded
+func (c *Config) OutputProfiles() []*Profile {
+	return c.profiles
+}
+
+// EncryptionConfig encrypts the data of the events published to Subject
+// for its recipients
+type EncryptionConfig struct {
+	Subject    string            `json:"subject"`
+	Recipients []RecipientConfig `json:"recipients"`
+}
+
+type RecipientConfig struct {
+	KeyID string `json:"key_id"`
+	// PublicKeyFile holds the base64 NaCl box public key of the recipient
+	PublicKeyFile string `json:"public_key_file"`
+}
+
+// Encrypter builds the Encrypter of the subject, or nil when its events
+// aren't encrypted
+func (c *Config) Encrypter(subject string) (*events.Encrypter, error) {
+	for _, enc := range c.Encryption {
+		if enc.Subject != subject {
+			continue
+		}
+
+		encrypter := &events.Encrypter{}
+		for _, r := range enc.Recipients {
+			recipient, err := events.LoadRecipient(r.KeyID, r.PublicKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("recipient %s of %s: %s", r.KeyID, subject, err)
+			}
+			encrypter.Recipients = append(encrypter.Recipients, recipient)
+		}
+		return encrypter, nil
+	}
+	return nil, nil
+}
+
+func (c *Config) validate() error {
+	names := map[string]bool{}
+	for i, w := range c.Wallets {
+		if w.Name == "" {
+			return fmt.Errorf("wallet #%d has no name", i)
+		}
+		if names[w.Name] {
+			return fmt.Errorf("wallet name %s is not unique", w.Name)
+		}
+		names[w.Name] = true
+
+		if w.URL == "" {
+			return fmt.Errorf("wallet %s has no url", w.Name)
+		}
+	}
+
+	if c.Sink != nil {
+		if len(c.Sinks) > 0 {
+			return fmt.Errorf("sink and sinks can't be both set")
+		}
+		if err := c.Sink.validate(); err != nil {
+			return err
+		}
+	}
+
+	sinkNames := map[string]bool{}
+	for _, s := range c.Sinks {
+		if err := s.validate(); err != nil {
+			return err
+		}
+		if s.Retries > 0 {
+			return fmt.Errorf("sink %s: retries only apply to a single sink, use retry_budget", s.TargetName())
+		}
+		if sinkNames[s.TargetName()] {
+			return fmt.Errorf("sink name %s is not unique", s.TargetName())
+		}
+		sinkNames[s.TargetName()] = true
+	}
+
+	subjects := map[string]bool{}
+	for _, enc := range c.Encryption {
+		if enc.Subject == "" {
+			return fmt.Errorf("encryption without subject")
+		}
+		if subjects[enc.Subject] {
+			return fmt.Errorf("encryption subject %s is not unique", enc.Subject)
+		}
+		subjects[enc.Subject] = true
+
+		if len(enc.Recipients) == 0 {
+			return fmt.Errorf("encryption of %s has no recipients", enc.Subject)
+		}
+		for _, r := range enc.Recipients {
+			if r.KeyID == "" || r.PublicKeyFile == "" {
+				return fmt.Errorf("recipients of %s need a key_id and a public_key_file", enc.Subject)
+			}
+		}
+	}
+
+	ruleNames := map[string]bool{}
+	for _, r := range c.Rules {
+		if err := r.validate(); err != nil {
+			return err
+		}
+		if ruleNames[r.Name] {
+			return fmt.Errorf("rule name %s is not unique", r.Name)
+		}
+		ruleNames[r.Name] = true
+
+		// Routed Txs may come from an encrypted subject, so they'd leak if
+		// their own subject was in cleartext
+		if r.Action == RuleRoute && len(c.Encryption) > 0 && !subjects[r.Subject] {
+			return fmt.Errorf("rule %s routes to %s, which isn't encrypted while other subjects are", r.Name, r.Subject)
+		}
+	}
+
+	c.profiles = nil
+	profileNames := map[string]bool{}
+	for _, pc := range c.Profiles {
+		p, err := NewProfile(pc)
+		if err != nil {
+			return err
+		}
+		if profileNames[p.Name] {
+			return fmt.Errorf("profile name %s is not unique", p.Name)
+		}
+		profileNames[p.Name] = true
+
+		// Profiles render the events of every subject, so they'd leak
+		// the encrypted ones if they were published in cleartext
+		if len(c.Encryption) > 0 && !subjects[p.Subject] {
+			return fmt.Errorf("profile %s publishes to %s, which isn't encrypted while other subjects are", p.Name, p.Subject)
+		}
+		if p.Encrypter, err = c.Encrypter(p.Subject); err != nil {
+			return fmt.Errorf("profile %s: %s", p.Name, err)
+		}
+		c.profiles = append(c.profiles, p)
+	}
+
+	if c.PollInterval.Duration < 0 {
+		return fmt.Errorf("poll_interval can't be negative")
+	}
+	return nil
+}
+
+func NewConfig() *Config {
+	return &Config{
+		PollInterval: Duration{10 * time.Second},
+	}
+}
+
+// LoadConfig reads the JSON config file, filling the missing settings
+// with their defaults
+func LoadConfig(path string) (*Config, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewConfig()
+	if err := json.Unmarshal(raw, c); err != nil {
+		return nil, fmt.Errorf("Unable to parse config %s: %s", path, err)
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid config %s: %s", path, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,240 @@
+package publisher
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func writeTestConfig(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "publisher-config")
+	assert.Nil(t, err)
+
+	path := filepath.Join(dir, "config.json")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadConfig(t *testing.T) {
+	path, cleanup := writeTestConfig(t, `{
+		"poll_interval": "30s",
+		"wallets": [
+			{"name": "merchant1", "url": "http://wallet1:38083", "username": "user", "password": "pass", "subject_prefix": "merchant1"},
+			{"name": "merchant2", "url": "http://wallet2:38083", "start_height": 100}
+		]
+	}`)
+	defer cleanup()
+
+	config, err := LoadConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 30*time.Second, config.PollInterval.Duration)
+	assert.Equal(t, 2, len(config.Wallets))
+	assert.Equal(t, "user", config.Wallets[0].Username)
+	assert.Equal(t, "merchant1.monero", config.Wallets[0].Channel())
+	assert.Equal(t, "monero", config.Wallets[1].Channel())
+	assert.Equal(t, 100, config.Wallets[1].StartHeight)
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	path, cleanup := writeTestConfig(t, `{}`)
+	defer cleanup()
+
+	config, err := LoadConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, config.PollInterval.Duration)
+}
+
+func TestLoadConfigSink(t *testing.T) {
+	path, cleanup := writeTestConfig(t, `{
+		"sink": {"type": "webhook", "url": "http://accounting/hook", "secret": "s3cret", "timeout": "2s", "retries": 1}
+	}`)
+	defer cleanup()
+
+	config, err := LoadConfig(path)
+	assert.Nil(t, err)
+
+	sink, err := NewSink(*config.Sink)
+	assert.Nil(t, err)
+	webhook := sink.(*WebhookSink)
+	assert.Equal(t, "s3cret", webhook.Secret)
+	assert.Equal(t, 1, webhook.Retries)
+	assert.Equal(t, 2*time.Second, webhook.Client.Timeout)
+}
+
+func TestLoadConfigSinks(t *testing.T) {
+	path, cleanup := writeTestConfig(t, `{
+		"sinks": [
+			{"type": "nats", "retry_budget": 2},
+			{"name": "accounting", "type": "webhook", "url": "http://accounting/hook", "best_effort": true, "event_types": ["transaction.created"]}
+		]
+	}`)
+	defer cleanup()
+
+	config, err := LoadConfig(path)
+	assert.Nil(t, err)
+	assert.Len(t, config.Sinks, 2)
+
+	nats := config.Sinks[0].Target(&DummySucessfulPublisher{})
+	assert.Equal(t, "nats", nats.Name)
+	assert.False(t, nats.BestEffort)
+	assert.Equal(t, 2, nats.RetryBudget)
+
+	webhook := config.Sinks[1].Target(&DummySucessfulPublisher{})
+	assert.Equal(t, "accounting", webhook.Name)
+	assert.True(t, webhook.BestEffort)
+	assert.Equal(t, []string{"transaction.created"}, webhook.Types)
+}
+
+func TestConfigEncrypter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "ops.pub")
+	assert.Nil(t, ioutil.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(make([]byte, 32))), 0600))
+
+	config := NewConfig()
+	config.Encryption = []EncryptionConfig{{
+		Subject:    "merchant1.monero",
+		Recipients: []RecipientConfig{{KeyID: "ops", PublicKeyFile: keyFile}},
+	}}
+	assert.Nil(t, config.validate())
+
+	encrypter, err := config.Encrypter("merchant1.monero")
+	assert.Nil(t, err)
+	assert.Equal(t, "ops", encrypter.Recipients[0].KeyID)
+
+	encrypter, err = config.Encrypter("monero")
+	assert.Nil(t, err)
+	assert.Nil(t, encrypter)
+
+	config.Encryption[0].Recipients[0].PublicKeyFile = filepath.Join(dir, "missing.pub")
+	_, err = config.Encrypter("merchant1.monero")
+	assert.Error(t, err)
+}
+
+func TestConfigEncryptedRoutes(t *testing.T) {
+	config := NewConfig()
+	config.Encryption = []EncryptionConfig{{
+		Subject:    events.DefaultChannel,
+		Recipients: []RecipientConfig{{KeyID: "ops", PublicKeyFile: "ops.pub"}},
+	}}
+	config.Rules = []Rule{{Name: "merchant1", Action: RuleRoute, Subject: "merchant1.monero", Match: RuleMatch{Addresses: []string{"addr1"}}}}
+	assert.Error(t, config.validate())
+
+	config.Encryption = append(config.Encryption, EncryptionConfig{
+		Subject:    "merchant1.monero",
+		Recipients: []RecipientConfig{{KeyID: "merchant1", PublicKeyFile: "merchant1.pub"}},
+	})
+	assert.Nil(t, config.validate())
+
+	// Without encryption, routes are in cleartext like everything else
+	config.Encryption = nil
+	assert.Nil(t, config.validate())
+}
+
+func TestConfigEncryptedProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	public, private, err := box.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	keyFile := filepath.Join(dir, "ops.pub")
+	assert.Nil(t, ioutil.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(public[:])), 0600))
+
+	config := NewConfig()
+	config.Encryption = []EncryptionConfig{{
+		Subject:    "merchant1.heights",
+		Recipients: []RecipientConfig{{KeyID: "ops", PublicKeyFile: keyFile}},
+	}}
+	config.Profiles = []ProfileConfig{{Name: "heights", Subject: "merchant1.heights", Types: []string{events.BlockCreated}, Template: "{{.Height}}"}}
+	assert.Nil(t, config.validate())
+
+	rp := &RecordingPublisher{}
+	ep := EventPublishing{Publisher: rp, Profiles: config.OutputProfiles()}
+	assert.Nil(t, ep.PushBlockEvent(events.Block{Hash: "abc", Height: 42}))
+
+	d := &events.Decrypter{KeyID: "ops", PublicKey: public, PrivateKey: private}
+	decrypted, err := d.Decrypt([]byte(rp.Published["merchant1.heights"][0]))
+	assert.Nil(t, err)
+	rendered := ""
+	assert.Nil(t, json.Unmarshal(decrypted, &events.Event{Data: &rendered}))
+	assert.Equal(t, "42", rendered)
+
+	t.Run("Profiles of cleartext subjects are rejected", func(t *testing.T) {
+		config.Profiles[0].Subject = "monero.heights"
+		assert.Error(t, config.validate())
+	})
+}
+
+func TestLoadConfigProfiles(t *testing.T) {
+	path, cleanup := writeTestConfig(t, `{
+		"profiles": [{"name": "heights", "subject": "monero.heights", "events": ["block.created"], "template": "{{.Height}}"}]
+	}`)
+	defer cleanup()
+
+	config, err := LoadConfig(path)
+	assert.Nil(t, err)
+	assert.Len(t, config.OutputProfiles(), 1)
+
+	out, err := config.OutputProfiles()[0].Render(events.Block{Height: 42})
+	assert.Nil(t, err)
+	assert.Equal(t, "42", string(out))
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	errorCases := []struct {
+		Description string
+		Content     string
+	}{
+		{"Malformed JSON", `{`},
+		{"Malformed duration", `{"poll_interval": "ten seconds"}`},
+		{"Numeric duration", `{"poll_interval": 10}`},
+		{"Negative duration", `{"poll_interval": "-1s"}`},
+		{"Wallet without name", `{"wallets": [{"url": "http://wallet1"}]}`},
+		{"Wallet without url", `{"wallets": [{"name": "w1"}]}`},
+		{"Repeated wallet names", `{"wallets": [{"name": "w1", "url": "http://wallet1"}, {"name": "w1", "url": "http://wallet2"}]}`},
+		{"Unknown sink", `{"sink": {"type": "kafka"}}`},
+		{"Webhook sink without url", `{"sink": {"type": "webhook"}}`},
+		{"File sink without path", `{"sink": {"type": "file"}}`},
+		{"Sink and sinks", `{"sink": {"type": "stdout"}, "sinks": [{"type": "nats"}]}`},
+		{"Repeated sink names", `{"sinks": [{"type": "webhook", "url": "http://a"}, {"type": "webhook", "url": "http://b"}]}`},
+		{"Encryption without subject", `{"encryption": [{"recipients": [{"key_id": "ops", "public_key_file": "ops.pub"}]}]}`},
+		{"Encryption without recipients", `{"encryption": [{"subject": "monero"}]}`},
+		{"Recipient without key", `{"encryption": [{"subject": "monero", "recipients": [{"key_id": "ops"}]}]}`},
+		{"Rule without name", `{"rules": [{"action": "drop"}]}`},
+		{"Rule with unknown action", `{"rules": [{"name": "r1", "action": "ignore"}]}`},
+		{"Route without subject", `{"rules": [{"name": "r1", "action": "route"}]}`},
+		{"Repeated rule names", `{"rules": [{"name": "r1", "action": "drop"}, {"name": "r1", "action": "drop"}]}`},
+		{"Invalid profile template", `{"profiles": [{"name": "p1", "subject": "s", "events": ["block.created"], "template": "{{.TXID}}"}]}`},
+		{"Repeated profile names", `{"profiles": [{"name": "p1", "subject": "s", "events": ["block.created"], "template": "{{.Hash}}"}, {"name": "p1", "subject": "s", "events": ["block.created"], "template": "{{.Hash}}"}]}`},
+		{"Retries in sinks", `{"sinks": [{"type": "webhook", "url": "http://a", "retries": 3}]}`},
+		{"Negative retry budget", `{"sinks": [{"type": "nats", "retry_budget": -1}]}`},
+	}
+	for _, c := range errorCases {
+		t.Run(c.Description, func(t *testing.T) {
+			path, cleanup := writeTestConfig(t, c.Content)
+			defer cleanup()
+
+			config, err := LoadConfig(path)
+			assert.Nil(t, config)
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("Missing file", func(t *testing.T) {
+		config, err := LoadConfig("/does/not/exist.json")
+		assert.Nil(t, config)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,120 @@
+// Package publisher gathers the context of Monero Txs and blocks, and
+// publishes it as events, through NATS Streaming by default.
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+// Publisher sends the serialized events to a channel
+type Publisher interface {
+	Publish([]byte, string) error
+	IsConnected() bool
+}
+
+// EventPublishing builds the events and hands them to the Publisher
+type EventPublishing struct {
+	Publisher Publisher
+	// Channel the events are published to. Defaults to "monero"
+	Channel string
+	// StringAmounts adds the atomic amounts encoded as strings, for
+	// consumers (e.g. JavaScript) that can't decode uint64 numbers
+	StringAmounts bool
+	// Encrypter seals the data of the events, when set
+	Encrypter *events.Encrypter
+	// Signer signs the events, when set. The signature covers the
+	// sealed data of encrypted events.
+	Signer events.Signer
+	// Profiles also publish the events, rendered their own way, to their
+	// own subjects. They're encrypted for the recipients of their subject,
+	// if any, but not signed.
+	Profiles []*Profile
+}
+
+func (ep *EventPublishing) IsConnected() bool {
+	return ep.Publisher.IsConnected()
+}
+
+func (ep *EventPublishing) PushEvent(ev interface{}) error {
+	if e, ok := ev.(events.Event); ok && ep.Encrypter != nil {
+		// The payload of encrypted events isn't logged in cleartext
+		log.Printf("Event: %s %s (encrypted)", e.Type, events.EventID(e.Data))
+	} else {
+		log.Printf("Event Payload: %+v", ev)
+	}
+	cleartext, isEvent := ev.(events.Event)
+	if e, ok := ev.(events.Event); ok && ep.Encrypter != nil {
+		encrypted, err := ep.Encrypter.Encrypt(e)
+		if err != nil {
+			return fmt.Errorf("Unable to encrypt %s event: %w", e.Type, err)
+		}
+		ev = encrypted
+	}
+	channel := ep.Channel
+	if channel == "" {
+		channel = events.DefaultChannel
+	}
+
+	if e, ok := ev.(events.Event); ok && ep.Signer != nil {
+		signed, err := ep.Signer.Sign(e, channel)
+		if err != nil {
+			return fmt.Errorf("Unable to sign %s event: %w", e.Type, err)
+		}
+		ev = signed
+	}
+
+	jsonPayload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	if err := ep.Publisher.Publish(jsonPayload, channel); err != nil {
+		// TODO: return retriable/non-retriable error
+		return err
+	}
+
+	if isEvent && len(ep.Profiles) > 0 {
+		ep.pushProfiles(cleartext)
+	}
+	return nil
+}
+
+func (ep *EventPublishing) PushTxEvent(tx events.Tx) error {
+	if ep.StringAmounts {
+		dests := make([]events.Destination, len(tx.Destinations))
+		for i, d := range tx.Destinations {
+			d.AmountAtomic = strconv.FormatUint(d.Amount, 10)
+			dests[i] = d
+		}
+		tx.Destinations = dests
+	}
+
+	eventPayload := events.NewTXCreatedEvent(tx)
+	return ep.PushEvent(eventPayload)
+}
+
+func (ep *EventPublishing) PushUnresolvedTxEvent(tx events.UnresolvedTx) error {
+	ev := events.NewTxUnresolvedEvent(tx)
+	return ep.PushEvent(ev)
+}
+
+func (ep *EventPublishing) PushBlockEvent(b events.Block) error {
+	ev := events.NewBlockCreatedEvent(b)
+	return ep.PushEvent(ev)
+}
+
+func (ep *EventPublishing) PushInvoiceEvent(evType string, inv events.Invoice) error {
+	ev := events.NewInvoiceEvent(evType, inv)
+	return ep.PushEvent(ev)
+}
+
+func NewNatsPublishingClient(natsHost, clientIDPrefix string) *EventPublishing {
+	return &EventPublishing{
+		Publisher: NewNATSClient(natsHost, clientIDPrefix),
+	}
+}
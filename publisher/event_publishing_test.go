@@ -0,0 +1,239 @@
+package publisher
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"golang.org/x/crypto/nacl/box"
+)
+
+type DummySucessfulPublisher struct {
+	ChannelPassed string
+	PayloadPassed []byte
+}
+
+func (p *DummySucessfulPublisher) Publish(payload []byte, channel string) error {
+	p.ChannelPassed = channel
+	p.PayloadPassed = payload
+
+	return nil
+}
+
+func (p *DummySucessfulPublisher) IsConnected() bool {
+	return true
+}
+
+type DummyFailingPublisher struct{}
+
+func (p *DummyFailingPublisher) Publish(payload []byte, channel string) error {
+	return fmt.Errorf("")
+}
+
+func (p *DummyFailingPublisher) IsConnected() bool {
+	return false
+}
+
+func TestPushTxEventSuccess(t *testing.T) {
+
+	dp := DummySucessfulPublisher{}
+	p := EventPublishing{Publisher: &dp}
+
+	assert.Zero(t, dp.ChannelPassed)
+	assert.Zero(t, dp.PayloadPassed)
+
+	tx := events.Tx{
+		TXID: "some tx id",
+		Destinations: []events.Destination{
+			{Amount: 2, Address: "addr1"},
+			{Amount: 4, Address: "addr2"},
+		},
+	}
+	assert.Nil(t, p.PushTxEvent(tx))
+	assert.Equal(t, events.DefaultChannel, dp.ChannelPassed)
+
+	evTx := events.Tx{}
+	evPayload := events.Event{Data: &evTx}
+	assert.Nil(t, json.Unmarshal(dp.PayloadPassed, &evPayload))
+
+	assert.NotNil(t, evPayload.Version)
+	assert.Equal(t, events.TxCreated, evPayload.Type)
+	assert.Equal(t, tx.TXID, evTx.TXID)
+}
+
+func TestPushTxEventFailure(t *testing.T) {
+	dp := DummyFailingPublisher{}
+	p := EventPublishing{Publisher: &dp}
+
+	tx := events.Tx{}
+	assert.Error(t, p.PushTxEvent(tx))
+}
+
+func TestPushBlockEventSuccess(t *testing.T) {
+	dp := DummySucessfulPublisher{}
+	p := EventPublishing{Publisher: &dp}
+
+	assert.Zero(t, dp.ChannelPassed)
+	assert.Zero(t, dp.PayloadPassed)
+
+	blk := events.Block{
+		Hash:       "some hash",
+		Height:     300,
+		Timestamp:  9000,
+		PrevHashes: []string{"hash of prev block"},
+		TxHashes:   []string{"tx1", "tx2"},
+	}
+	assert.Nil(t, p.PushBlockEvent(blk))
+	assert.Equal(t, events.DefaultChannel, dp.ChannelPassed)
+
+	evBlk := events.Block{}
+	evPayload := events.Event{Data: &evBlk}
+	assert.Nil(t, json.Unmarshal(dp.PayloadPassed, &evPayload))
+
+	assert.NotNil(t, evPayload.Version)
+	assert.Equal(t, events.BlockCreated, evPayload.Type)
+	assert.Equal(t, blk.Hash, evBlk.Hash)
+}
+
+func TestPushBlockEventFailure(t *testing.T) {
+	dp := DummyFailingPublisher{}
+	p := EventPublishing{Publisher: &dp}
+
+	blk := events.Block{}
+	assert.Error(t, p.PushBlockEvent(blk))
+}
+
+func TestPushInvoiceEventSuccess(t *testing.T) {
+	dp := DummySucessfulPublisher{}
+	p := EventPublishing{Publisher: &dp}
+
+	inv := events.Invoice{
+		ID:       "order-1",
+		Address:  "addr1",
+		Amount:   10,
+		Received: 10,
+		Status:   events.InvoicePaid,
+		Txids:    []string{"tx1"},
+	}
+	assert.Nil(t, p.PushInvoiceEvent(events.InvoicePaidEvent, inv))
+	assert.Equal(t, events.DefaultChannel, dp.ChannelPassed)
+
+	evInv := events.Invoice{}
+	evPayload := events.Event{Data: &evInv}
+	assert.Nil(t, json.Unmarshal(dp.PayloadPassed, &evPayload))
+
+	assert.Equal(t, events.InvoicePaidEvent, evPayload.Type)
+	assert.Equal(t, events.InvoiceVersion, evPayload.Version)
+	inv.AmountXMR, inv.ReceivedXMR = "0.000000000010", "0.000000000010"
+	assert.Equal(t, inv, evInv)
+}
+
+func TestPushTxEventStringAmounts(t *testing.T) {
+	for _, stringAmounts := range []bool{false, true} {
+		t.Run(fmt.Sprintf("StringAmounts %t", stringAmounts), func(t *testing.T) {
+			dp := DummySucessfulPublisher{}
+			p := EventPublishing{Publisher: &dp, StringAmounts: stringAmounts}
+
+			tx := events.Tx{
+				TXID:         "some tx id",
+				Destinations: []events.Destination{{Amount: 18446744073709551615, AmountXMR: "18446744.073709551615", Address: "addr1"}},
+			}
+			assert.Nil(t, p.PushTxEvent(tx))
+
+			evTx := events.Tx{}
+			evPayload := events.Event{Data: &evTx}
+			assert.Nil(t, json.Unmarshal(dp.PayloadPassed, &evPayload))
+
+			assert.Equal(t, events.TxVersion, evPayload.Version)
+			assert.Equal(t, tx.Destinations[0].Amount, evTx.Destinations[0].Amount)
+			assert.Equal(t, tx.Destinations[0].AmountXMR, evTx.Destinations[0].AmountXMR)
+			if stringAmounts {
+				assert.Equal(t, "18446744073709551615", evTx.Destinations[0].AmountAtomic)
+			} else {
+				assert.Empty(t, evTx.Destinations[0].AmountAtomic)
+			}
+
+			// The Tx passed by the caller is left untouched
+			assert.Empty(t, tx.Destinations[0].AmountAtomic)
+		})
+	}
+}
+
+func TestPushUnresolvedTxEventSuccess(t *testing.T) {
+	dp := DummySucessfulPublisher{}
+	p := EventPublishing{Publisher: &dp}
+
+	tx := events.UnresolvedTx{TXID: "some tx id", Reason: "some reason", Attempts: 3, WaitedMs: 2000}
+	assert.Nil(t, p.PushUnresolvedTxEvent(tx))
+
+	evTx := events.UnresolvedTx{}
+	evPayload := events.Event{Data: &evTx}
+	assert.Nil(t, json.Unmarshal(dp.PayloadPassed, &evPayload))
+
+	assert.Equal(t, events.TxUnresolved, evPayload.Type)
+	assert.Equal(t, tx, evTx)
+}
+
+func TestPushEventCustomChannel(t *testing.T) {
+	dp := DummySucessfulPublisher{}
+	p := EventPublishing{Publisher: &dp, Channel: "merchant1.monero"}
+
+	assert.Nil(t, p.PushTxEvent(events.Tx{TXID: "some tx id", Wallet: "merchant1"}))
+	assert.Equal(t, "merchant1.monero", dp.ChannelPassed)
+}
+
+func TestPushEventWriterPublisher(t *testing.T) {
+	out := bytes.Buffer{}
+	ep := EventPublishing{Publisher: &WriterPublisher{W: &out}}
+
+	assert.Nil(t, ep.PushBlockEvent(events.Block{Hash: "a", Height: 1}))
+	assert.Nil(t, ep.PushBlockEvent(events.Block{Hash: "b", Height: 2}))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+	ev := events.Event{Data: &events.Block{}}
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &ev))
+	assert.Equal(t, events.BlockCreated, ev.Type)
+	assert.Equal(t, "b", ev.Data.(*events.Block).Hash)
+}
+
+func TestPushEventSigned(t *testing.T) {
+	dp := DummySucessfulPublisher{}
+	ep := EventPublishing{
+		Publisher: &dp,
+		Signer:    &events.HMACSigner{KeyID: "key1", Key: []byte("s3cret")},
+	}
+	assert.Nil(t, ep.PushBlockEvent(events.Block{Hash: "abc"}))
+
+	verifier := events.NewVerifier()
+	verifier.AddHMACKey("key1", []byte("s3cret"))
+	ev, err := verifier.Verify(dp.PayloadPassed, events.DefaultChannel)
+	assert.Nil(t, err)
+	assert.Equal(t, events.BlockCreated, ev.Type)
+}
+
+func TestPushEventEncryptedIsNotLogged(t *testing.T) {
+	public, _, err := box.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	dp := DummySucessfulPublisher{}
+	ep := EventPublishing{
+		Publisher: &dp,
+		Encrypter: &events.Encrypter{Recipients: []events.Recipient{{KeyID: "ops", PublicKey: public}}},
+	}
+
+	logged := bytes.Buffer{}
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	assert.Nil(t, ep.PushTxEvent(events.Tx{TXID: "abc", Destinations: []events.Destination{{Address: "addr1", Amount: 5}}}))
+	assert.Contains(t, logged.String(), "transaction.created abc (encrypted)")
+	assert.NotContains(t, logged.String(), "addr1")
+	assert.NotContains(t, string(dp.PayloadPassed), "addr1")
+}
@@ -0,0 +1,259 @@
+package publisher
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Target is one of the publishers a FanOutPublisher publishes to, with its
+// delivery policy
+type Target struct {
+	Name      string
+	Publisher Publisher
+	// BestEffort targets don't fail the publishing when they fail. Their
+	// failures are only reported.
+	BestEffort bool
+	// RetryBudget is how many more times a failed publish is attempted
+	RetryBudget int
+	// Types are the event types published to the target. All of them
+	// when empty
+	Types []string
+}
+
+func (t *Target) accepts(evType string) bool {
+	if len(t.Types) == 0 {
+		return true
+	}
+	for _, typ := range t.Types {
+		if typ == evType {
+			return true
+		}
+	}
+	return false
+}
+
+// Outcome is how publishing an event to a Target went
+type Outcome struct {
+	Target     string
+	BestEffort bool
+	// Skipped is set when the Target doesn't take the event's type
+	Skipped  bool
+	Attempts int
+	Err      error
+}
+
+const (
+	// DefaultMaxPending is how many best effort publishes may be in flight
+	// at once
+	DefaultMaxPending = 64
+	// DefaultDrainTimeout is how long Close waits for the best effort
+	// publishes in flight
+	DefaultDrainTimeout = 10 * time.Second
+)
+
+// ErrTooManyPending is the outcome of the best effort publishes dropped
+// because MaxPending publishes were already in flight
+var ErrTooManyPending = errors.New("too many best effort publishes in flight")
+
+var (
+	// sinkPublished counts the events published to each target
+	sinkPublished = expvar.NewMap("sink_published")
+	// sinkFailed counts the events that failed to publish to each target
+	sinkFailed = expvar.NewMap("sink_failed")
+)
+
+// ReportOutcomes counts the outcomes in the sink_published and sink_failed
+// expvar maps, and logs the failures
+func ReportOutcomes(channel string, outcomes []Outcome) {
+	for _, o := range outcomes {
+		switch {
+		case o.Skipped:
+		case o.Err != nil:
+			sinkFailed.Add(o.Target, 1)
+			log.Printf("Failed to publish to %s on %s after %d attempts: %s", o.Target, channel, o.Attempts, o.Err)
+		default:
+			sinkPublished.Add(o.Target, 1)
+		}
+	}
+}
+
+// FanOutError is returned when required targets fail. Outcomes holds the
+// outcomes of the required targets.
+type FanOutError struct {
+	Outcomes []Outcome
+}
+
+func (e *FanOutError) Error() string {
+	failures := []string{}
+	for _, o := range e.Outcomes {
+		if o.Err != nil && !o.BestEffort {
+			failures = append(failures, fmt.Sprintf("%s: %s", o.Target, o.Err))
+		}
+	}
+	return fmt.Sprintf("Failed to publish to required targets (%s)", strings.Join(failures, "; "))
+}
+
+// FanOutPublisher publishes every event to all its targets concurrently,
+// so that a slow or failing target doesn't hold back the other ones. It
+// returns once the required targets are done, and only fails when one of
+// them fails. The best effort targets finish in the background.
+type FanOutPublisher struct {
+	Targets []Target
+	// Report is given the outcomes of every event, once the best effort
+	// targets are done too. The failures are logged when it's nil.
+	Report func(channel string, outcomes []Outcome)
+	// MaxPending bounds the best effort publishes in flight. The ones
+	// over it are dropped. DefaultMaxPending when 0.
+	MaxPending int
+	// DrainTimeout is how long Close waits for the best effort publishes
+	// in flight. DefaultDrainTimeout when 0.
+	DrainTimeout time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	pending  sync.WaitGroup
+}
+
+func (p *FanOutPublisher) publish(t *Target, payload []byte, channel string) Outcome {
+	outcome := Outcome{Target: t.Name, BestEffort: t.BestEffort}
+	for outcome.Attempts <= t.RetryBudget {
+		outcome.Attempts++
+		if outcome.Err = t.Publisher.Publish(payload, channel); outcome.Err == nil {
+			break
+		}
+	}
+	return outcome
+}
+
+// acquire reserves one of the MaxPending best effort slots
+func (p *FanOutPublisher) acquire() bool {
+	max := p.MaxPending
+	if max <= 0 {
+		max = DefaultMaxPending
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.inFlight >= max {
+		return false
+	}
+	p.inFlight++
+	return true
+}
+
+func (p *FanOutPublisher) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inFlight--
+}
+
+func (p *FanOutPublisher) report(evType, channel string, outcomes []Outcome) {
+	if p.Report != nil {
+		p.Report(channel, outcomes)
+		return
+	}
+	for _, o := range outcomes {
+		if o.Err != nil {
+			log.Printf("Failed to publish %s to %s after %d attempts: %s", evType, o.Target, o.Attempts, o.Err)
+		}
+	}
+}
+
+func (p *FanOutPublisher) Publish(payload []byte, channel string) error {
+	ev := struct {
+		Type string `json:"type"`
+	}{}
+	// Payloads that aren't events only go to the targets without types
+	json.Unmarshal(payload, &ev)
+
+	outcomes := make([]Outcome, len(p.Targets))
+	required, all := sync.WaitGroup{}, sync.WaitGroup{}
+	for i := range p.Targets {
+		t := &p.Targets[i]
+		if !t.accepts(ev.Type) {
+			outcomes[i] = Outcome{Target: t.Name, BestEffort: t.BestEffort, Skipped: true}
+			continue
+		}
+		if t.BestEffort && !p.acquire() {
+			outcomes[i] = Outcome{Target: t.Name, BestEffort: true, Err: ErrTooManyPending}
+			continue
+		}
+
+		all.Add(1)
+		if !t.BestEffort {
+			required.Add(1)
+		}
+		go func(i int) {
+			defer all.Done()
+			if t.BestEffort {
+				defer p.release()
+			} else {
+				defer required.Done()
+			}
+			outcomes[i] = p.publish(t, payload, channel)
+		}(i)
+	}
+	required.Wait()
+
+	// Only the outcomes of the required targets are read here, since the
+	// best effort ones may still be running
+	failures := []Outcome{}
+	for i, t := range p.Targets {
+		if !t.BestEffort && outcomes[i].Err != nil {
+			failures = append(failures, outcomes[i])
+		}
+	}
+
+	p.pending.Add(1)
+	go func() {
+		defer p.pending.Done()
+		all.Wait()
+		p.report(ev.Type, channel, outcomes)
+	}()
+
+	if len(failures) > 0 {
+		return &FanOutError{Outcomes: failures}
+	}
+	return nil
+}
+
+// IsConnected tells whether every required target is connected
+func (p *FanOutPublisher) IsConnected() bool {
+	for _, t := range p.Targets {
+		if !t.BestEffort && !t.Publisher.IsConnected() {
+			return false
+		}
+	}
+	return true
+}
+
+// Close waits up to DrainTimeout for the best effort publishes in flight,
+// and then closes the targets that are Sinks
+func (p *FanOutPublisher) Close() {
+	timeout := p.DrainTimeout
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+	drained := make(chan struct{})
+	go func() {
+		p.pending.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(timeout):
+		log.Printf("Gave up waiting for the best effort publishes after %s", timeout)
+	}
+
+	for _, t := range p.Targets {
+		if sink, ok := t.Publisher.(Sink); ok {
+			sink.Close()
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package publisher
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+// FlakyPublisher fails its first Failures publishes
+type FlakyPublisher struct {
+	DummySucessfulPublisher
+	Failures int
+	Calls    int
+}
+
+func (p *FlakyPublisher) Publish(payload []byte, channel string) error {
+	p.Calls++
+	if p.Calls <= p.Failures {
+		return errors.New("unavailable")
+	}
+	return p.DummySucessfulPublisher.Publish(payload, channel)
+}
+
+func TestFanOutPublisher(t *testing.T) {
+	nats := &FlakyPublisher{Failures: 1}
+	webhook := &FlakyPublisher{Failures: 10}
+	blocks := &FlakyPublisher{}
+
+	var reported []Outcome
+	fanOut := &FanOutPublisher{
+		Targets: []Target{
+			{Name: "nats", Publisher: nats, RetryBudget: 1},
+			{Name: "webhook", Publisher: webhook, BestEffort: true, RetryBudget: 2},
+			{Name: "blocks", Publisher: blocks, Types: []string{events.BlockCreated}},
+		},
+		Report: func(channel string, outcomes []Outcome) {
+			assert.Equal(t, "monero", channel)
+			reported = outcomes
+		},
+	}
+
+	ep := EventPublishing{Publisher: fanOut}
+	assert.Nil(t, ep.PushTxEvent(events.Tx{TXID: "abc"}))
+
+	// Closing waits for the best effort targets, and the report
+	fanOut.Close()
+	assert.Equal(t, []Outcome{
+		{Target: "nats", Attempts: 2},
+		{Target: "webhook", BestEffort: true, Attempts: 3, Err: errors.New("unavailable")},
+		{Target: "blocks", Skipped: true},
+	}, reported)
+	assert.Contains(t, string(nats.PayloadPassed), `"txid":"abc"`)
+	assert.Nil(t, blocks.PayloadPassed)
+
+	assert.Nil(t, ep.PushBlockEvent(events.Block{Hash: "def"}))
+	assert.Contains(t, string(blocks.PayloadPassed), `"hash":"def"`)
+}
+
+func TestFanOutPublisherRequiredFailure(t *testing.T) {
+	nats := &FlakyPublisher{Failures: 10}
+	webhook := &FlakyPublisher{}
+	fanOut := &FanOutPublisher{Targets: []Target{
+		{Name: "nats", Publisher: nats, RetryBudget: 2},
+		{Name: "webhook", Publisher: webhook, BestEffort: true},
+	}}
+
+	err := fanOut.Publish([]byte(`{"type":"block.created"}`), "monero")
+	var fanOutErr *FanOutError
+	assert.True(t, errors.As(err, &fanOutErr))
+	assert.Equal(t, 3, nats.Calls)
+	assert.Equal(t, "Failed to publish to required targets (nats: unavailable)", err.Error())
+
+	fanOut.Close()
+	assert.Equal(t, 1, webhook.Calls)
+}
+
+// BlockingPublisher blocks its publishes until Release is closed
+type BlockingPublisher struct {
+	DummySucessfulPublisher
+	Release chan struct{}
+}
+
+func (p *BlockingPublisher) Publish(payload []byte, channel string) error {
+	<-p.Release
+	return nil
+}
+
+func TestFanOutPublisherBestEffortInBackground(t *testing.T) {
+	nats := &FlakyPublisher{}
+	webhook := &BlockingPublisher{Release: make(chan struct{})}
+	reports := make(chan []Outcome, 3)
+	fanOut := &FanOutPublisher{
+		Targets: []Target{
+			{Name: "nats", Publisher: nats},
+			{Name: "webhook", Publisher: webhook, BestEffort: true},
+		},
+		Report:     func(channel string, outcomes []Outcome) { reports <- outcomes },
+		MaxPending: 1,
+	}
+
+	// The stuck webhook doesn't hold back the required target
+	assert.Nil(t, fanOut.Publish([]byte(`{"type":"block.created"}`), "monero"))
+	assert.Nil(t, fanOut.Publish([]byte(`{"type":"block.created"}`), "monero"))
+	assert.Equal(t, 2, nats.Calls)
+
+	// The second publish is over MaxPending, so the webhook is skipped
+	second := <-reports
+	assert.Equal(t, ErrTooManyPending, second[1].Err)
+
+	close(webhook.Release)
+	fanOut.Close()
+	first := <-reports
+	assert.Nil(t, first[1].Err)
+}
+
+func TestFanOutPublisherDrainTimeout(t *testing.T) {
+	webhook := &BlockingPublisher{Release: make(chan struct{})}
+	defer close(webhook.Release)
+	fanOut := &FanOutPublisher{
+		Targets:      []Target{{Name: "webhook", Publisher: webhook, BestEffort: true}},
+		DrainTimeout: 10 * time.Millisecond,
+	}
+
+	assert.Nil(t, fanOut.Publish([]byte(`{"type":"block.created"}`), "monero"))
+	fanOut.Close()
+}
@@ -0,0 +1,217 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+const (
+	invoicesFileName     = "invoices.json"
+	invoicesLockFileName = "invoices.lock"
+	// InvoiceExpiryInterval is how often the long running commands expire
+	// the overdue Invoices
+	InvoiceExpiryInterval = time.Minute
+)
+
+// InvoiceStore keeps the registered Invoices in the local state directory.
+// The changes go through Update, which holds LockPath, so that concurrent
+// publisher processes don't overwrite each other's changes.
+type InvoiceStore struct {
+	Store    *JSONFileStore
+	LockPath string
+}
+
+func (s *InvoiceStore) List() ([]events.Invoice, error) {
+	invoices := []events.Invoice{}
+	if err := s.Store.Load(&invoices); err != nil {
+		return nil, err
+	}
+	return invoices, nil
+}
+
+func (s *InvoiceStore) Save(invoices []events.Invoice) error {
+	return s.Store.Save(invoices)
+}
+
+// Update applies fn to the stored Invoices while holding the lock, and
+// saves them if fn returns true, even along with an error, so that the
+// changes made before the error are kept.
+func (s *InvoiceStore) Update(fn func(*[]events.Invoice) (bool, error)) error {
+	if err := os.MkdirAll(filepath.Dir(s.LockPath), 0700); err != nil {
+		return err
+	}
+	lock := &FileLock{Path: s.LockPath}
+	if err := lock.Lock(); err != nil && !errors.Is(err, ErrLockUnsupported) {
+		return fmt.Errorf("Unable to acquire lock %s: %s", s.LockPath, err)
+	}
+	defer lock.Unlock()
+
+	invoices, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	changed, err := fn(&invoices)
+	if changed {
+		if saveErr := s.Save(invoices); saveErr != nil {
+			return saveErr
+		}
+	}
+	return err
+}
+
+// Add registers a new Invoice. Invoice IDs must be unique, and only one open
+// Invoice may expect payments on a given address.
+func (s *InvoiceStore) Add(inv events.Invoice) error {
+	return s.Update(func(invoices *[]events.Invoice) (bool, error) {
+		for _, other := range *invoices {
+			if other.ID == inv.ID {
+				return false, fmt.Errorf("invoice %s already exists", inv.ID)
+			}
+			if other.Address == inv.Address && other.IsOpen() {
+				return false, fmt.Errorf("address %s is already used by open invoice %s", inv.Address, other.ID)
+			}
+		}
+
+		*invoices = append(*invoices, inv)
+		return true, nil
+	})
+}
+
+func NewInvoiceStore(stateDir string) *InvoiceStore {
+	return &InvoiceStore{
+		Store:    NewJSONFileStore(stateDir, invoicesFileName),
+		LockPath: filepath.Join(stateDir, invoicesLockFileName),
+	}
+}
+
+type InvoiceEventPublisher interface {
+	PushInvoiceEvent(string, events.Invoice) error
+}
+
+// InvoiceTracker matches the Txs being published against the registered
+// Invoices, and publishes an Invoice event every time one of them changes.
+type InvoiceTracker struct {
+	Store     *InvoiceStore
+	Publisher InvoiceEventPublisher
+	Now       func() time.Time
+	// DryRun publishes the events without saving the Invoice changes
+	DryRun bool
+}
+
+// update applies fn to the stored Invoices, and saves them unless DryRun is
+// set
+func (t *InvoiceTracker) update(fn func(*[]events.Invoice) (bool, error)) error {
+	if !t.DryRun {
+		return t.Store.Update(fn)
+	}
+
+	invoices, err := t.Store.List()
+	if err != nil {
+		return err
+	}
+	_, err = fn(&invoices)
+	return err
+}
+
+// Expire marks the overdue Invoices as expired and publishes their events
+func (t *InvoiceTracker) Expire() error {
+	return t.update(t.expire)
+}
+
+// ExpireEvery expires the overdue Invoices every interval, until the
+// context is done. Failures are logged, and retried the next time.
+func (t *InvoiceTracker) ExpireEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Expire(); err != nil {
+				log.Printf("Unable to expire invoices: %s", err)
+			}
+		}
+	}
+}
+
+func (t *InvoiceTracker) expire(stored *[]events.Invoice) (bool, error) {
+	invoices := *stored
+	changed := false
+	now := t.Now()
+	for i := range invoices {
+		if !invoices[i].IsExpired(now) {
+			continue
+		}
+
+		status := invoices[i].Status
+		invoices[i].Status = events.InvoiceExpired
+		if err := t.Publisher.PushInvoiceEvent(events.InvoiceEventType(invoices[i]), invoices[i]); err != nil {
+			// Only the Invoices expired so far are saved
+			invoices[i].Status = status
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// Track applies the Tx to the open Invoices. Overdue Invoices are expired
+// before that, so a late Tx is not counted towards them.
+func (t *InvoiceTracker) Track(tx events.Tx) error {
+	return t.update(func(stored *[]events.Invoice) (bool, error) {
+		changed, err := t.expire(stored)
+		if err != nil {
+			return changed, err
+		}
+
+		invoices := *stored
+		for i := range invoices {
+			before := invoices[i]
+			before.Txids = append([]string{}, invoices[i].Txids...)
+			if !invoices[i].ApplyTx(tx) {
+				continue
+			}
+
+			if err := t.Publisher.PushInvoiceEvent(events.InvoiceEventType(invoices[i]), invoices[i]); err != nil {
+				// The Invoice is left untouched, so the Tx will be
+				// counted again the next time it is processed
+				invoices[i] = before
+				return changed, err
+			}
+			changed = true
+		}
+		return changed, nil
+	})
+}
+
+func NewInvoiceTracker(stateDir string, p InvoiceEventPublisher) *InvoiceTracker {
+	return &InvoiceTracker{
+		Store:     NewInvoiceStore(stateDir),
+		Publisher: p,
+		Now:       time.Now,
+	}
+}
+
+// InvoiceTrackingPublisher publishes Tx events, and then the events of the
+// Invoices that those Txs pay.
+type InvoiceTrackingPublisher struct {
+	TxEventPublisher
+	Tracker *InvoiceTracker
+}
+
+func (p *InvoiceTrackingPublisher) PushTxEvent(tx events.Tx) error {
+	if err := p.TxEventPublisher.PushTxEvent(tx); err != nil {
+		return err
+	}
+
+	return p.Tracker.Track(tx)
+}
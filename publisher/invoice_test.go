@@ -0,0 +1,207 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+type MockedInvoiceEventPublisher struct {
+	EventTypes []string
+	Invoices   []events.Invoice
+	Err        error
+}
+
+func (p *MockedInvoiceEventPublisher) PushInvoiceEvent(evType string, inv events.Invoice) error {
+	p.EventTypes = append(p.EventTypes, evType)
+	p.Invoices = append(p.Invoices, inv)
+	return p.Err
+}
+
+func newTestInvoiceTracker(t *testing.T) (*InvoiceTracker, *MockedInvoiceEventPublisher, func()) {
+	dir, err := ioutil.TempDir("", "publisher-invoices")
+	assert.Nil(t, err)
+
+	p := &MockedInvoiceEventPublisher{}
+	tracker := NewInvoiceTracker(dir, p)
+	tracker.Now = func() time.Time { return time.Unix(1000, 0) }
+
+	return tracker, p, func() { os.RemoveAll(dir) }
+}
+
+func TestInvoiceStoreAdd(t *testing.T) {
+	tracker, _, cleanup := newTestInvoiceTracker(t)
+	defer cleanup()
+	store := tracker.Store
+
+	assert.Nil(t, store.Add(events.Invoice{ID: "1", Address: "addr1", Status: events.InvoicePending}))
+	assert.Error(t, store.Add(events.Invoice{ID: "1", Address: "addr2", Status: events.InvoicePending}))
+	assert.Error(t, store.Add(events.Invoice{ID: "2", Address: "addr1", Status: events.InvoicePending}))
+
+	invoices, err := store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(invoices))
+
+	t.Run("Address of a paid invoice is reused", func(t *testing.T) {
+		assert.Nil(t, store.Add(events.Invoice{ID: "paid", Address: "addr3", Status: events.InvoicePaid}))
+		assert.Nil(t, store.Add(events.Invoice{ID: "new", Address: "addr3", Status: events.InvoicePending}))
+	})
+}
+
+func TestInvoiceStoreConcurrentUpdates(t *testing.T) {
+	tracker, _, cleanup := newTestInvoiceTracker(t)
+	defer cleanup()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// A store per goroutine, like separate publisher processes
+			store := NewInvoiceStore(filepath.Dir(tracker.Store.Store.Path))
+			assert.Nil(t, store.Add(events.Invoice{ID: fmt.Sprint(i), Address: fmt.Sprintf("addr%d", i), Status: events.InvoicePending}))
+		}(i)
+	}
+	wg.Wait()
+
+	invoices, err := tracker.Store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(invoices))
+}
+
+func TestInvoiceTrackerTrack(t *testing.T) {
+	t.Run("Publishes an event per changed invoice", func(t *testing.T) {
+		tracker, p, cleanup := newTestInvoiceTracker(t)
+		defer cleanup()
+
+		assert.Nil(t, tracker.Store.Add(events.Invoice{ID: "1", Address: "addr1", Amount: 10, Status: events.InvoicePending}))
+		assert.Nil(t, tracker.Store.Add(events.Invoice{ID: "2", Address: "addr2", Amount: 10, Status: events.InvoicePending}))
+		assert.Nil(t, tracker.Store.Add(events.Invoice{ID: "3", Address: "addr3", Amount: 10, Status: events.InvoicePending}))
+
+		tx := events.Tx{
+			TXID: "tx1",
+			Destinations: []events.Destination{
+				{Address: "addr1", Amount: 10},
+				{Address: "addr2", Amount: 11},
+			},
+		}
+		assert.Nil(t, tracker.Track(tx))
+		assert.Equal(t, []string{events.InvoicePaidEvent, events.InvoiceOverpaidEvent}, p.EventTypes)
+		assert.Equal(t, []string{"tx1"}, p.Invoices[0].Txids)
+
+		// Processing the same Tx again doesn't publish anything
+		assert.Nil(t, tracker.Track(tx))
+		assert.Equal(t, 2, len(p.EventTypes))
+	})
+
+	t.Run("Publishing fails", func(t *testing.T) {
+		tracker, p, cleanup := newTestInvoiceTracker(t)
+		defer cleanup()
+		p.Err = fmt.Errorf("Dummy error")
+
+		assert.Nil(t, tracker.Store.Add(events.Invoice{ID: "1", Address: "addr1", Amount: 10, Status: events.InvoicePending}))
+
+		tx := events.Tx{TXID: "tx1", Destinations: []events.Destination{{Address: "addr1", Amount: 10}}}
+		assert.Error(t, tracker.Track(tx))
+
+		// The invoice was not updated, so the Tx will be counted next time
+		invoices, err := tracker.Store.List()
+		assert.Nil(t, err)
+		assert.Equal(t, events.InvoicePending, invoices[0].Status)
+	})
+
+	t.Run("Overdue invoices expire before the Tx is applied", func(t *testing.T) {
+		tracker, p, cleanup := newTestInvoiceTracker(t)
+		defer cleanup()
+
+		assert.Nil(t, tracker.Store.Add(events.Invoice{ID: "1", Address: "addr1", Amount: 10, Status: events.InvoicePending, ExpiresAt: 900}))
+		assert.Nil(t, tracker.Store.Add(events.Invoice{ID: "2", Address: "addr2", Amount: 10, Status: events.InvoicePaid, ExpiresAt: 900}))
+
+		tx := events.Tx{TXID: "tx1", Destinations: []events.Destination{{Address: "addr1", Amount: 10}}}
+		assert.Nil(t, tracker.Track(tx))
+
+		// Paid invoices never expire
+		assert.Equal(t, []string{events.InvoiceExpiredEvent}, p.EventTypes)
+		assert.Equal(t, "1", p.Invoices[0].ID)
+
+		invoices, err := tracker.Store.List()
+		assert.Nil(t, err)
+		assert.Equal(t, events.InvoiceExpired, invoices[0].Status)
+		assert.Zero(t, invoices[0].Received)
+		assert.Equal(t, events.InvoicePaid, invoices[1].Status)
+	})
+}
+
+func TestInvoiceTrackerDryRun(t *testing.T) {
+	tracker, p, cleanup := newTestInvoiceTracker(t)
+	defer cleanup()
+	tracker.DryRun = true
+
+	assert.Nil(t, tracker.Store.Add(events.Invoice{ID: "1", Address: "addr1", Amount: 10, Status: events.InvoicePending, ExpiresAt: 900}))
+	assert.Nil(t, tracker.Expire())
+	assert.Equal(t, []string{events.InvoiceExpiredEvent}, p.EventTypes)
+
+	// The events are published, but the invoice is left as it was
+	invoices, err := tracker.Store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, events.InvoicePending, invoices[0].Status)
+}
+
+func TestInvoiceTrackerExpireEvery(t *testing.T) {
+	tracker, p, cleanup := newTestInvoiceTracker(t)
+	defer cleanup()
+
+	assert.Nil(t, tracker.Store.Add(events.Invoice{ID: "1", Address: "addr1", Amount: 10, Status: events.InvoicePending, ExpiresAt: 900}))
+	assert.Nil(t, tracker.Store.Add(events.Invoice{ID: "2", Address: "addr2", Amount: 10, Status: events.InvoicePending, ExpiresAt: 1100}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tracker.ExpireEvery(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	// Expired once, without waiting for a Tx
+	assert.Equal(t, []string{events.InvoiceExpiredEvent}, p.EventTypes)
+	assert.Equal(t, "1", p.Invoices[0].ID)
+	invoices, err := tracker.Store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, events.InvoiceExpired, invoices[0].Status)
+	assert.Equal(t, events.InvoicePending, invoices[1].Status)
+}
+
+func TestInvoiceTrackingPublisher(t *testing.T) {
+	tracker, p, cleanup := newTestInvoiceTracker(t)
+	defer cleanup()
+	assert.Nil(t, tracker.Store.Add(events.Invoice{ID: "1", Address: "addr1", Amount: 10, Status: events.InvoicePending}))
+
+	t.Run("Tx event publishing fails", func(t *testing.T) {
+		txPublisher := MockedTxPublisher{Returns: []error{fmt.Errorf("Dummy error")}}
+		publisher := InvoiceTrackingPublisher{TxEventPublisher: &txPublisher, Tracker: tracker}
+
+		tx := events.Tx{TXID: "tx1", Destinations: []events.Destination{{Address: "addr1", Amount: 10}}}
+		assert.Error(t, publisher.PushTxEvent(tx))
+		assert.Equal(t, 0, len(p.EventTypes))
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		txPublisher := MockedTxPublisher{Returns: []error{nil}}
+		publisher := InvoiceTrackingPublisher{TxEventPublisher: &txPublisher, Tracker: tracker}
+
+		tx := events.Tx{TXID: "tx1", Destinations: []events.Destination{{Address: "addr1", Amount: 10}}}
+		assert.Nil(t, publisher.PushTxEvent(tx))
+		assert.Equal(t, 1, txPublisher.CallsCount)
+		assert.Equal(t, []string{events.InvoicePaidEvent}, p.EventTypes)
+	})
+}
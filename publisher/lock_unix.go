@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package publisher
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileLock is an exclusive advisory lock on a local file, used to
+// serialize the publisher processes that run concurrently on one host
+type FileLock struct {
+	Path string
+	file *os.File
+}
+
+// Lock blocks until the lock is acquired
+func (l *FileLock) Lock() error {
+	f, err := os.OpenFile(l.Path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file = f
+	return nil
+}
+
+func (l *FileLock) Unlock() error {
+	if l.file == nil {
+		return nil
+	}
+
+	// Closing the file releases the lock
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package publisher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-lock")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.lock")
+	first := FileLock{Path: path}
+	second := FileLock{Path: path}
+
+	assert.Nil(t, first.Lock())
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- second.Lock()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("The lock was acquired twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.Nil(t, first.Unlock())
+	assert.Nil(t, <-acquired)
+	assert.Nil(t, second.Unlock())
+
+	// Unlocking twice is harmless
+	assert.Nil(t, second.Unlock())
+}
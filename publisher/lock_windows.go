@@ -0,0 +1,14 @@
+package publisher
+
+// FileLock is not supported on Windows
+type FileLock struct {
+	Path string
+}
+
+func (l *FileLock) Lock() error {
+	return ErrLockUnsupported
+}
+
+func (l *FileLock) Unlock() error {
+	return nil
+}
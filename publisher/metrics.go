@@ -0,0 +1,36 @@
+package publisher
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// metricNames are the expvar vars of the publisher. They count what the
+// process did since it started.
+var metricNames = []string{"rules_dropped", "rules_routed", "rules_allowed", "sink_published", "sink_failed", "profiles_failed"}
+
+// MetricsHandler serves the publisher's metrics as a JSON object at
+// /debug/vars, like expvar does, but without the other vars of the process
+// (e.g. its command line)
+func MetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/vars", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		vars := []string{}
+		for _, name := range metricNames {
+			if v := expvar.Get(name); v != nil {
+				vars = append(vars, fmt.Sprintf("%q: %s", name, v.String()))
+			}
+		}
+		fmt.Fprintf(w, "{\n%s\n}\n", strings.Join(vars, ",\n"))
+	})
+	return mux
+}
+
+// ServeMetrics serves MetricsHandler on addr
+func ServeMetrics(addr string) error {
+	return http.ListenAndServe(addr, MetricsHandler())
+}
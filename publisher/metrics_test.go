@@ -0,0 +1,29 @@
+package publisher
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	rulesDropped.Add("metrics-test", 2)
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vars", nil))
+	assert.Equal(t, 200, rec.Code)
+
+	vars := map[string]map[string]int{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &vars))
+	assert.Equal(t, 2, vars["rules_dropped"]["metrics-test"])
+	assert.Contains(t, vars, "sink_failed")
+	// The other vars of the process aren't served
+	assert.NotContains(t, vars, "cmdline")
+	assert.NotContains(t, vars, "memstats")
+
+	rec = httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	assert.Equal(t, 404, rec.Code)
+}
@@ -0,0 +1,167 @@
+package publisher
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	stan "github.com/nats-io/stan.go"
+)
+
+const (
+	ClusterID             = "test-cluster"
+	DefaultClientIDPrefix = "publisher"
+)
+
+// invalidClientIDChars matches what NATS Streaming doesn't accept in client IDs
+var invalidClientIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// NewClientID builds a client ID that is unique per process, so that
+// concurrent hook invocations aren't rejected as duplicate clients.
+// It looks like <prefix>-<host>-<pid>-<random suffix>.
+func NewClientID(prefix string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		// Very unlikely. The pid is still unique on this host
+		suffix = []byte{}
+	}
+
+	id := fmt.Sprintf("%s-%s-%d-%s", prefix, host, os.Getpid(), hex.EncodeToString(suffix))
+	return invalidClientIDChars.ReplaceAllString(id, "_")
+}
+
+type NATSClient struct {
+	ClusterID string
+	ClientID  string
+	NATSHost  string
+	// Persistent keeps the connections open between Publish calls,
+	// for long-running processes. They must be closed with Close.
+	Persistent bool
+
+	mu sync.Mutex
+	nc *nats.Conn
+	sc stan.Conn
+}
+
+func (c *NATSClient) IsConnected() bool {
+	nc, err := nats.Connect(c.NATSHost)
+	if err != nil {
+		log.Printf("Unable to connect to NATS at %s: %s", c.NATSHost, err)
+		return false
+	}
+	defer nc.Close()
+
+	return nc.IsConnected()
+}
+
+func (c *NATSClient) connect() (*nats.Conn, stan.Conn, error) {
+	nc, err := nats.Connect(c.NATSHost)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sc, err := stan.Connect(c.ClusterID, c.ClientID, stan.NatsConn(nc))
+	if err != nil {
+		nc.Close()
+		return nil, nil, err
+	}
+
+	return nc, sc, nil
+}
+
+func (c *NATSClient) Publish(payload []byte, channel string) error {
+	if c.Persistent {
+		return c.publishPersistent(payload, channel)
+	}
+
+	nc, sc, err := c.connect()
+	if err != nil {
+		return err
+	}
+	// Closing the streaming connection doesn't close the NATS one it was
+	// given
+	defer nc.Close()
+	defer sc.Close()
+
+	if err := sc.Publish(channel, payload); err != nil {
+		// TODO: return retriable/non-retriable error
+		return err
+	}
+
+	return nil
+}
+
+// publishPersistent reuses the open connections. If publishing through them
+// fails, they are replaced once with fresh ones.
+func (c *NATSClient) publishPersistent(payload []byte, channel string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sc != nil {
+		if err := c.sc.Publish(channel, payload); err == nil {
+			return nil
+		}
+		c.close()
+	}
+
+	nc, sc, err := c.connect()
+	if err != nil {
+		return err
+	}
+	c.nc, c.sc = nc, sc
+
+	return c.sc.Publish(channel, payload)
+}
+
+func (c *NATSClient) close() {
+	if c.sc != nil {
+		c.sc.Close()
+		c.sc = nil
+	}
+	if c.nc != nil {
+		c.nc.Close()
+		c.nc = nil
+	}
+}
+
+// Close closes the connections kept open by a Persistent client
+func (c *NATSClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.close()
+}
+
+func NewNATSClient(host, clientIDPrefix string) *NATSClient {
+	return &NATSClient{
+		NATSHost:  host,
+		ClientID:  NewClientID(clientIDPrefix),
+		ClusterID: ClusterID,
+	}
+}
+
+// LockingPublisher holds a local file lock while publishing, so that
+// concurrent publisher processes publish one at a time
+type LockingPublisher struct {
+	Publisher
+	Lock *FileLock
+}
+
+func (p *LockingPublisher) Publish(payload []byte, channel string) error {
+	if err := p.Lock.Lock(); err != nil {
+		return fmt.Errorf("Unable to acquire lock %s: %s", p.Lock.Path, err)
+	}
+	defer p.Lock.Unlock()
+
+	return p.Publisher.Publish(payload, channel)
+}
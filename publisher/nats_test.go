@@ -0,0 +1,114 @@
+package publisher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nats-io/nats-streaming-server/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNATSPublishtSuccess(t *testing.T) {
+	payload := []byte("testing")
+
+	channelID := "monero"
+
+	ss, err := server.RunServer(ClusterID)
+	assert.Nil(t, err)
+	assert.NotNil(t, ss)
+	defer ss.Shutdown()
+
+	publisher := NewNATSClient(ss.ClientURL(), DefaultClientIDPrefix)
+	err = publisher.Publish(payload, channelID)
+	assert.Nil(t, err)
+}
+
+func TestPushTxEventFailedToConnect(t *testing.T) {
+	payload := []byte("testing")
+
+	channelID := "monero"
+
+	publisher := NewNATSClient("nats://127.0.0.1:4222", DefaultClientIDPrefix)
+	err := publisher.Publish(payload, channelID)
+	assert.Error(t, err)
+}
+
+func TestNewClientID(t *testing.T) {
+	id1 := NewClientID("my.prefix")
+	id2 := NewClientID("my.prefix")
+
+	assert.NotEqual(t, id1, id2)
+	assert.True(t, strings.HasPrefix(id1, "my_prefix-"))
+	assert.Contains(t, id1, fmt.Sprintf("-%d-", os.Getpid()))
+	assert.Regexp(t, `^[a-zA-Z0-9_-]+$`, id1)
+}
+
+func TestNATSPublishConcurrentClients(t *testing.T) {
+	ss, err := server.RunServer(ClusterID)
+	assert.Nil(t, err)
+	defer ss.Shutdown()
+
+	// Every publisher connects with its own client ID, so none of them
+	// is rejected as a duplicate
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		go func() {
+			errs <- NewNATSClient(ss.ClientURL(), DefaultClientIDPrefix).Publish([]byte("testing"), "monero")
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, <-errs)
+	}
+}
+
+func TestLockingPublisher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-lock")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	dp := DummySucessfulPublisher{}
+	p := LockingPublisher{Publisher: &dp, Lock: &FileLock{Path: filepath.Join(dir, "publish.lock")}}
+
+	assert.Nil(t, p.Publish([]byte("testing"), "monero"))
+	assert.Equal(t, []byte("testing"), dp.PayloadPassed)
+	assert.True(t, p.IsConnected())
+
+	// The lock was released
+	other := FileLock{Path: filepath.Join(dir, "publish.lock")}
+	assert.Nil(t, other.Lock())
+	assert.Nil(t, other.Unlock())
+
+	failing := LockingPublisher{Publisher: &dp, Lock: &FileLock{Path: filepath.Join(dir, "missing", "publish.lock")}}
+	assert.Error(t, failing.Publish([]byte("testing"), "monero"))
+}
+
+func TestNATSPublishPersistent(t *testing.T) {
+	ss, err := server.RunServer(ClusterID)
+	assert.Nil(t, err)
+	defer ss.Shutdown()
+
+	publisher := NewNATSClient(ss.ClientURL(), DefaultClientIDPrefix)
+	publisher.Persistent = true
+	defer publisher.Close()
+
+	assert.Nil(t, publisher.Publish([]byte("testing"), "monero"))
+	sc := publisher.sc
+	assert.NotNil(t, sc)
+
+	// The connection is reused
+	assert.Nil(t, publisher.Publish([]byte("testing"), "monero"))
+	assert.Equal(t, sc, publisher.sc)
+
+	// A broken connection is replaced
+	publisher.sc.Close()
+	assert.Nil(t, publisher.Publish([]byte("testing"), "monero"))
+	assert.NotEqual(t, sc, publisher.sc)
+
+	publisher.Close()
+	assert.Nil(t, publisher.sc)
+	assert.Nil(t, publisher.nc)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package publisher
+
+import "net"
+
+// checkPeer relies on the permissions of the socket file, where the peer
+// credentials are not available
+func checkPeer(conn net.Conn) error {
+	return nil
+}
@@ -0,0 +1,116 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
+)
+
+type TxEventPublisher interface {
+	PushTxEvent(events.Tx) error
+	PushUnresolvedTxEvent(events.UnresolvedTx) error
+}
+
+// ProcessTxid fetches extra context about the Monero Transaction from
+// Monero Wallet RPC. Then publishes a NATS event about the Transaction.
+// If the Tx doesn't become visible within the wait window, a diagnostic
+// event is published instead.
+func ProcessTxid(txid string, ignoreBelowheight int, wait VisibilityWait, rc monerorpc.TxGetter, nc TxEventPublisher) error {
+	ctx := context.Background()
+	tx, err := WaitForTx(ctx, txid, wait, rc)
+	if errors.Is(err, monerorpc.ErrNoIncomingTransfers) {
+		// The Tx is known by the wallet, but is not sending funds to
+		// it, so it's not unresolved. There's nothing to publish.
+		return nil
+	}
+
+	var unresolved *UnresolvedTxError
+	if errors.As(err, &unresolved) && wait.Window > 0 {
+		if pushErr := nc.PushUnresolvedTxEvent(unresolved.UnresolvedTx); pushErr != nil {
+			return pushErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if tx.Height < ignoreBelowheight {
+		// The Tx is below ignoring height. It won't be
+		// published to NATS
+		return nil
+	}
+
+	setLabels(ctx, tx, rc)
+	return nc.PushTxEvent(*tx)
+}
+
+// setLabels sets the labels of the Tx destinations. A failed lookup leaves
+// the label empty, since the Tx is worth publishing without it.
+func setLabels(ctx context.Context, tx *events.Tx, rc monerorpc.TxGetter) {
+	for i, d := range tx.Destinations {
+		label, err := rc.GetAddressLabel(ctx, d.AccountIndex, d.SubaddrIndex)
+		if err != nil {
+			log.Printf("Unable to get the label of address %d/%d of tx %s: %s", d.AccountIndex, d.SubaddrIndex, tx.TXID, err)
+			continue
+		}
+		tx.Destinations[i].Label = label
+	}
+}
+
+type BlockEventPublisher interface {
+	PushBlockEvent(events.Block) error
+}
+
+func ProcessBlockHash(blockHash string, maxExtraAncestors, ignoreBelowHeight int, bg monerorpc.BlockGetter, nc BlockEventPublisher) error {
+	ctx := context.Background()
+	rpcBlock, err := bg.GetBlockByHash(ctx, blockHash)
+	if err != nil {
+		return err
+	}
+
+	if rpcBlock.BlockHeader.Height < ignoreBelowHeight {
+		// Block is below ignoring height. Its ancestors won't be fetched
+		// and it won't be published to NATS
+		return nil
+	}
+
+	blk, err := BlockWithAncestors(ctx, *rpcBlock, maxExtraAncestors, bg)
+	if err != nil {
+		return err
+	}
+
+	return nc.PushBlockEvent(blk)
+}
+
+// BlockWithAncestors converts the block, filling its PrevHashes with the
+// hashes of its parent and up to maxExtraAncestors more ancestors
+func BlockWithAncestors(ctx context.Context, rpcBlock monerorpc.RpcBlock, maxExtraAncestors int, bg monerorpc.BlockGetter) (events.Block, error) {
+	blk := monerorpc.RpcBlockToBlock(rpcBlock)
+
+	if blk.Height == 0 {
+		// Blocks is Genesis Block. It has no ancestors
+		return blk, nil
+	}
+
+	end := blk.Height - 1
+	start := blk.Height - maxExtraAncestors
+	if start < 0 {
+		start = 0
+	}
+
+	blocks, err := bg.GetBlockHeadersRange(ctx, start, end)
+	if err != nil {
+		return events.Block{}, err
+	}
+
+	prevHashes := []string{}
+	for _, b := range blocks {
+		prevHashes = append(prevHashes, b.Hash)
+	}
+	blk.PrevHashes = prevHashes
+
+	return blk, nil
+}
@@ -1,4 +1,4 @@
-package main
+package publisher
 
 import (
 	"context"
@@ -6,15 +6,17 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
 )
 
 type MockedGetBlockReturn struct {
-	b *RpcBlock
+	b *monerorpc.RpcBlock
 	e error
 }
 
 type MockedGetBlocksRangeReturn struct {
-	b []RpcBlockHeader
+	b []monerorpc.RpcBlockHeader
 	e error
 }
 
@@ -32,7 +34,7 @@ type MockedBlockGetter struct {
 	GetBlocksRangeReturns    []MockedGetBlocksRangeReturn
 }
 
-func (g *MockedBlockGetter) GetBlockByHash(c context.Context, h string) (*RpcBlock, error) {
+func (g *MockedBlockGetter) GetBlockByHash(c context.Context, h string) (*monerorpc.RpcBlock, error) {
 	g.HashArgs = append(g.HashArgs, h)
 
 	g.GetBlockCallsCount++
@@ -48,7 +50,7 @@ func (g *MockedBlockGetter) GetBlockByHash(c context.Context, h string) (*RpcBlo
 	return result.b, result.e
 }
 
-func (g *MockedBlockGetter) GetBlockHeadersRange(c context.Context, start, end int) ([]RpcBlockHeader, error) {
+func (g *MockedBlockGetter) GetBlockHeadersRange(c context.Context, start, end int) ([]monerorpc.RpcBlockHeader, error) {
 	arg := MockedGetBlocksRangeArg{start, end}
 	g.GetBlocksRangeArgs = append(g.GetBlocksRangeArgs, arg)
 
@@ -67,11 +69,11 @@ func (g *MockedBlockGetter) GetBlockHeadersRange(c context.Context, start, end i
 
 type MockedBlockEventPublisher struct {
 	CallsCount   int
-	PassedBlocks []Block
+	PassedBlocks []events.Block
 	Returns      []error
 }
 
-func (p *MockedBlockEventPublisher) PushBlockEvent(b Block) error {
+func (p *MockedBlockEventPublisher) PushBlockEvent(b events.Block) error {
 	p.CallsCount++
 
 	p.PassedBlocks = append(p.PassedBlocks, b)
@@ -94,11 +96,11 @@ func TestProcessBlockHash(t *testing.T) {
 		rpcClient := MockedBlockGetter{
 			GetBlockReturns: []MockedGetBlockReturn{
 				{
-					b: &RpcBlock{BlockHeader: RpcBlockHeader{Hash: blockHash}},
+					b: &monerorpc.RpcBlock{BlockHeader: monerorpc.RpcBlockHeader{Hash: blockHash}},
 					e: nil,
 				},
 				{
-					b: &RpcBlock{BlockHeader: RpcBlockHeader{Hash: "Block X-1"}},
+					b: &monerorpc.RpcBlock{BlockHeader: monerorpc.RpcBlockHeader{Hash: "Block X-1"}},
 					e: nil,
 				},
 			},
@@ -125,8 +127,8 @@ func TestProcessBlockHash(t *testing.T) {
 		rpcClient := MockedBlockGetter{
 			GetBlockReturns: []MockedGetBlockReturn{
 				{
-					b: &RpcBlock{
-						BlockHeader: RpcBlockHeader{Hash: hashes[3], Height: heights[3], PrevHash: hashes[2]},
+					b: &monerorpc.RpcBlock{
+						BlockHeader: monerorpc.RpcBlockHeader{Hash: hashes[3], Height: heights[3], PrevHash: hashes[2]},
 					},
 					e: nil,
 				},
@@ -134,7 +136,7 @@ func TestProcessBlockHash(t *testing.T) {
 			GetBlocksRangeReturns: []MockedGetBlocksRangeReturn{
 				{
 					e: nil,
-					b: []RpcBlockHeader{
+					b: []monerorpc.RpcBlockHeader{
 						{Hash: hashes[2], Height: heights[2]},
 						{Hash: hashes[1], Height: heights[1]},
 					},
@@ -169,8 +171,8 @@ func TestProcessBlockHash(t *testing.T) {
 		rpcClient := MockedBlockGetter{
 			GetBlockReturns: []MockedGetBlockReturn{
 				{
-					b: &RpcBlock{
-						BlockHeader: RpcBlockHeader{Hash: hashes[3], Height: heights[3], PrevHash: hashes[2]},
+					b: &monerorpc.RpcBlock{
+						BlockHeader: monerorpc.RpcBlockHeader{Hash: hashes[3], Height: heights[3], PrevHash: hashes[2]},
 					},
 					e: nil,
 				},
@@ -178,7 +180,7 @@ func TestProcessBlockHash(t *testing.T) {
 			GetBlocksRangeReturns: []MockedGetBlocksRangeReturn{
 				{
 					e: nil,
-					b: []RpcBlockHeader{
+					b: []monerorpc.RpcBlockHeader{
 						{Hash: hashes[2], Height: heights[2]},
 						{Hash: hashes[1], Height: heights[1]},
 						{Hash: hashes[0], Height: heights[0]},
@@ -214,8 +216,8 @@ func TestProcessBlockHash(t *testing.T) {
 		rpcClient := MockedBlockGetter{
 			GetBlockReturns: []MockedGetBlockReturn{
 				{
-					b: &RpcBlock{
-						BlockHeader: RpcBlockHeader{Hash: hashes[3], Height: heights[3], PrevHash: hashes[2]},
+					b: &monerorpc.RpcBlock{
+						BlockHeader: monerorpc.RpcBlockHeader{Hash: hashes[3], Height: heights[3], PrevHash: hashes[2]},
 					},
 					e: nil,
 				},
@@ -223,7 +225,7 @@ func TestProcessBlockHash(t *testing.T) {
 			GetBlocksRangeReturns: []MockedGetBlocksRangeReturn{
 				{
 					e: nil,
-					b: []RpcBlockHeader{
+					b: []monerorpc.RpcBlockHeader{
 						{Hash: hashes[2], Height: heights[2]},
 						{Hash: hashes[1], Height: heights[1]},
 					},
@@ -279,8 +281,8 @@ func TestProcessBlockHash(t *testing.T) {
 		rpcClient := MockedBlockGetter{
 			GetBlockReturns: []MockedGetBlockReturn{
 				{
-					b: &RpcBlock{
-						BlockHeader: RpcBlockHeader{Hash: "block 5", Height: 5, PrevHash: "block 4"},
+					b: &monerorpc.RpcBlock{
+						BlockHeader: monerorpc.RpcBlockHeader{Hash: "block 5", Height: 5, PrevHash: "block 4"},
 					},
 					e: nil,
 				},
@@ -315,7 +317,7 @@ func TestProcessBlockHash(t *testing.T) {
 		rpcClient := MockedBlockGetter{
 			GetBlockReturns: []MockedGetBlockReturn{
 				{
-					b: &RpcBlock{BlockHeader: RpcBlockHeader{Hash: blockHash}},
+					b: &monerorpc.RpcBlock{BlockHeader: monerorpc.RpcBlockHeader{Hash: blockHash}},
 					e: nil,
 				},
 			},
@@ -0,0 +1,250 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
+)
+
+type MockedGetTxByTxidReturn struct {
+	Txs []monerorpc.RpcTx
+	E   error
+}
+type MockedTxGetter struct {
+	CallsCount int
+	TxidArgs   []string
+	Returns    []MockedGetTxByTxidReturn
+	Labels     map[monerorpc.RpcSubaddressIndex]string
+	LabelErr   error
+}
+
+func (g *MockedTxGetter) GetTransferByTxid(c context.Context, t string) ([]monerorpc.RpcTx, error) {
+	g.CallsCount++
+
+	g.TxidArgs = append(g.TxidArgs, t)
+
+	// The last entry is returned again on the next calls
+	result := g.Returns[0]
+	if len(g.Returns) > 1 {
+		g.Returns = g.Returns[1:]
+	}
+
+	return result.Txs, result.E
+}
+
+func (g *MockedTxGetter) GetAddressLabel(c context.Context, major, minor int) (string, error) {
+	return g.Labels[monerorpc.RpcSubaddressIndex{Major: major, Minor: minor}], g.LabelErr
+}
+
+type MockedTxPublisher struct {
+	CallsCount     int
+	TxArgs         []events.Tx
+	Returns        []error
+	UnresolvedArgs []events.UnresolvedTx
+}
+
+func (g *MockedTxPublisher) PushUnresolvedTxEvent(tx events.UnresolvedTx) error {
+	g.UnresolvedArgs = append(g.UnresolvedArgs, tx)
+	return nil
+}
+
+func (g *MockedTxPublisher) PushTxEvent(tx events.Tx) error {
+	g.CallsCount++
+
+	g.TxArgs = append(g.TxArgs, tx)
+
+	result := g.Returns[0]
+	if len(g.Returns) > 1 {
+		g.Returns = g.Returns[1:]
+	} else {
+		g.Returns = []error{}
+	}
+
+	return result
+}
+
+func TestProcessTxid(t *testing.T) {
+
+	t.Run("Success", func(t *testing.T) {
+		txid := "dummy tx"
+		txHeight := 3
+		txGetter := MockedTxGetter{
+			Returns: []MockedGetTxByTxidReturn{
+				{
+					E:   nil,
+					Txs: []monerorpc.RpcTx{{TXID: txid, Type: "in", Height: txHeight}},
+				},
+			},
+		}
+		evPublisher := MockedTxPublisher{Returns: []error{nil}}
+
+		ignoreBelowHeight := 0 // Don't ignore any events.Tx
+		err := ProcessTxid(txid, ignoreBelowHeight, VisibilityWait{}, &txGetter, &evPublisher)
+		assert.Nil(t, err)
+
+		assert.Equal(t, 1, evPublisher.CallsCount)
+		assert.Equal(t, txid, evPublisher.TxArgs[0].TXID)
+	})
+
+	t.Run("Success, with subaddress labels", func(t *testing.T) {
+		txid := "dummy tx"
+		txGetter := MockedTxGetter{
+			Returns: []MockedGetTxByTxidReturn{
+				{
+					E: nil,
+					Txs: []monerorpc.RpcTx{
+						{TXID: txid, Type: "in", Address: "addr1", SubaddrIndex: monerorpc.RpcSubaddressIndex{Major: 1, Minor: 2}},
+						{TXID: txid, Type: "in", Address: "addr2", SubaddrIndex: monerorpc.RpcSubaddressIndex{Major: 1, Minor: 3}},
+					},
+				},
+			},
+			Labels: map[monerorpc.RpcSubaddressIndex]string{{Major: 1, Minor: 2}: "order 1"},
+		}
+		evPublisher := MockedTxPublisher{Returns: []error{nil}}
+
+		err := ProcessTxid(txid, 0, VisibilityWait{}, &txGetter, &evPublisher)
+		assert.Nil(t, err)
+
+		assert.Equal(t, 1, evPublisher.CallsCount)
+		dests := evPublisher.TxArgs[0].Destinations
+		assert.Equal(t, "order 1", dests[0].Label)
+		assert.Equal(t, "", dests[1].Label)
+	})
+
+	t.Run("Label lookup fails", func(t *testing.T) {
+		txid := "dummy tx"
+		txGetter := MockedTxGetter{
+			Returns: []MockedGetTxByTxidReturn{
+				{
+					E:   nil,
+					Txs: []monerorpc.RpcTx{{TXID: txid, Type: "in"}},
+				},
+			},
+			LabelErr: fmt.Errorf("Dummy Error"),
+		}
+		evPublisher := MockedTxPublisher{Returns: []error{nil}}
+
+		// Published without the label
+		err := ProcessTxid(txid, 0, VisibilityWait{}, &txGetter, &evPublisher)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, evPublisher.CallsCount)
+		assert.Equal(t, "", evPublisher.TxArgs[0].Destinations[0].Label)
+	})
+
+	t.Run("Success, Tx below ignoring height", func(t *testing.T) {
+		txid := "dummy tx"
+		txHeight := 3
+		txGetter := MockedTxGetter{
+			Returns: []MockedGetTxByTxidReturn{
+				{
+					E:   nil,
+					Txs: []monerorpc.RpcTx{{TXID: txid, Type: "in", Height: txHeight}},
+				},
+			},
+		}
+		evPublisher := MockedTxPublisher{Returns: []error{nil}}
+
+		ignoreBelowHeight := txHeight + 2 // The events.Tx will be ignored
+		err := ProcessTxid(txid, ignoreBelowHeight, VisibilityWait{}, &txGetter, &evPublisher)
+		assert.Nil(t, err)
+
+		assert.Equal(t, 1, txGetter.CallsCount)
+
+		// The Tx was not pushed to NATS, because it is below ignoring height
+		assert.Equal(t, 0, evPublisher.CallsCount)
+	})
+
+	t.Run("RPC Error", func(t *testing.T) {
+		txid := "dummy tx"
+		txGetter := MockedTxGetter{
+			Returns: []MockedGetTxByTxidReturn{
+				{
+					E:   fmt.Errorf("Dummy Error"),
+					Txs: nil,
+				},
+			},
+		}
+		evPublisher := MockedTxPublisher{
+			Returns: []error{nil},
+		}
+
+		ignoreBelowHeight := 0
+		err := ProcessTxid(txid, ignoreBelowHeight, VisibilityWait{}, &txGetter, &evPublisher)
+		assert.Error(t, err)
+
+		assert.Equal(t, 1, txGetter.CallsCount)
+		assert.Equal(t, txid, txGetter.TxidArgs[0])
+
+		assert.Equal(t, 0, evPublisher.CallsCount)
+	})
+
+	t.Run("Tx not visible before the window expires", func(t *testing.T) {
+		txid := "dummy tx"
+		txGetter := MockedTxGetter{
+			Returns: []MockedGetTxByTxidReturn{
+				{E: fmt.Errorf("Dummy Error")},
+				{E: fmt.Errorf("Dummy Error")},
+				{E: fmt.Errorf("Dummy Error")},
+			},
+		}
+		evPublisher := MockedTxPublisher{Returns: []error{nil}}
+
+		wait := VisibilityWait{Window: 3 * time.Millisecond, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+		err := ProcessTxid(txid, 0, wait, &txGetter, &evPublisher)
+		assert.Error(t, err)
+
+		assert.Equal(t, 0, evPublisher.CallsCount)
+		assert.Equal(t, 1, len(evPublisher.UnresolvedArgs))
+		assert.Equal(t, txid, evPublisher.UnresolvedArgs[0].TXID)
+		assert.Equal(t, "Dummy Error", evPublisher.UnresolvedArgs[0].Reason)
+	})
+
+	t.Run("Outgoing Tx is not published", func(t *testing.T) {
+		txid := "dummy tx"
+		txGetter := MockedTxGetter{
+			Returns: []MockedGetTxByTxidReturn{
+				{Txs: []monerorpc.RpcTx{{TXID: txid, Type: "out"}}},
+			},
+		}
+		evPublisher := MockedTxPublisher{Returns: []error{nil}}
+
+		// Not waited for, and not a failure
+		err := ProcessTxid(txid, 0, fastVisibilityWait(time.Minute), &txGetter, &evPublisher)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, txGetter.CallsCount)
+
+		assert.Equal(t, 0, evPublisher.CallsCount)
+		assert.Equal(t, 0, len(evPublisher.UnresolvedArgs))
+	})
+
+	t.Run("Event publishing fails", func(t *testing.T) {
+		txid := "dummy tx"
+		txHeight := 3
+		txGetter := MockedTxGetter{
+			Returns: []MockedGetTxByTxidReturn{
+				{
+					E:   nil,
+					Txs: []monerorpc.RpcTx{{TXID: txid, Type: "in", Height: txHeight}},
+				},
+			},
+		}
+		evPublisher := MockedTxPublisher{
+			Returns: []error{fmt.Errorf("Dummy NATS Error")},
+		}
+
+		ignoreBelowHeight := 0
+		err := ProcessTxid(txid, ignoreBelowHeight, VisibilityWait{}, &txGetter, &evPublisher)
+		assert.Error(t, err)
+
+		assert.Equal(t, 1, txGetter.CallsCount)
+		assert.Equal(t, txid, txGetter.TxidArgs[0])
+
+		assert.Equal(t, 1, evPublisher.CallsCount)
+		assert.Equal(t, txid, evPublisher.TxArgs[0].TXID)
+	})
+}
@@ -0,0 +1,151 @@
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"text/template"
+
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+// ProfileConfig is a named output profile: a text/template rendering the
+// payload of the events of Types, e.g. an events.Tx, to its own Subject
+type ProfileConfig struct {
+	Name     string   `json:"name"`
+	Subject  string   `json:"subject"`
+	Types    []string `json:"events"`
+	Template string   `json:"template"`
+}
+
+// Profile is a ProfileConfig with its template parsed
+type Profile struct {
+	ProfileConfig
+	// Encrypter seals the rendered profiles, when their Subject is
+	// encrypted
+	Encrypter *events.Encrypter
+	tmpl      *template.Template
+}
+
+// profilesFailed counts the events each profile failed to publish
+var profilesFailed = expvar.NewMap("profiles_failed")
+
+var profileFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		raw, err := json.Marshal(v)
+		return string(raw), err
+	},
+	"xmr": events.FormatXMR,
+}
+
+// sampleData are the payloads templates are tried on when they're parsed:
+// one with a single item in every list, so that the fields used in ranges
+// are checked, and one with empty lists, so that indexing them unguarded
+// fails
+func sampleData(evType string) ([]interface{}, bool) {
+	switch evType {
+	case events.TxCreated:
+		return []interface{}{events.Tx{Destinations: []events.Destination{{}}}, events.Tx{}}, true
+	case events.TxUnresolved:
+		return []interface{}{events.UnresolvedTx{}}, true
+	case events.BlockCreated:
+		return []interface{}{events.Block{PrevHashes: []string{""}, TxHashes: []string{""}}, events.Block{}}, true
+	case events.InvoicePaidEvent, events.InvoiceUnderpaidEvent, events.InvoiceOverpaidEvent, events.InvoiceExpiredEvent:
+		return []interface{}{events.Invoice{Txids: []string{""}}, events.Invoice{}}, true
+	}
+	return nil, false
+}
+
+// NewProfile parses the template, and renders it for samples of each of
+// the event types, so that mistakes like unknown fields, or indexing lists
+// that may be empty, show up at startup rather than when an event comes.
+// The samples don't cover everything though, so rendering can still fail
+// on actual events.
+func NewProfile(c ProfileConfig) (*Profile, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("profiles need a name")
+	}
+	if c.Subject == "" {
+		return nil, fmt.Errorf("profile %s has no subject", c.Name)
+	}
+	if len(c.Types) == 0 {
+		return nil, fmt.Errorf("profile %s has no events", c.Name)
+	}
+
+	tmpl, err := template.New(c.Name).Funcs(profileFuncs).Option("missingkey=error").Parse(c.Template)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %s", c.Name, err)
+	}
+
+	p := &Profile{ProfileConfig: c, tmpl: tmpl}
+	for _, evType := range c.Types {
+		samples, ok := sampleData(evType)
+		if !ok {
+			return nil, fmt.Errorf("profile %s: unknown event type %q", c.Name, evType)
+		}
+		for _, sample := range samples {
+			if _, err := p.Render(sample); err != nil {
+				return nil, fmt.Errorf("profile %s doesn't render %s events: %s", c.Name, evType, err)
+			}
+		}
+	}
+	return p, nil
+}
+
+func (p *Profile) accepts(evType string) bool {
+	for _, t := range p.Types {
+		if t == evType {
+			return true
+		}
+	}
+	return false
+}
+
+// Render executes the template on the payload of an event
+func (p *Profile) Render(data interface{}) ([]byte, error) {
+	out := bytes.Buffer{}
+	if err := p.tmpl.Execute(&out, data); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(out.Bytes()), nil
+}
+
+// pushProfiles renders the event for the profiles that take its type, and
+// publishes it to their subjects. The event itself is published by then,
+// so the failures are only logged and counted: failing would have the
+// caller publish the event again.
+func (ep *EventPublishing) pushProfiles(ev events.Event) {
+	for _, p := range ep.Profiles {
+		if !p.accepts(ev.Type) {
+			continue
+		}
+
+		if err := ep.pushProfile(p, ev); err != nil {
+			log.Printf("Failed to publish %s event %s to profile %s: %s", ev.Type, events.EventID(ev.Data), p.Name, err)
+			profilesFailed.Add(p.Name, 1)
+		}
+	}
+}
+
+func (ep *EventPublishing) pushProfile(p *Profile, ev events.Event) error {
+	payload, err := p.Render(ev.Data)
+	if err != nil {
+		return err
+	}
+
+	if p.Encrypter != nil {
+		// The rendered profile is sealed as the data of an event of the
+		// same type, which keeps its ID in cleartext
+		sealed, err := p.Encrypter.Encrypt(events.Event{Type: ev.Type, Version: ev.Version, Data: string(payload)})
+		if err != nil {
+			return err
+		}
+		sealed.ID = events.EventID(ev.Data)
+		if payload, err = json.Marshal(sealed); err != nil {
+			return err
+		}
+	}
+	return ep.Publisher.Publish(payload, p.Subject)
+}
@@ -0,0 +1,89 @@
+package publisher
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+type RecordingPublisher struct {
+	DummySucessfulPublisher
+	Published map[string][]string
+	// Failing are the channels publishing to fails
+	Failing map[string]bool
+}
+
+func (p *RecordingPublisher) Publish(payload []byte, channel string) error {
+	if p.Failing[channel] {
+		return fmt.Errorf("Dummy error")
+	}
+	if p.Published == nil {
+		p.Published = map[string][]string{}
+	}
+	p.Published[channel] = append(p.Published[channel], string(payload))
+	return nil
+}
+
+func (p *RecordingPublisher) Close() {}
+
+func TestNewProfileErrors(t *testing.T) {
+	cases := []struct {
+		Description string
+		Config      ProfileConfig
+	}{
+		{"No name", ProfileConfig{Subject: "s", Types: []string{events.TxCreated}, Template: "{{.TXID}}"}},
+		{"No subject", ProfileConfig{Name: "p", Types: []string{events.TxCreated}, Template: "{{.TXID}}"}},
+		{"No events", ProfileConfig{Name: "p", Subject: "s", Template: "{{.TXID}}"}},
+		{"Unknown event", ProfileConfig{Name: "p", Subject: "s", Types: []string{"tx"}, Template: "{{.TXID}}"}},
+		{"Malformed template", ProfileConfig{Name: "p", Subject: "s", Types: []string{events.TxCreated}, Template: "{{.TXID"}},
+		{"Unknown field", ProfileConfig{Name: "p", Subject: "s", Types: []string{events.TxCreated}, Template: "{{.Txid}}"}},
+		{"Field of another event", ProfileConfig{Name: "p", Subject: "s", Types: []string{events.TxCreated, events.BlockCreated}, Template: "{{.TXID}}"}},
+		{"Unguarded index", ProfileConfig{Name: "p", Subject: "s", Types: []string{events.TxCreated}, Template: "{{(index .Destinations 0).Address}}"}},
+	}
+	for _, c := range cases {
+		t.Run(c.Description, func(t *testing.T) {
+			_, err := NewProfile(c.Config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPushEventProfiles(t *testing.T) {
+	amounts, err := NewProfile(ProfileConfig{
+		Name:     "amounts",
+		Subject:  "monero.amounts",
+		Types:    []string{events.TxCreated},
+		Template: `{"txid": {{json .TXID}}, "amounts": [{{range $i, $d := .Destinations}}{{if $i}}, {{end}}{{xmr $d.Amount | json}}{{end}}]}`,
+	})
+	assert.Nil(t, err)
+	addresses, err := NewProfile(ProfileConfig{
+		Name:     "addresses",
+		Subject:  "monero.addresses",
+		Types:    []string{events.TxCreated},
+		Template: `{{.TXID}}{{with .Destinations}} {{(index . 0).Address}}{{end}}`,
+	})
+	assert.Nil(t, err)
+
+	rp := &RecordingPublisher{}
+	ep := EventPublishing{Publisher: rp, Profiles: []*Profile{amounts, addresses}}
+	assert.Nil(t, ep.PushTxEvent(events.Tx{TXID: "abc", Destinations: []events.Destination{
+		{Address: "addr1", Amount: 1500000000000},
+		{Address: "addr2", Amount: 1},
+	}}))
+	assert.Nil(t, ep.PushBlockEvent(events.Block{Hash: "def"}))
+
+	assert.Len(t, rp.Published["monero"], 2)
+	assert.Equal(t, []string{`{"txid": "abc", "amounts": ["1.500000000000", "0.000000000001"]}`}, rp.Published["monero.amounts"])
+	assert.Equal(t, []string{`abc addr1`}, rp.Published["monero.addresses"])
+
+	// A failing profile doesn't hold back the other ones, nor fail the
+	// event, which was published already
+	rp.Failing = map[string]bool{"monero.addresses": true}
+	assert.Nil(t, ep.PushTxEvent(events.Tx{TXID: "ghi"}))
+	assert.Len(t, rp.Published["monero"], 3)
+	assert.Len(t, rp.Published["monero.amounts"], 2)
+	assert.Len(t, rp.Published["monero.addresses"], 1)
+	assert.Equal(t, "1", profilesFailed.Get("addresses").String())
+}
@@ -0,0 +1,161 @@
+package publisher
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+const (
+	RuleDrop  = "drop"
+	RuleRoute = "route"
+	// RuleAllow publishes the Txs it matches as usual, without trying the
+	// next rules, e.g. to drop everything but an allowlist
+	RuleAllow = "allow"
+)
+
+var (
+	// rulesDropped counts the Txs dropped by each rule
+	rulesDropped = expvar.NewMap("rules_dropped")
+	// rulesRouted counts the Txs routed by each rule
+	rulesRouted = expvar.NewMap("rules_routed")
+	// rulesAllowed counts the Txs allowed by each rule
+	rulesAllowed = expvar.NewMap("rules_allowed")
+)
+
+// RuleMatch selects Txs. The destination criteria match when any of the
+// Tx's destinations meets all of them. Unset criteria match everything.
+type RuleMatch struct {
+	Addresses      []string `json:"addresses"`
+	AccountIndices []int    `json:"account_indices"`
+	SubaddrIndices []int    `json:"subaddr_indices"`
+	// MinAmount and MaxAmount bound the amount of the destination, in
+	// atomic units
+	MinAmount *uint64 `json:"min_amount"`
+	MaxAmount *uint64 `json:"max_amount"`
+
+	MinConfirmations *int `json:"min_confirmations"`
+	MaxConfirmations *int `json:"max_confirmations"`
+	MinUnlockTime    *int `json:"min_unlock_time"`
+	MaxUnlockTime    *int `json:"max_unlock_time"`
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func inRange(v int, min, max *int) bool {
+	return (min == nil || v >= *min) && (max == nil || v <= *max)
+}
+
+func (m *RuleMatch) matchesDestination(d events.Destination) bool {
+	if len(m.Addresses) > 0 && !containsString(m.Addresses, d.Address) {
+		return false
+	}
+	if len(m.AccountIndices) > 0 && !containsInt(m.AccountIndices, d.AccountIndex) {
+		return false
+	}
+	if len(m.SubaddrIndices) > 0 && !containsInt(m.SubaddrIndices, d.SubaddrIndex) {
+		return false
+	}
+	return (m.MinAmount == nil || d.Amount >= *m.MinAmount) && (m.MaxAmount == nil || d.Amount <= *m.MaxAmount)
+}
+
+func (m *RuleMatch) hasDestinationCriteria() bool {
+	return len(m.Addresses) > 0 || len(m.AccountIndices) > 0 || len(m.SubaddrIndices) > 0 || m.MinAmount != nil || m.MaxAmount != nil
+}
+
+func (m *RuleMatch) Matches(tx events.Tx) bool {
+	if !inRange(tx.Confirmations, m.MinConfirmations, m.MaxConfirmations) || !inRange(tx.UnlockTime, m.MinUnlockTime, m.MaxUnlockTime) {
+		return false
+	}
+	if !m.hasDestinationCriteria() {
+		return true
+	}
+
+	for _, d := range tx.Destinations {
+		if m.matchesDestination(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule drops the Txs it matches, routes them to another subject, or
+// allows them through
+type Rule struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	// Subject is where routed Txs are published to
+	Subject string    `json:"subject"`
+	Match   RuleMatch `json:"match"`
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rules need a name")
+	}
+
+	switch r.Action {
+	case RuleDrop, RuleAllow:
+	case RuleRoute:
+		if r.Subject == "" {
+			return fmt.Errorf("rule %s routes to no subject", r.Name)
+		}
+	default:
+		return fmt.Errorf("rule %s has unknown action %q", r.Name, r.Action)
+	}
+	return nil
+}
+
+// RulesPublisher applies the first of its Rules that matches each Tx,
+// before publishing it
+type RulesPublisher struct {
+	TxEventPublisher
+	Rules []Rule
+	// Routes are the publishers of the subjects routed to
+	Routes map[string]TxEventPublisher
+}
+
+func (p *RulesPublisher) PushTxEvent(tx events.Tx) error {
+	for _, r := range p.Rules {
+		if !r.Match.Matches(tx) {
+			continue
+		}
+
+		switch r.Action {
+		case RuleDrop:
+			log.Printf("Dropping tx %s, as rule %s says", tx.TXID, r.Name)
+			rulesDropped.Add(r.Name, 1)
+			return nil
+		case RuleAllow:
+			rulesAllowed.Add(r.Name, 1)
+			return p.TxEventPublisher.PushTxEvent(tx)
+		}
+
+		route, ok := p.Routes[r.Subject]
+		if !ok {
+			return fmt.Errorf("rule %s routes to %s, which has no publisher", r.Name, r.Subject)
+		}
+		rulesRouted.Add(r.Name, 1)
+		return route.PushTxEvent(tx)
+	}
+
+	return p.TxEventPublisher.PushTxEvent(tx)
+}
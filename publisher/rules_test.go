@@ -0,0 +1,97 @@
+package publisher
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+func TestRuleMatch(t *testing.T) {
+	tx := events.Tx{
+		Confirmations: 2,
+		UnlockTime:    0,
+		Destinations: []events.Destination{
+			{Address: "addr1", Amount: 100, AccountIndex: 0, SubaddrIndex: 1},
+			{Address: "addr2", Amount: 5000, AccountIndex: 1, SubaddrIndex: 3},
+		},
+	}
+
+	cases := []struct {
+		Match    string
+		Expected bool
+	}{
+		{`{}`, true},
+		{`{"addresses": ["addr2"]}`, true},
+		{`{"addresses": ["addr3"]}`, false},
+		{`{"account_indices": [1], "subaddr_indices": [3]}`, true},
+		// Both criteria have to match the same destination
+		{`{"account_indices": [1], "subaddr_indices": [1]}`, false},
+		{`{"min_amount": 1000}`, true},
+		{`{"max_amount": 99}`, false},
+		{`{"addresses": ["addr1"], "min_amount": 1000}`, false},
+		{`{"min_confirmations": 10}`, false},
+		{`{"max_confirmations": 2}`, true},
+		{`{"min_unlock_time": 1}`, false},
+		{`{"max_unlock_time": 0, "addresses": ["addr1"]}`, true},
+	}
+	for _, c := range cases {
+		t.Run(c.Match, func(t *testing.T) {
+			m := RuleMatch{}
+			assert.Nil(t, json.Unmarshal([]byte(c.Match), &m))
+			assert.Equal(t, c.Expected, m.Matches(tx))
+		})
+	}
+}
+
+func TestRulesPublisher(t *testing.T) {
+	rules := []Rule{}
+	assert.Nil(t, json.Unmarshal([]byte(`[
+		{"name": "dust", "action": "drop", "match": {"max_amount": 999}},
+		{"name": "treasury", "action": "route", "subject": "treasury.monero", "match": {"account_indices": [1]}}
+	]`), &rules))
+
+	published := &MockedTxPublisher{Returns: []error{nil, nil, nil}}
+	treasury := &MockedTxPublisher{Returns: []error{nil, nil, nil}}
+	p := &RulesPublisher{
+		TxEventPublisher: published,
+		Rules:            rules,
+		Routes:           map[string]TxEventPublisher{"treasury.monero": treasury},
+	}
+
+	assert.Nil(t, p.PushTxEvent(events.Tx{TXID: "dust", Destinations: []events.Destination{{Amount: 10}}}))
+	assert.Nil(t, p.PushTxEvent(events.Tx{TXID: "treasury", Destinations: []events.Destination{{Amount: 1000, AccountIndex: 1}}}))
+	assert.Nil(t, p.PushTxEvent(events.Tx{TXID: "other", Destinations: []events.Destination{{Amount: 1000}}}))
+
+	assert.Equal(t, 1, published.CallsCount)
+	assert.Equal(t, "other", published.TxArgs[0].TXID)
+	assert.Equal(t, 1, treasury.CallsCount)
+	assert.Equal(t, "treasury", treasury.TxArgs[0].TXID)
+	assert.Equal(t, "1", rulesDropped.Get("dust").String())
+	assert.Equal(t, "1", rulesRouted.Get("treasury").String())
+
+	// Routes without publisher fail
+	p.Routes = nil
+	assert.Error(t, p.PushTxEvent(events.Tx{TXID: "treasury", Destinations: []events.Destination{{Amount: 1000, AccountIndex: 1}}}))
+}
+
+func TestRulesPublisherAllowlist(t *testing.T) {
+	config := Config{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"rules": [
+		{"name": "merchant", "action": "allow", "match": {"addresses": ["addr1", "addr2"]}},
+		{"name": "others", "action": "drop", "match": {}}
+	]}`), &config))
+	assert.Nil(t, config.validate())
+
+	published := &MockedTxPublisher{Returns: []error{nil, nil}}
+	p := &RulesPublisher{TxEventPublisher: published, Rules: config.Rules}
+
+	assert.Nil(t, p.PushTxEvent(events.Tx{TXID: "allowed", Destinations: []events.Destination{{Address: "addr2"}}}))
+	assert.Nil(t, p.PushTxEvent(events.Tx{TXID: "dropped", Destinations: []events.Destination{{Address: "addr3"}}}))
+
+	assert.Equal(t, 1, published.CallsCount)
+	assert.Equal(t, "allowed", published.TxArgs[0].TXID)
+	assert.Equal(t, "1", rulesAllowed.Get("merchant").String())
+	assert.Equal(t, "1", rulesDropped.Get("others").String())
+}
@@ -0,0 +1,365 @@
+package publisher
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sink is a Publisher that may keep connections or files open between
+// Publish calls, until it's closed. NATSClient is one too.
+type Sink interface {
+	Publisher
+	Close()
+}
+
+const (
+	SinkNATS     = "nats"
+	SinkWebhook  = "webhook"
+	SinkFile     = "file"
+	SinkStdout   = "stdout"
+	SinkUnixgram = "unixgram"
+
+	// SignatureHeader holds the hex HMAC-SHA256 of the webhook body, as
+	// sha256=<hex>
+	SignatureHeader = "X-Signature-256"
+	// ChannelHeader holds the channel the event would be published to
+	ChannelHeader = "X-Channel"
+
+	DefaultWebhookTimeout = 10 * time.Second
+	DefaultWebhookRetries = 3
+	DefaultFileMaxBackups = 5
+)
+
+// SinkConfig selects and configures the sink the events are published
+// to, instead of NATS
+type SinkConfig struct {
+	Type string `json:"type"`
+	// Name, BestEffort, RetryBudget and EventTypes are the delivery
+	// policy of the sink, when there are several. See Target.
+	Name        string   `json:"name"`
+	BestEffort  bool     `json:"best_effort"`
+	RetryBudget int      `json:"retry_budget"`
+	EventTypes  []string `json:"event_types"`
+	// URL, Secret, Timeout and Retries configure webhooks
+	URL     string   `json:"url"`
+	Secret  string   `json:"secret"`
+	Timeout Duration `json:"timeout"`
+	Retries int      `json:"retries"`
+	// Path is the NDJSON file, or the Unix datagram socket
+	Path string `json:"path"`
+	// MaxBytes is the size the file is rotated at. No rotation when 0
+	MaxBytes   int64 `json:"max_bytes"`
+	MaxBackups int   `json:"max_backups"`
+}
+
+func (c *SinkConfig) validate() error {
+	switch c.Type {
+	case SinkNATS, SinkStdout:
+	case SinkWebhook:
+		if c.URL == "" {
+			return fmt.Errorf("webhook sink has no url")
+		}
+	case SinkFile, SinkUnixgram:
+		if c.Path == "" {
+			return fmt.Errorf("%s sink has no path", c.Type)
+		}
+	default:
+		return fmt.Errorf("unknown sink type %q", c.Type)
+	}
+
+	if c.Retries < 0 || c.MaxBytes < 0 || c.MaxBackups < 0 || c.RetryBudget < 0 {
+		return fmt.Errorf("%s sink: retries, max_bytes, max_backups and retry_budget can't be negative", c.Type)
+	}
+	return nil
+}
+
+// TargetName is the sink's name, or its type when it has none
+func (c *SinkConfig) TargetName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Type
+}
+
+// Target wraps the sink built from the config with its delivery policy
+func (c *SinkConfig) Target(p Publisher) Target {
+	return Target{
+		Name:        c.TargetName(),
+		Publisher:   p,
+		BestEffort:  c.BestEffort,
+		RetryBudget: c.RetryBudget,
+		Types:       c.EventTypes,
+	}
+}
+
+// NewSink builds the sink of the config. NATS sinks are built with
+// NewNATSClient, since they need the NATS URL.
+func NewSink(c SinkConfig) (Sink, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	switch c.Type {
+	case SinkWebhook:
+		s := NewWebhookSink(c.URL, c.Secret)
+		if c.Timeout.Duration > 0 {
+			s.Client.Timeout = c.Timeout.Duration
+		}
+		if c.Retries > 0 {
+			s.Retries = c.Retries
+		}
+		return s, nil
+	case SinkFile:
+		s := &FileSink{Path: c.Path, MaxBytes: c.MaxBytes, MaxBackups: c.MaxBackups}
+		if s.MaxBackups == 0 {
+			s.MaxBackups = DefaultFileMaxBackups
+		}
+		return s, nil
+	case SinkStdout:
+		return &WriterPublisher{W: os.Stdout}, nil
+	case SinkUnixgram:
+		return &UnixgramSink{Path: c.Path}, nil
+	}
+	return nil, fmt.Errorf("%s sinks are built with NewNATSClient", c.Type)
+}
+
+// WebhookSink POSTs the events to a URL. Network errors and 5xx (or 429)
+// responses are retried, with a doubling delay.
+type WebhookSink struct {
+	URL string
+	// Secret signs the body in the SignatureHeader, when set
+	Secret  string
+	Retries int
+	Backoff time.Duration
+	Client  *http.Client
+}
+
+func NewWebhookSink(url, secret string) *WebhookSink {
+	return &WebhookSink{
+		URL:     url,
+		Secret:  secret,
+		Retries: DefaultWebhookRetries,
+		Backoff: time.Second,
+		Client:  &http.Client{Timeout: DefaultWebhookTimeout},
+	}
+}
+
+// WebhookSignature is the SignatureHeader value of the body
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *WebhookSink) Publish(payload []byte, channel string) error {
+	delay := s.Backoff
+	var err error
+	for attempt := 0; attempt <= s.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		var retriable bool
+		retriable, err = s.post(payload, channel)
+		if err == nil || !retriable {
+			return err
+		}
+	}
+	return fmt.Errorf("webhook %s failed after %d attempts: %w", s.URL, s.Retries+1, err)
+}
+
+// post sends the payload once. It tells whether a failure is worth
+// retrying.
+func (s *WebhookSink) post(payload []byte, channel string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ChannelHeader, channel)
+	if s.Secret != "" {
+		req.Header.Set(SignatureHeader, WebhookSignature(s.Secret, payload))
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retriable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retriable, fmt.Errorf("webhook %s responded %s", s.URL, resp.Status)
+}
+
+func (s *WebhookSink) IsConnected() bool {
+	return true
+}
+
+func (s *WebhookSink) Close() {}
+
+// FileSink appends the events to a NDJSON file. Once it reaches MaxBytes,
+// it's renamed to <Path>.1, the previous <Path>.1 to <Path>.2, and so on
+// up to MaxBackups.
+type FileSink struct {
+	Path       string
+	MaxBytes   int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, info.Size()
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	s.close()
+	for i := s.MaxBackups; i > 1; i-- {
+		from := fmt.Sprintf("%s.%d", s.Path, i-1)
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", s.Path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if s.MaxBackups > 0 {
+		if err := os.Rename(s.Path, s.Path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(s.Path); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *FileSink) Publish(payload []byte, channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	line := append(append([]byte{}, payload...), '\n')
+	if s.MaxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.MaxBytes {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("Unable to rotate %s: %s", s.Path, err)
+		}
+	}
+
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) IsConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return s.open() == nil
+	}
+	return true
+}
+
+func (s *FileSink) close() {
+	if s.f != nil {
+		s.f.Close()
+		s.f = nil
+	}
+}
+
+func (s *FileSink) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.close()
+}
+
+// UnixgramSink sends every event as a datagram to a Unix socket. Events
+// larger than the socket's max datagram size fail to publish.
+type UnixgramSink struct {
+	Path string
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+func (s *UnixgramSink) dial() error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: s.Path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+// Publish reuses the connection. If sending through it fails, e.g. because
+// the receiver restarted, it's replaced once with a fresh one.
+func (s *UnixgramSink) Publish(payload []byte, channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		if _, err := s.conn.Write(payload); err == nil {
+			return nil
+		}
+		s.close()
+	}
+
+	if err := s.dial(); err != nil {
+		return err
+	}
+	_, err := s.conn.Write(payload)
+	return err
+}
+
+func (s *UnixgramSink) IsConnected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return s.dial() == nil
+	}
+	return true
+}
+
+func (s *UnixgramSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *UnixgramSink) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.close()
+}
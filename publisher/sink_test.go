@@ -0,0 +1,117 @@
+package publisher
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, `{"a":1}`, string(body))
+		assert.Equal(t, "monero", r.Header.Get(ChannelHeader))
+		assert.Equal(t, WebhookSignature("s3cret", body), r.Header.Get(SignatureHeader))
+
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, "s3cret")
+	sink.Backoff = time.Millisecond
+	assert.Nil(t, sink.Publish([]byte(`{"a":1}`), "monero"))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestWebhookSinkFailure(t *testing.T) {
+	var calls int32
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, "")
+	sink.Backoff = time.Millisecond
+
+	// Client errors aren't retried
+	assert.Error(t, sink.Publish([]byte(`{}`), "monero"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	status = http.StatusInternalServerError
+	assert.Error(t, sink.Publish([]byte(`{}`), "monero"))
+	assert.Equal(t, int32(1+DefaultWebhookRetries+1), atomic.LoadInt32(&calls))
+}
+
+func TestWebhookSinkTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, "")
+	sink.Retries = 0
+	sink.Client.Timeout = 10 * time.Millisecond
+	assert.Error(t, sink.Publish([]byte(`{}`), "monero"))
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-sink")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.ndjson")
+	sink := &FileSink{Path: path, MaxBytes: 10, MaxBackups: 2}
+	defer sink.Close()
+
+	for _, payload := range []string{`"aaaa"`, `"bbbb"`, `"cccc"`, `"dddd"`} {
+		assert.Nil(t, sink.Publish([]byte(payload), "monero"))
+	}
+
+	read := func(path string) string {
+		content, err := ioutil.ReadFile(path)
+		assert.Nil(t, err)
+		return string(content)
+	}
+	assert.Equal(t, "\"dddd\"\n", read(path))
+	assert.Equal(t, "\"cccc\"\n", read(path+".1"))
+	assert.Equal(t, "\"bbbb\"\n", read(path+".2"))
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUnixgramSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-sink")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	sink := &UnixgramSink{Path: path}
+	defer sink.Close()
+	ep := EventPublishing{Publisher: sink}
+	assert.Nil(t, ep.PushBlockEvent(events.Block{Hash: "abc", Height: 1}))
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(buf[:n]), `"hash":"abc"`))
+}
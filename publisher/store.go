@@ -0,0 +1,68 @@
+package publisher
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrLockUnsupported is returned by FileLock.Lock on the platforms without
+// advisory file locks
+var ErrLockUnsupported = errors.New("file locks are not supported on this platform")
+
+// JSONFileStore persists a single JSON document on the local filesystem.
+// Writes go to a temporary file that is renamed over the previous version,
+// so readers never see a partially written document.
+type JSONFileStore struct {
+	Path string
+}
+
+// Load decodes the stored document into v. A missing file is not an error,
+// and leaves v untouched.
+func (s *JSONFileStore) Load(v interface{}) error {
+	raw, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, v)
+}
+
+func (s *JSONFileStore) Save(v interface{}) error {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.Path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+func NewJSONFileStore(stateDir, name string) *JSONFileStore {
+	return &JSONFileStore{
+		Path: filepath.Join(stateDir, name),
+	}
+}
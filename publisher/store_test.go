@@ -0,0 +1,37 @@
+package publisher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-state")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewJSONFileStore(filepath.Join(dir, "nested"), "doc.json")
+
+	t.Run("Missing file leaves the value untouched", func(t *testing.T) {
+		v := []string{"untouched"}
+		assert.Nil(t, store.Load(&v))
+		assert.Equal(t, []string{"untouched"}, v)
+	})
+
+	t.Run("Save and load", func(t *testing.T) {
+		assert.Nil(t, store.Save([]string{"a", "b"}))
+
+		v := []string{}
+		assert.Nil(t, store.Load(&v))
+		assert.Equal(t, []string{"a", "b"}, v)
+
+		// No temporary files are left behind
+		entries, err := ioutil.ReadDir(filepath.Dir(store.Path))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(entries))
+	})
+}
@@ -0,0 +1,101 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
+)
+
+// errTxNotVisible is returned while the wallet doesn't report any transfer
+// for the Tx it notified about
+var errTxNotVisible = errors.New("the wallet returned no transfers")
+
+// VisibilityWait configures how long to wait for the wallet to report the
+// Tx it just notified about. tx-notify can fire before the wallet is able
+// to answer about the Tx.
+type VisibilityWait struct {
+	// Window is the total time to keep re-querying the wallet. The wallet
+	// is queried only once when 0.
+	Window         time.Duration
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// now and after replace time.Now and time.After in tests
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+func NewVisibilityWait(window time.Duration) VisibilityWait {
+	return VisibilityWait{
+		Window:         window,
+		InitialBackoff: 250 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	}
+}
+
+// UnresolvedTxError is returned when the wait window expires
+type UnresolvedTxError struct {
+	events.UnresolvedTx
+	Err error
+}
+
+func (e *UnresolvedTxError) Error() string {
+	return fmt.Sprintf("tx %s not visible after %d attempts in %dms: %s", e.TXID, e.Attempts, e.WaitedMs, e.Err)
+}
+
+func (e *UnresolvedTxError) Unwrap() error {
+	return e.Err
+}
+
+// WaitForTx queries the wallet until it reports the Tx, backing off
+// exponentially between attempts. Txs the wallet reports without incoming
+// transfers (e.g. spends) are not ours to publish, and are returned right
+// away as ErrNoIncomingTransfers, without waiting for the window.
+func WaitForTx(ctx context.Context, txid string, wait VisibilityWait, rc monerorpc.TxGetter) (*events.Tx, error) {
+	now, after := wait.now, wait.after
+	if now == nil {
+		now, after = time.Now, time.After
+	}
+
+	start := now()
+	backoff := wait.InitialBackoff
+	attempts := 0
+	for {
+		attempts++
+		transfers, err := rc.GetTransferByTxid(ctx, txid)
+		if err == nil && len(transfers) > 0 {
+			return monerorpc.RpcTxToTx(transfers)
+		}
+		if err == nil {
+			err = errTxNotVisible
+		}
+
+		waited := now().Sub(start)
+		if waited+backoff >= wait.Window {
+			return nil, &UnresolvedTxError{
+				UnresolvedTx: events.UnresolvedTx{
+					TXID:     txid,
+					Reason:   err.Error(),
+					Attempts: attempts,
+					WaitedMs: waited.Milliseconds(),
+				},
+				Err: err,
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-after(backoff):
+		}
+
+		backoff *= 2
+		if backoff > wait.MaxBackoff {
+			backoff = wait.MaxBackoff
+		}
+	}
+}
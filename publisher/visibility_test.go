@@ -0,0 +1,98 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
+)
+
+func fastVisibilityWait(window time.Duration) VisibilityWait {
+	return VisibilityWait{
+		Window:         window,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+	}
+}
+
+func TestWaitForTx(t *testing.T) {
+	incoming := []monerorpc.RpcTx{{TXID: "tx", Type: "in", Address: "addr1", Amount: 1}}
+
+	t.Run("Visible right away", func(t *testing.T) {
+		txGetter := MockedTxGetter{Returns: []MockedGetTxByTxidReturn{{Txs: incoming}}}
+
+		tx, err := WaitForTx(context.Background(), "tx", fastVisibilityWait(time.Second), &txGetter)
+		assert.Nil(t, err)
+		assert.Equal(t, "tx", tx.TXID)
+		assert.Equal(t, 1, txGetter.CallsCount)
+	})
+
+	t.Run("Visible after a few attempts", func(t *testing.T) {
+		txGetter := MockedTxGetter{
+			Returns: []MockedGetTxByTxidReturn{
+				{E: fmt.Errorf("RPC Error. &{Code:-8 Message:Transaction not found.}")},
+				{Txs: []monerorpc.RpcTx{}},
+				{Txs: incoming},
+			},
+		}
+
+		tx, err := WaitForTx(context.Background(), "tx", fastVisibilityWait(time.Second), &txGetter)
+		assert.Nil(t, err)
+		assert.Equal(t, "tx", tx.TXID)
+		assert.Equal(t, 3, txGetter.CallsCount)
+	})
+
+	t.Run("Not ours", func(t *testing.T) {
+		txGetter := MockedTxGetter{
+			Returns: []MockedGetTxByTxidReturn{
+				{Txs: []monerorpc.RpcTx{{TXID: "tx", Type: "out", Address: "addr1", Amount: 1}}},
+			},
+		}
+
+		// Outgoing Txs are not waited for
+		tx, err := WaitForTx(context.Background(), "tx", fastVisibilityWait(time.Minute), &txGetter)
+		assert.Nil(t, tx)
+		assert.True(t, errors.Is(err, monerorpc.ErrNoIncomingTransfers))
+		assert.Equal(t, 1, txGetter.CallsCount)
+	})
+
+	t.Run("Window expires", func(t *testing.T) {
+		txGetter := MockedTxGetter{Returns: []MockedGetTxByTxidReturn{{E: fmt.Errorf("Dummy error")}}}
+
+		// A fake clock, since a loaded machine may oversleep the last
+		// backoff past the window
+		wait := fastVisibilityWait(20 * time.Millisecond)
+		clock := time.Unix(1000, 0)
+		wait.now = func() time.Time { return clock }
+		wait.after = func(d time.Duration) <-chan time.Time {
+			clock = clock.Add(d)
+			ch := make(chan time.Time, 1)
+			ch <- clock
+			return ch
+		}
+
+		tx, err := WaitForTx(context.Background(), "tx", wait, &txGetter)
+		assert.Nil(t, tx)
+
+		var unresolved *UnresolvedTxError
+		assert.True(t, errors.As(err, &unresolved))
+		assert.Equal(t, "tx", unresolved.TXID)
+		assert.Equal(t, "Dummy error", unresolved.Reason)
+		assert.Equal(t, txGetter.CallsCount, unresolved.Attempts)
+		assert.True(t, unresolved.Attempts > 1)
+		// Attempts stop before the window would be exceeded by the next backoff
+		assert.True(t, unresolved.WaitedMs < 20)
+	})
+
+	t.Run("No window", func(t *testing.T) {
+		txGetter := MockedTxGetter{Returns: []MockedGetTxByTxidReturn{{E: fmt.Errorf("Dummy error")}}}
+
+		_, err := WaitForTx(context.Background(), "tx", VisibilityWait{}, &txGetter)
+		assert.Error(t, err)
+		assert.Equal(t, 1, txGetter.CallsCount)
+	})
+}
@@ -0,0 +1,262 @@
+package publisher
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
+)
+
+const (
+	// reorgDepth is how many blocks below the highest Tx seen are queried
+	// again, to notice the Txs that moved because of a reorg
+	reorgDepth = 10
+
+	maxWatcherBackoff = 5 * time.Minute
+
+	walletsFileName = "wallets.json"
+)
+
+// WalletState is where a WalletWatcher stands: the height it queries the
+// wallet from, and the height each Tx was last published at
+type WalletState struct {
+	MinHeight int            `json:"min_height"`
+	Published map[string]int `json:"published"`
+}
+
+// WalletStateStore keeps the WalletState of every watched wallet in the
+// local state directory, so that a restarted watcher resumes where it
+// stopped, without publishing the same Txs again
+type WalletStateStore struct {
+	Store *JSONFileStore
+	mu    sync.Mutex
+}
+
+// Load returns false when nothing was recorded for the wallet yet
+func (s *WalletStateStore) Load(name string) (WalletState, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := map[string]WalletState{}
+	if err := s.Store.Load(&states); err != nil {
+		return WalletState{}, false, err
+	}
+	state, ok := states[name]
+	return state, ok, nil
+}
+
+func (s *WalletStateStore) Record(name string, state WalletState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := map[string]WalletState{}
+	if err := s.Store.Load(&states); err != nil {
+		return err
+	}
+	states[name] = state
+	return s.Store.Save(states)
+}
+
+func NewWalletStateStore(stateDir string) *WalletStateStore {
+	return &WalletStateStore{
+		Store: NewJSONFileStore(stateDir, walletsFileName),
+	}
+}
+
+type WalletTransfersGetter interface {
+	monerorpc.TxGetter
+	GetIncomingTransfers(context.Context, int) ([]monerorpc.RpcTx, error)
+	GetHeight(context.Context) (int, error)
+}
+
+// WalletWatcher polls a wallet for incoming Txs, and publishes them the same
+// way tx-notify would: once when they show up in the pool, and once again
+// when they get confirmed. Txs below IgnoreBelowHeight are not published.
+// With a State store, the watcher resumes from the recorded WalletState
+// rather than the start height.
+type WalletWatcher struct {
+	Name              string
+	RPC               WalletTransfersGetter
+	Publisher         TxEventPublisher
+	Interval          time.Duration
+	IgnoreBelowHeight int
+	State             *WalletStateStore
+
+	loaded    bool
+	minHeight int
+	// published holds the height each Tx was last published at, for the
+	// Txs the wallet still reports
+	published map[string]int
+}
+
+func NewWalletWatcher(name string, startHeight int, rpc WalletTransfersGetter, p TxEventPublisher, interval time.Duration) *WalletWatcher {
+	return &WalletWatcher{
+		Name:      name,
+		RPC:       rpc,
+		Publisher: p,
+		Interval:  interval,
+		minHeight: startHeight - 1,
+		published: map[string]int{},
+	}
+}
+
+// Poll publishes the incoming Txs that are new, or that got confirmed,
+// since the previous call
+func (w *WalletWatcher) Poll(ctx context.Context) error {
+	if !w.loaded && w.State != nil {
+		state, ok, err := w.State.Load(w.Name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			w.minHeight = state.MinHeight
+			if state.Published != nil {
+				w.published = state.Published
+			}
+		}
+	}
+	w.loaded = true
+
+	before := WalletState{MinHeight: w.minHeight, Published: copyHeights(w.published)}
+	err := w.poll(ctx)
+	if w.State != nil && !w.stateEquals(before) {
+		// Recorded even when polling failed, for the Txs published
+		// before the failure
+		if recordErr := w.State.Record(w.Name, WalletState{MinHeight: w.minHeight, Published: w.published}); recordErr != nil && err == nil {
+			err = recordErr
+		}
+	}
+	return err
+}
+
+func (w *WalletWatcher) stateEquals(state WalletState) bool {
+	if state.MinHeight != w.minHeight || len(state.Published) != len(w.published) {
+		return false
+	}
+	for txid, height := range w.published {
+		if h, ok := state.Published[txid]; !ok || h != height {
+			return false
+		}
+	}
+	return true
+}
+
+func copyHeights(heights map[string]int) map[string]int {
+	copied := map[string]int{}
+	for k, v := range heights {
+		copied[k] = v
+	}
+	return copied
+}
+
+func (w *WalletWatcher) poll(ctx context.Context) error {
+	if w.minHeight < 0 {
+		height, err := w.RPC.GetHeight(ctx)
+		if err != nil {
+			return err
+		}
+		w.minHeight = height - 1
+	}
+
+	transfers, err := w.RPC.GetIncomingTransfers(ctx, w.minHeight)
+	if err != nil {
+		return err
+	}
+
+	byTxid := map[string][]monerorpc.RpcTx{}
+	txids := []string{}
+	for _, t := range transfers {
+		if _, ok := byTxid[t.TXID]; !ok {
+			txids = append(txids, t.TXID)
+		}
+		byTxid[t.TXID] = append(byTxid[t.TXID], t)
+	}
+
+	maxHeight := 0
+	for _, txid := range txids {
+		tx, err := monerorpc.RpcTxToTx(byTxid[txid])
+		if err != nil {
+			// Not retried, so it doesn't hold back the other Txs
+			log.Printf("Skipping tx %s of wallet %s: %s", txid, w.Name, err)
+			continue
+		}
+
+		if tx.Height > maxHeight {
+			maxHeight = tx.Height
+		}
+
+		if height, ok := w.published[txid]; ok && height == tx.Height {
+			continue
+		}
+		if tx.Height < w.IgnoreBelowHeight {
+			continue
+		}
+
+		setLabels(ctx, tx, w.RPC)
+		tx.Wallet = w.Name
+
+		if err := w.Publisher.PushTxEvent(*tx); err != nil {
+			return err
+		}
+		w.published[txid] = tx.Height
+	}
+
+	// The Txs the wallet no longer reports (e.g. below the new min
+	// height, or dropped from the pool) won't be published again anyway
+	for txid := range w.published {
+		if _, ok := byTxid[txid]; !ok {
+			delete(w.published, txid)
+		}
+	}
+	if maxHeight-reorgDepth > w.minHeight {
+		w.minHeight = maxHeight - reorgDepth
+		for txid, height := range w.published {
+			// Pool Txs (height 0) are kept until they get confirmed
+			if height != 0 && height <= w.minHeight {
+				delete(w.published, txid)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Watch polls the wallet until the context is done. Failures are logged,
+// and the wallet is polled again after backing off.
+func (w *WalletWatcher) Watch(ctx context.Context) {
+	backoff := w.Interval
+	for {
+		wait := w.Interval
+		if err := w.Poll(ctx); err != nil {
+			log.Printf("Failed to poll wallet %s: %s", w.Name, err)
+			wait = backoff
+			backoff *= 2
+			if backoff > maxWatcherBackoff {
+				backoff = maxWatcherBackoff
+			}
+		} else {
+			backoff = w.Interval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// WatchWallets watches every wallet concurrently, until the context is done
+func WatchWallets(ctx context.Context, watchers []*WalletWatcher) {
+	wg := sync.WaitGroup{}
+	for _, w := range watchers {
+		wg.Add(1)
+		go func(w *WalletWatcher) {
+			defer wg.Done()
+			w.Watch(ctx)
+		}(w)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,225 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
+)
+
+type MockedWalletTransfersGetter struct {
+	MockedTxGetter
+	Height          int
+	MinHeightArgs   []int
+	TransfersReturn []MockedGetTxByTxidReturn
+}
+
+func (g *MockedWalletTransfersGetter) GetIncomingTransfers(ctx context.Context, minHeight int) ([]monerorpc.RpcTx, error) {
+	g.MinHeightArgs = append(g.MinHeightArgs, minHeight)
+
+	result := g.TransfersReturn[0]
+	if len(g.TransfersReturn) > 1 {
+		g.TransfersReturn = g.TransfersReturn[1:]
+	}
+	return result.Txs, result.E
+}
+
+func (g *MockedWalletTransfersGetter) GetHeight(ctx context.Context) (int, error) {
+	return g.Height, nil
+}
+
+func TestWalletWatcherPoll(t *testing.T) {
+	inPool := []monerorpc.RpcTx{
+		{TXID: "tx1", Type: "pool", Address: "addr1", Amount: 1},
+		{TXID: "tx1", Type: "pool", Address: "addr2", Amount: 2},
+	}
+	confirmed := []monerorpc.RpcTx{
+		{TXID: "tx1", Type: "in", Height: 120, Address: "addr1", Amount: 1},
+		{TXID: "tx1", Type: "in", Height: 120, Address: "addr2", Amount: 2},
+		{TXID: "tx2", Type: "in", Height: 121, Address: "addr1", Amount: 3},
+	}
+	rpc := MockedWalletTransfersGetter{
+		Height: 100,
+		TransfersReturn: []MockedGetTxByTxidReturn{
+			{Txs: inPool},
+			{Txs: inPool},
+			{Txs: confirmed},
+			{Txs: confirmed},
+		},
+	}
+	publisher := MockedTxPublisher{Returns: []error{nil, nil, nil}}
+	watcher := NewWalletWatcher("merchant1", 0, &rpc, &publisher, time.Second)
+
+	ctx := context.Background()
+
+	// The Tx is published once while it's in the pool
+	assert.Nil(t, watcher.Poll(ctx))
+	assert.Nil(t, watcher.Poll(ctx))
+	assert.Equal(t, 1, publisher.CallsCount)
+	assert.Equal(t, "tx1", publisher.TxArgs[0].TXID)
+	assert.Equal(t, "merchant1", publisher.TxArgs[0].Wallet)
+	assert.Equal(t, 2, len(publisher.TxArgs[0].Destinations))
+
+	// And once again when it's confirmed
+	assert.Nil(t, watcher.Poll(ctx))
+	assert.Nil(t, watcher.Poll(ctx))
+	assert.Equal(t, 3, publisher.CallsCount)
+	assert.Equal(t, "tx1", publisher.TxArgs[1].TXID)
+	assert.Equal(t, 120, publisher.TxArgs[1].Height)
+	assert.Equal(t, "tx2", publisher.TxArgs[2].TXID)
+
+	// Starts at the wallet's height, and then follows the Txs found
+	assert.Equal(t, []int{99, 99, 99, 111}, rpc.MinHeightArgs)
+}
+
+func TestWalletWatcherState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-wallets")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	store := NewWalletStateStore(dir)
+
+	confirmed := []monerorpc.RpcTx{{TXID: "tx1", Type: "in", Height: 120, Address: "addr1", Amount: 1}}
+	rpc := MockedWalletTransfersGetter{TransfersReturn: []MockedGetTxByTxidReturn{{Txs: confirmed}}}
+	publisher := MockedTxPublisher{Returns: []error{nil}}
+	watcher := NewWalletWatcher("merchant1", 100, &rpc, &publisher, time.Second)
+	watcher.State = store
+	assert.Nil(t, watcher.Poll(context.Background()))
+	assert.Equal(t, 1, publisher.CallsCount)
+
+	// A restarted watcher resumes from the recorded state
+	restarted := NewWalletWatcher("merchant1", 100, &rpc, &publisher, time.Second)
+	restarted.State = store
+	assert.Nil(t, restarted.Poll(context.Background()))
+	assert.Equal(t, 1, publisher.CallsCount)
+	assert.Equal(t, []int{99, 110}, rpc.MinHeightArgs)
+
+	// Other wallets start from their start height
+	_, ok, err := store.Load("merchant2")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestWalletWatcherPrunesPublished(t *testing.T) {
+	rpc := MockedWalletTransfersGetter{
+		TransfersReturn: []MockedGetTxByTxidReturn{
+			{Txs: []monerorpc.RpcTx{{TXID: "tx1", Type: "pool", Address: "addr1", Amount: 1}}},
+			// The Tx was dropped from the pool
+			{Txs: []monerorpc.RpcTx{}},
+		},
+	}
+	publisher := MockedTxPublisher{Returns: []error{nil}}
+	watcher := NewWalletWatcher("merchant1", 100, &rpc, &publisher, time.Second)
+
+	assert.Nil(t, watcher.Poll(context.Background()))
+	assert.Equal(t, 1, len(watcher.published))
+	assert.Nil(t, watcher.Poll(context.Background()))
+	assert.Empty(t, watcher.published)
+}
+
+func TestWalletWatcherIgnoresLowTxs(t *testing.T) {
+	rpc := MockedWalletTransfersGetter{
+		TransfersReturn: []MockedGetTxByTxidReturn{
+			{Txs: []monerorpc.RpcTx{
+				{TXID: "tx1", Type: "in", Height: 110, Address: "addr1", Amount: 1},
+				{TXID: "tx2", Type: "in", Height: 130, Address: "addr1", Amount: 1},
+			}},
+		},
+	}
+	publisher := MockedTxPublisher{Returns: []error{nil}}
+	watcher := NewWalletWatcher("merchant1", 100, &rpc, &publisher, time.Second)
+	watcher.IgnoreBelowHeight = 120
+
+	assert.Nil(t, watcher.Poll(context.Background()))
+	assert.Equal(t, 1, publisher.CallsCount)
+	assert.Equal(t, "tx2", publisher.TxArgs[0].TXID)
+}
+
+func TestWalletWatcherPollErrors(t *testing.T) {
+	t.Run("RPC call fails", func(t *testing.T) {
+		rpc := MockedWalletTransfersGetter{
+			TransfersReturn: []MockedGetTxByTxidReturn{{E: fmt.Errorf("Dummy error")}},
+		}
+		publisher := MockedTxPublisher{Returns: []error{nil}}
+		watcher := NewWalletWatcher("merchant1", 10, &rpc, &publisher, time.Second)
+
+		assert.Error(t, watcher.Poll(context.Background()))
+		assert.Equal(t, 0, publisher.CallsCount)
+	})
+
+	t.Run("Publishing fails, and is retried", func(t *testing.T) {
+		rpc := MockedWalletTransfersGetter{
+			TransfersReturn: []MockedGetTxByTxidReturn{
+				{Txs: []monerorpc.RpcTx{{TXID: "tx1", Type: "pool", Address: "addr1", Amount: 1}}},
+			},
+		}
+		publisher := MockedTxPublisher{Returns: []error{fmt.Errorf("Dummy error"), nil}}
+		watcher := NewWalletWatcher("merchant1", 10, &rpc, &publisher, time.Second)
+
+		assert.Error(t, watcher.Poll(context.Background()))
+		assert.Nil(t, watcher.Poll(context.Background()))
+		assert.Equal(t, 2, publisher.CallsCount)
+	})
+
+	t.Run("Inconsistent Tx is skipped", func(t *testing.T) {
+		rpc := MockedWalletTransfersGetter{
+			TransfersReturn: []MockedGetTxByTxidReturn{
+				{Txs: []monerorpc.RpcTx{
+					{TXID: "tx1", Type: "in", Height: 11, Address: "addr1", Amount: 1},
+					{TXID: "tx1", Type: "in", Height: 12, Address: "addr2", Amount: 1},
+					{TXID: "tx2", Type: "in", Height: 12, Address: "addr2", Amount: 1},
+				}},
+			},
+		}
+		publisher := MockedTxPublisher{Returns: []error{nil}}
+		watcher := NewWalletWatcher("merchant1", 10, &rpc, &publisher, time.Second)
+
+		assert.Nil(t, watcher.Poll(context.Background()))
+		assert.Equal(t, 1, publisher.CallsCount)
+		assert.Equal(t, "tx2", publisher.TxArgs[0].TXID)
+	})
+	t.Run("Label lookup fails", func(t *testing.T) {
+		rpc := MockedWalletTransfersGetter{
+			MockedTxGetter: MockedTxGetter{LabelErr: fmt.Errorf("Dummy error")},
+			TransfersReturn: []MockedGetTxByTxidReturn{
+				{Txs: []monerorpc.RpcTx{{TXID: "tx1", Type: "in", Height: 11, Address: "addr1", Amount: 1}}},
+			},
+		}
+		publisher := MockedTxPublisher{Returns: []error{nil}}
+		watcher := NewWalletWatcher("merchant1", 10, &rpc, &publisher, time.Second)
+
+		// Published without the label
+		assert.Nil(t, watcher.Poll(context.Background()))
+		assert.Equal(t, 1, publisher.CallsCount)
+		assert.Equal(t, "", publisher.TxArgs[0].Destinations[0].Label)
+	})
+}
+
+func TestWatchWalletsIsolatesFailures(t *testing.T) {
+	failing := MockedWalletTransfersGetter{
+		TransfersReturn: []MockedGetTxByTxidReturn{{E: fmt.Errorf("Dummy error")}},
+	}
+	working := MockedWalletTransfersGetter{
+		TransfersReturn: []MockedGetTxByTxidReturn{
+			{Txs: []monerorpc.RpcTx{{TXID: "tx1", Type: "pool", Address: "addr1", Amount: 1}}},
+		},
+	}
+	failingPublisher := MockedTxPublisher{Returns: []error{nil}}
+	workingPublisher := MockedTxPublisher{Returns: []error{nil}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	WatchWallets(ctx, []*WalletWatcher{
+		NewWalletWatcher("failing", 10, &failing, &failingPublisher, time.Millisecond),
+		NewWalletWatcher("working", 10, &working, &workingPublisher, time.Millisecond),
+	})
+
+	assert.Equal(t, 0, failingPublisher.CallsCount)
+	assert.Equal(t, 1, workingPublisher.CallsCount)
+	assert.Equal(t, "working", workingPublisher.TxArgs[0].Wallet)
+	assert.True(t, len(working.MinHeightArgs) > 1)
+}
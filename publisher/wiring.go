@@ -0,0 +1,533 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/xmrstuff/monero-nats-publisher/events"
+	"github.com/xmrstuff/monero-nats-publisher/monerorpc"
+)
+
+// Settings are the command line options of the publisher
+type Settings struct {
+	NATSURL        string
+	ClientIDPrefix string
+	// StateDir is where the local state (e.g. invoices) is kept. None is
+	// kept when empty
+	StateDir string
+	// LockFile is locked while the one-shot commands publish. No locking
+	// when empty
+	LockFile string
+	// AgentSocket is where the tx and block commands hand off their work
+	// to. They do it themselves when empty
+	AgentSocket string
+
+	WalletURL    string
+	WalletProxy  string
+	DaemonURLs   []string
+	DaemonProxy  string
+	DaemonQuorum bool
+	RPCCacheSize int
+
+	SigningAlg     string
+	SigningKeyFile string
+	SigningKeyID   string
+
+	StringAmounts bool
+	// DryRun writes the events to stdout, and leaves the local state and
+	// the agent alone
+	DryRun bool
+
+	IgnoreBelowHeight int
+	MaxExtraAncestors int
+	MaxCatchUp        int
+	VisibilityTimeout time.Duration
+	// BlockHoldTimeout is how long the block command holds a block that
+	// arrives ahead of its predecessor
+	BlockHoldTimeout time.Duration
+}
+
+// Wiring builds the clients and publishers of the commands, from the
+// Settings and the Config
+type Wiring struct {
+	Settings
+	Config *Config
+}
+
+// FromConfig wires the commands with the settings and the config. A nil
+// config is the default one.
+func FromConfig(config *Config, s Settings) *Wiring {
+	if config == nil {
+		config = NewConfig()
+	}
+	return &Wiring{Settings: s, Config: config}
+}
+
+// sink builds what the events are published to: stdout in dry runs, the
+// sinks of the config, or NATS. Persistent sinks keep their connections
+// open until closed.
+func (w *Wiring) sink(persistent bool) (Sink, error) {
+	if w.DryRun {
+		return &WriterPublisher{W: os.Stdout}, nil
+	}
+
+	newNATSClient := func() *NATSClient {
+		natsClient := NewNATSClient(w.NATSURL, w.ClientIDPrefix)
+		natsClient.Persistent = persistent
+		return natsClient
+	}
+
+	if len(w.Config.Sinks) > 0 {
+		fanOut := &FanOutPublisher{Report: ReportOutcomes}
+		for _, sinkConfig := range w.Config.Sinks {
+			var sink Sink = newNATSClient()
+			if sinkConfig.Type != SinkNATS {
+				var err error
+				if sink, err = NewSink(sinkConfig); err != nil {
+					fanOut.Close()
+					return nil, fmt.Errorf("sink %s: %s", sinkConfig.TargetName(), err)
+				}
+				// The target's RetryBudget is the only retry layer, so that
+				// it doesn't multiply with the webhook's own retries
+				if webhook, ok := sink.(*WebhookSink); ok {
+					webhook.Retries = 0
+				}
+			}
+			fanOut.Targets = append(fanOut.Targets, sinkConfig.Target(sink))
+		}
+		return fanOut, nil
+	}
+
+	if w.Config.Sink != nil && w.Config.Sink.Type != SinkNATS {
+		return NewSink(*w.Config.Sink)
+	}
+	return newNATSClient(), nil
+}
+
+// signer loads the signing key. Events aren't signed without one
+func (w *Wiring) signer() (events.Signer, error) {
+	if w.SigningKeyFile == "" {
+		return nil, nil
+	}
+	return events.LoadSigner(w.SigningAlg, w.SigningKeyID, w.SigningKeyFile)
+}
+
+// eventPublisher publishes the events to sink, on channel, encrypted for
+// the recipients of the channel in the config
+func (w *Wiring) eventPublisher(sink Sink, signer events.Signer, channel string) (*EventPublishing, error) {
+	encrypter, err := w.Config.Encrypter(channel)
+	if err != nil {
+		return nil, err
+	}
+	return &EventPublishing{
+		Publisher:     sink,
+		Channel:       channel,
+		StringAmounts: w.StringAmounts,
+		Encrypter:     encrypter,
+		Signer:        signer,
+		Profiles:      w.Config.OutputProfiles(),
+	}, nil
+}
+
+// oneShotPublisher is the event publisher of the commands that publish
+// and exit. It holds the lock file while publishing, if set. The sink must
+// be closed before exiting, so that the best effort sinks are drained.
+func (w *Wiring) oneShotPublisher() (*EventPublishing, Sink, error) {
+	signer, err := w.signer()
+	if err != nil {
+		return nil, nil, err
+	}
+	sink, err := w.sink(false)
+	if err != nil {
+		return nil, nil, err
+	}
+	evPublisher, err := w.eventPublisher(sink, signer, events.DefaultChannel)
+	if err != nil {
+		sink.Close()
+		return nil, nil, err
+	}
+
+	if w.LockFile != "" && !w.DryRun {
+		evPublisher.Publisher = &LockingPublisher{
+			Publisher: evPublisher.Publisher,
+			Lock:      &FileLock{Path: w.LockFile},
+		}
+	}
+	return evPublisher, sink, nil
+}
+
+// withRules applies the rules of the config to the Txs before evPublisher
+// publishes them. Routed Txs are published the same way, to the subject of
+// their rule.
+func (w *Wiring) withRules(evPublisher *EventPublishing) (TxEventPublisher, error) {
+	if len(w.Config.Rules) == 0 {
+		return evPublisher, nil
+	}
+
+	routes := map[string]TxEventPublisher{}
+	for _, r := range w.Config.Rules {
+		if r.Action != RuleRoute {
+			continue
+		}
+		encrypter, err := w.Config.Encrypter(r.Subject)
+		if err != nil {
+			return nil, err
+		}
+		route := *evPublisher
+		route.Channel = r.Subject
+		route.Encrypter = encrypter
+		routes[r.Subject] = &route
+	}
+
+	return &RulesPublisher{
+		TxEventPublisher: evPublisher,
+		Rules:            w.Config.Rules,
+		Routes:           routes,
+	}, nil
+}
+
+// withInvoices matches the Txs against the invoices of the state dir, if
+// any, once txPublisher is done with them. The invoice events are published
+// by evPublisher.
+func (w *Wiring) withInvoices(txPublisher TxEventPublisher, evPublisher *EventPublishing) TxEventPublisher {
+	// Dry runs leave the local state alone
+	if w.StateDir == "" || w.DryRun {
+		return txPublisher
+	}
+
+	// Invoices are tracked whether the rules drop the Txs or not
+	return &InvoiceTrackingPublisher{
+		TxEventPublisher: txPublisher,
+		Tracker:          NewInvoiceTracker(w.StateDir, evPublisher),
+	}
+}
+
+// expireInvoices expires the overdue invoices of the state dir, if any,
+// every InvoiceExpiryInterval in the background, until ctx is done. Their
+// events are published by evPublisher.
+func (w *Wiring) expireInvoices(ctx context.Context, evPublisher *EventPublishing) {
+	if w.StateDir == "" || w.DryRun {
+		return
+	}
+	go NewInvoiceTracker(w.StateDir, evPublisher).ExpireEvery(ctx, InvoiceExpiryInterval)
+}
+
+func (w *Wiring) processTx(txid string, rpcClient monerorpc.TxGetter, evPublisher *EventPublishing) error {
+	txPublisher, err := w.withRules(evPublisher)
+	if err != nil {
+		return err
+	}
+
+	wait := NewVisibilityWait(w.VisibilityTimeout)
+	return ProcessTxid(txid, w.IgnoreBelowHeight, wait, rpcClient, w.withInvoices(txPublisher, evPublisher))
+}
+
+// processBlock holds a block that arrives ahead of its predecessor for up
+// to holdTimeout. No hold when 0.
+func (w *Wiring) processBlock(blockHash string, holdTimeout time.Duration, rpcClient monerorpc.BlockGetter, evPublisher *EventPublishing) error {
+	if w.StateDir == "" || w.DryRun {
+		return ProcessBlockHash(blockHash, w.MaxExtraAncestors, w.IgnoreBelowHeight, rpcClient, evPublisher)
+	}
+
+	catchUpPublisher := &BlockCatchUpPublisher{
+		BlockEventPublisher: evPublisher,
+		Getter:              rpcClient,
+		State:               NewBlockStateStore(w.StateDir),
+		MaxCatchUp:          w.MaxCatchUp,
+		MaxExtraAncestors:   w.MaxExtraAncestors,
+		IgnoreBelowHeight:   w.IgnoreBelowHeight,
+	}
+	orderedPublisher := NewOrderedBlockPublisher(w.StateDir, catchUpPublisher, holdTimeout)
+	return ProcessBlockHash(blockHash, w.MaxExtraAncestors, w.IgnoreBelowHeight, rpcClient, orderedPublisher)
+}
+
+// handOff passes the work to the agent, if there's one running. It returns
+// false when the caller has to do the work itself.
+func (w *Wiring) handOff(kind, id string) bool {
+	if w.AgentSocket == "" || w.DryRun {
+		return false
+	}
+
+	_, err := HandOff(w.AgentSocket, AgentRequest{Kind: kind, ID: id})
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, ErrAgentUnavailable) {
+		log.Printf("Falling back to direct mode: %s", err)
+	}
+	return false
+}
+
+func (w *Wiring) WalletClient() (*monerorpc.RPCClient, error) {
+	rpcClient := monerorpc.NewRPCClient(w.WalletURL)
+	if err := rpcClient.SetProxy(w.WalletProxy); err != nil {
+		return nil, err
+	}
+	return rpcClient, nil
+}
+
+// DaemonPool fails over across the daemons. They aren't probed up front: a
+// daemon is probed the first time a header range fails.
+func (w *Wiring) DaemonPool() (*monerorpc.DaemonPool, error) {
+	if w.DaemonQuorum && len(w.DaemonURLs) < 2 {
+		// Every block would fail to get a second opinion
+		return nil, fmt.Errorf("daemon quorum requires at least 2 daemons, got %d", len(w.DaemonURLs))
+	}
+
+	pool := monerorpc.NewDaemonPool(w.DaemonURLs, w.DaemonQuorum)
+	for _, d := range pool.Daemons {
+		rpcClient := d.Client.(*monerorpc.RPCClient)
+		if err := rpcClient.SetProxy(w.DaemonProxy); err != nil {
+			return nil, err
+		}
+		if w.RPCCacheSize > 0 {
+			// Each daemon gets its own cache, so that quorum checks still
+			// compare what the daemons answer
+			rpcClient.Cache = monerorpc.NewRPCCache(w.RPCCacheSize)
+		}
+	}
+	return pool, nil
+}
+
+// Ping checks that the events can be published
+func (w *Wiring) Ping() error {
+	evPublisher, sink, err := w.oneShotPublisher()
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	if !evPublisher.IsConnected() {
+		return fmt.Errorf("failed to ping NATS at %s", w.NATSURL)
+	}
+	return nil
+}
+
+// PublishTx publishes the events of a Tx, or hands it off to the agent
+func (w *Wiring) PublishTx(txid string) error {
+	if w.handOff(AgentTx, txid) {
+		return nil
+	}
+
+	walletClient, err := w.WalletClient()
+	if err != nil {
+		return err
+	}
+	evPublisher, sink, err := w.oneShotPublisher()
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	return w.processTx(txid, walletClient, evPublisher)
+}
+
+// PublishBlock publishes the event of a block, or hands it off to the
+// agent
+func (w *Wiring) PublishBlock(blockHash string) error {
+	if w.handOff(AgentBlock, blockHash) {
+		return nil
+	}
+
+	daemonClient, err := w.DaemonPool()
+	if err != nil {
+		return err
+	}
+	evPublisher, sink, err := w.oneShotPublisher()
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	return w.processBlock(blockHash, w.BlockHoldTimeout, daemonClient, evPublisher)
+}
+
+// ExpireInvoices expires the overdue invoices, and publishes their events
+func (w *Wiring) ExpireInvoices() error {
+	evPublisher, sink, err := w.oneShotPublisher()
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	tracker := NewInvoiceTracker(w.StateDir, evPublisher)
+	tracker.DryRun = w.DryRun
+	return tracker.Expire()
+}
+
+// inspectPublisher publishes the events to out the way the commands would
+// publish them, with the rules, profiles, encryption and signing of the
+// config
+func (w *Wiring) inspectPublisher(out io.Writer) (*EventPublishing, error) {
+	signer, err := w.signer()
+	if err != nil {
+		return nil, err
+	}
+	return w.eventPublisher(&WriterPublisher{W: out}, signer, events.DefaultChannel)
+}
+
+// InspectTx writes the events that would be published for a Tx to out,
+// one per line. The Tx isn't waited for, and the invoices are left alone.
+func (w *Wiring) InspectTx(txid string, out io.Writer) error {
+	walletClient, err := w.WalletClient()
+	if err != nil {
+		return err
+	}
+	evPublisher, err := w.inspectPublisher(out)
+	if err != nil {
+		return err
+	}
+	txPublisher, err := w.withRules(evPublisher)
+	if err != nil {
+		return err
+	}
+	return ProcessTxid(txid, 0, NewVisibilityWait(0), walletClient, txPublisher)
+}
+
+// InspectBlock writes the event that would be published for a block to
+// out. The missed blocks aren't caught up.
+func (w *Wiring) InspectBlock(blockHash string, out io.Writer) error {
+	daemonClient, err := w.DaemonPool()
+	if err != nil {
+		return err
+	}
+	evPublisher, err := w.inspectPublisher(out)
+	if err != nil {
+		return err
+	}
+	return ProcessBlockHash(blockHash, w.MaxExtraAncestors, 0, daemonClient, evPublisher)
+}
+
+// ServeCommands serves the commands on the subjects under subjectPrefix,
+// until ctx is done. Invoices are created too when there's a state dir.
+func (w *Wiring) ServeCommands(ctx context.Context, subjectPrefix string) error {
+	walletClient, err := w.WalletClient()
+	if err != nil {
+		return err
+	}
+	server, err := NewCommandServer(w.NATSURL, walletClient)
+	if err != nil {
+		return err
+	}
+	defer server.Conn.Close()
+	server.Subject = subjectPrefix
+	if w.StateDir != "" && !w.DryRun {
+		server.Invoices = NewInvoiceStore(w.StateDir)
+	}
+
+	return server.Serve(ctx)
+}
+
+// ServeAgent processes the txs and blocks handed off on AgentSocket, with
+// its connections kept open, until ctx is done
+func (w *Wiring) ServeAgent(ctx context.Context) error {
+	walletClient, err := w.WalletClient()
+	if err != nil {
+		return err
+	}
+	daemonClient, err := w.DaemonPool()
+	if err != nil {
+		return err
+	}
+
+	signer, err := w.signer()
+	if err != nil {
+		return err
+	}
+	sink, err := w.sink(true)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	evPublisher, err := w.eventPublisher(sink, signer, events.DefaultChannel)
+	if err != nil {
+		return err
+	}
+
+	daemonClient.Probe(ctx)
+	w.expireInvoices(ctx, evPublisher)
+
+	agent := NewAgent(w.AgentSocket, map[string]AgentHandler{
+		AgentTx: func(txid string) error {
+			return w.processTx(txid, walletClient, evPublisher)
+		},
+		AgentBlock: func(blockHash string) error {
+			// The agent processes blocks one at a time, so it never
+			// holds them: a block ahead of its predecessor is published
+			// after catching the predecessor up
+			return w.processBlock(blockHash, 0, daemonClient, evPublisher)
+		},
+	})
+	if w.StateDir != "" {
+		agent.Store = NewAgentQueueStore(w.StateDir)
+	}
+	return agent.Serve(ctx)
+}
+
+// walletWatchers watches the wallets of the config, publishing their Txs
+// to sink, each on its own channel
+func (w *Wiring) walletWatchers(sink Sink, signer events.Signer) ([]*WalletWatcher, error) {
+	var walletState *WalletStateStore
+	if w.StateDir != "" && !w.DryRun {
+		walletState = NewWalletStateStore(w.StateDir)
+	}
+	watchers := []*WalletWatcher{}
+	for _, wc := range w.Config.Wallets {
+		evPublisher, err := w.eventPublisher(sink, signer, wc.Channel())
+		if err != nil {
+			return nil, fmt.Errorf("wallet %s: %s", wc.Name, err)
+		}
+		rpcClient := monerorpc.NewAuthenticatedRPCClient(wc.URL, wc.Username, wc.Password)
+		proxy := wc.Proxy
+		if proxy == "" {
+			proxy = w.WalletProxy
+		}
+		if err := rpcClient.SetProxy(proxy); err != nil {
+			return nil, fmt.Errorf("wallet %s: %s", wc.Name, err)
+		}
+		txPublisher, err := w.withRules(evPublisher)
+		if err != nil {
+			return nil, err
+		}
+		txPublisher = w.withInvoices(txPublisher, evPublisher)
+		watcher := NewWalletWatcher(wc.Name, wc.StartHeight, rpcClient, txPublisher, w.Config.PollInterval.Duration)
+		watcher.IgnoreBelowHeight = w.IgnoreBelowHeight
+		watcher.State = walletState
+		watchers = append(watchers, watcher)
+	}
+	return watchers, nil
+}
+
+// WatchWallets polls the wallets of the config concurrently, and publishes
+// their incoming Txs, until ctx is done
+func (w *Wiring) WatchWallets(ctx context.Context) error {
+	if len(w.Config.Wallets) == 0 {
+		return fmt.Errorf("no wallets to watch")
+	}
+
+	sink, err := w.sink(true)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+
+	signer, err := w.signer()
+	if err != nil {
+		return err
+	}
+	watchers, err := w.walletWatchers(sink, signer)
+	if err != nil {
+		return err
+	}
+	// The invoices aren't tied to a wallet, so their expiry is published
+	// to the default channel
+	evPublisher, err := w.eventPublisher(sink, signer, events.DefaultChannel)
+	if err != nil {
+		return err
+	}
+
+	w.expireInvoices(ctx, evPublisher)
+	WatchWallets(ctx, watchers)
+	return nil
+}
@@ -0,0 +1,242 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmrstuff/monero-nats-publisher/events"
+)
+
+func TestWiringSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-wiring")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	w := FromConfig(nil, Settings{NATSURL: "nats://localhost:4222", ClientIDPrefix: "test"})
+	sink, err := w.sink(true)
+	assert.Nil(t, err)
+	natsClient := sink.(*NATSClient)
+	assert.Equal(t, "nats://localhost:4222", natsClient.NATSHost)
+	assert.True(t, natsClient.Persistent)
+
+	config := NewConfig()
+	config.Sinks = []SinkConfig{
+		{Type: SinkNATS, Name: "nats"},
+		{Type: SinkFile, Name: "archive", BestEffort: true, Path: filepath.Join(dir, "events.ndjson")},
+	}
+	w = FromConfig(config, Settings{})
+	sink, err = w.sink(false)
+	assert.Nil(t, err)
+	defer sink.Close()
+	fanOut := sink.(*FanOutPublisher)
+	assert.Len(t, fanOut.Targets, 2)
+	assert.IsType(t, &NATSClient{}, fanOut.Targets[0].Publisher)
+	assert.IsType(t, &FileSink{}, fanOut.Targets[1].Publisher)
+	assert.True(t, fanOut.Targets[1].BestEffort)
+
+	// Dry runs write to stdout whatever the config says
+	w.DryRun = true
+	sink, err = w.sink(false)
+	assert.Nil(t, err)
+	assert.IsType(t, &WriterPublisher{}, sink)
+}
+
+func TestWiringOneShotPublisher(t *testing.T) {
+	w := FromConfig(nil, Settings{LockFile: "/tmp/publisher.lock", StringAmounts: true})
+	evPublisher, sink, err := w.oneShotPublisher()
+	assert.Nil(t, err)
+	assert.True(t, evPublisher.StringAmounts)
+	assert.Equal(t, events.DefaultChannel, evPublisher.Channel)
+	assert.IsType(t, &LockingPublisher{}, evPublisher.Publisher)
+	assert.IsType(t, &NATSClient{}, sink)
+
+	// Dry runs don't take the lock
+	w.DryRun = true
+	evPublisher, sink, err = w.oneShotPublisher()
+	assert.Nil(t, err)
+	assert.IsType(t, &WriterPublisher{}, evPublisher.Publisher)
+	assert.Equal(t, sink, evPublisher.Publisher)
+
+	w.SigningKeyFile = "/nonexistent/signing.key"
+	_, _, err = w.oneShotPublisher()
+	assert.Error(t, err)
+}
+
+// walletServer answers every wallet RPC request with an incoming transfer
+// of tx1 to addr1, whether it's looked up by txid or listed
+func walletServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(`{"result": {
+			"height": 11,
+			"transfers": [{"txid": "tx1", "type": "in", "amount": 5, "address": "addr1", "height": 10}],
+			"in": [{"txid": "tx1", "type": "in", "amount": 5, "address": "addr1", "height": 10}]
+		}}`))
+	}))
+}
+
+func TestWiringPublishTxDrainsBestEffortSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-wiring")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	wallet := walletServer()
+	defer wallet.Close()
+
+	var delivered int32
+	webhook := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		atomic.AddInt32(&delivered, 1)
+	}))
+	defer webhook.Close()
+
+	config := NewConfig()
+	config.Sinks = []SinkConfig{
+		{Type: SinkFile, Name: "archive", Path: filepath.Join(dir, "events.ndjson")},
+		{Type: SinkWebhook, Name: "hook", BestEffort: true, URL: webhook.URL},
+	}
+	w := FromConfig(config, Settings{WalletURL: wallet.URL})
+
+	assert.Nil(t, w.PublishTx("tx1"))
+	// The slow best effort webhook is delivered before the command exits
+	assert.Equal(t, int32(1), atomic.LoadInt32(&delivered))
+}
+
+func TestWiringSinkRetriesOnce(t *testing.T) {
+	var posts int32
+	webhook := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&posts, 1)
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer webhook.Close()
+
+	config := NewConfig()
+	config.Sinks = []SinkConfig{{Type: SinkWebhook, Name: "hook", RetryBudget: 2, URL: webhook.URL}}
+	w := FromConfig(config, Settings{})
+	sink, err := w.sink(false)
+	assert.Nil(t, err)
+	defer sink.Close()
+
+	assert.Error(t, sink.Publish([]byte(`{}`), events.DefaultChannel))
+	// The webhook doesn't retry on its own within the budget of its target
+	assert.Equal(t, int32(3), atomic.LoadInt32(&posts))
+}
+
+func TestWiringWalletWatchersTrackInvoices(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-wiring")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	wallet := walletServer()
+	defer wallet.Close()
+
+	inv, err := events.NewInvoice("inv1", "addr1", 5, time.Now(), 0)
+	assert.Nil(t, err)
+	assert.Nil(t, NewInvoiceStore(dir).Add(*inv))
+
+	config := NewConfig()
+	config.Wallets = []WalletConfig{{Name: "shop", URL: wallet.URL}}
+	w := FromConfig(config, Settings{StateDir: dir})
+
+	sink := &RecordingPublisher{}
+	watchers, err := w.walletWatchers(sink, nil)
+	assert.Nil(t, err)
+	assert.Len(t, watchers, 1)
+	assert.Nil(t, watchers[0].Poll(context.Background()))
+
+	invoices, err := NewInvoiceStore(dir).List()
+	assert.Nil(t, err)
+	assert.Equal(t, events.InvoicePaid, invoices[0].Status)
+	assert.Equal(t, uint64(5), invoices[0].Received)
+	// The Tx event, and the invoice's
+	assert.Len(t, sink.Published[events.DefaultChannel], 2)
+}
+
+func TestWiringInspectTx(t *testing.T) {
+	wallet := walletServer()
+	defer wallet.Close()
+
+	w := FromConfig(nil, Settings{WalletURL: wallet.URL, StringAmounts: true})
+	out := bytes.Buffer{}
+	assert.Nil(t, w.InspectTx("tx1", &out))
+	assert.Contains(t, out.String(), `"amount_atomic":"5"`)
+
+	// Dropped Txs would not be published, so there's nothing to print
+	config := NewConfig()
+	config.Rules = []Rule{{Name: "blocked", Action: RuleDrop, Match: RuleMatch{Addresses: []string{"addr1"}}}}
+	w = FromConfig(config, Settings{WalletURL: wallet.URL})
+	out.Reset()
+	assert.Nil(t, w.InspectTx("tx1", &out))
+	assert.Empty(t, out.String())
+}
+
+func TestWiringWithRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-wiring")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "ops.pub")
+	assert.Nil(t, ioutil.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(make([]byte, 32))), 0600))
+
+	config := NewConfig()
+	config.Rules = []Rule{
+		{Name: "blocked", Action: RuleDrop, Match: RuleMatch{Addresses: []string{"addr0"}}},
+		{Name: "merchant1", Action: RuleRoute, Subject: "merchant1.monero", Match: RuleMatch{Addresses: []string{"addr1"}}},
+	}
+	config.Encryption = []EncryptionConfig{{
+		Subject:    "merchant1.monero",
+		Recipients: []RecipientConfig{{KeyID: "ops", PublicKeyFile: keyFile}},
+	}}
+	w := FromConfig(config, Settings{})
+
+	evPublisher := &EventPublishing{Publisher: &WriterPublisher{W: ioutil.Discard}}
+	txPublisher, err := w.withRules(evPublisher)
+	assert.Nil(t, err)
+	rulesPublisher := txPublisher.(*RulesPublisher)
+	assert.Equal(t, config.Rules, rulesPublisher.Rules)
+	assert.Len(t, rulesPublisher.Routes, 1)
+
+	route := rulesPublisher.Routes["merchant1.monero"].(*EventPublishing)
+	assert.Equal(t, "merchant1.monero", route.Channel)
+	assert.Equal(t, "ops", route.Encrypter.Recipients[0].KeyID)
+	// The default channel isn't encrypted
+	assert.Nil(t, evPublisher.Encrypter)
+
+	// Without rules, the Txs go straight to the event publisher
+	txPublisher, err = FromConfig(nil, Settings{}).withRules(evPublisher)
+	assert.Nil(t, err)
+	assert.Equal(t, evPublisher, txPublisher)
+}
+
+func TestWiringDaemonPoolQuorum(t *testing.T) {
+	w := FromConfig(nil, Settings{DaemonURLs: []string{"http://localhost:38081"}, DaemonQuorum: true})
+	_, err := w.DaemonPool()
+	assert.Error(t, err)
+
+	w.DaemonURLs = append(w.DaemonURLs, "http://localhost:38082")
+	pool, err := w.DaemonPool()
+	assert.Nil(t, err)
+	assert.True(t, pool.Quorum)
+}
+
+func TestWiringHandOff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "publisher-wiring")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// Nothing listens on the socket, so the command does the work itself
+	w := FromConfig(nil, Settings{AgentSocket: filepath.Join(dir, "agent.sock")})
+	assert.False(t, w.handOff(AgentTx, "txid"))
+
+	w = FromConfig(nil, Settings{})
+	assert.False(t, w.handOff(AgentTx, "txid"))
+}
@@ -0,0 +1,23 @@
+package publisher
+
+import (
+	"fmt"
+	"io"
+)
+
+// WriterPublisher writes the events to W, one per line, instead of
+// publishing them. It's what dry runs publish to.
+type WriterPublisher struct {
+	W io.Writer
+}
+
+func (p *WriterPublisher) Publish(payload []byte, channel string) error {
+	_, err := fmt.Fprintf(p.W, "%s\n", payload)
+	return err
+}
+
+func (p *WriterPublisher) IsConnected() bool {
+	return true
+}
+
+func (p *WriterPublisher) Close() {}